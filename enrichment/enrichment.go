@@ -0,0 +1,116 @@
+package enrichment
+
+import (
+	"context"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// Result holds the labels and annotations that a Source adds to an alert.
+type Result struct {
+	Labels      model.LabelSet `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Annotations model.LabelSet `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+}
+
+// Source looks up the enrichment of an alert from its labels. A Source must be safe to call concurrently, and should
+// return the same Result for the same labels.
+type Source interface {
+	Lookup(ctx context.Context, labels model.LabelSet) (Result, error)
+}
+
+// SourceFunc allows a Go callback to be used as a Source.
+type SourceFunc func(ctx context.Context, labels model.LabelSet) (Result, error)
+
+func (f SourceFunc) Lookup(ctx context.Context, labels model.LabelSet) (Result, error) {
+	return f(ctx, labels)
+}
+
+// Stage is a notification pipeline stage that enriches the alerts with the labels and annotations of its sources.
+//
+// Enrichment is deterministic: labels and annotations already present in an alert are never overwritten, and when
+// several sources provide the same key the first source wins. The Stage should be registered at the pre-integration
+// hook of the pipeline, so that the notification log deduplicates notifications on the labels the alerts were
+// received with, regardless of the enrichment.
+type Stage struct {
+	sources []Source
+}
+
+// NewStage returns a new Stage that looks up its sources in the given order.
+func NewStage(sources ...Source) *Stage {
+	return &Stage{sources: sources}
+}
+
+// Exec implements the Stage interface. The alerts given are never modified, enriched copies are returned instead.
+// A failing source is logged and skipped.
+func (s *Stage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	res := make([]*types.Alert, 0, len(alerts))
+	for _, a := range alerts {
+		res = append(res, s.enrich(ctx, l, a))
+	}
+	return ctx, res, nil
+}
+
+func (s *Stage) enrich(ctx context.Context, l log.Logger, a *types.Alert) *types.Alert {
+	var labels, annotations model.LabelSet
+	for i, src := range s.sources {
+		r, err := src.Lookup(ctx, a.Labels)
+		if err != nil {
+			level.Warn(l).Log("msg", "failed to look up alert enrichment", "source", i, "alert", a.Name(), "err", err)
+			continue
+		}
+		labels = merge(labels, a.Labels, r.Labels)
+		annotations = merge(annotations, a.Annotations, r.Annotations)
+	}
+
+	if labels == nil && annotations == nil {
+		return a
+	}
+
+	enriched := *a
+	if labels != nil {
+		enriched.Labels = a.Labels.Merge(labels)
+	}
+	if annotations != nil {
+		enriched.Annotations = a.Annotations.Merge(annotations)
+	}
+	return &enriched
+}
+
+// merge adds to dst the pairs of src that are neither in the original set nor already in dst.
+func merge(dst, original, src model.LabelSet) model.LabelSet {
+	for k, v := range src {
+		if _, ok := original[k]; ok {
+			continue
+		}
+		if _, ok := dst[k]; ok {
+			continue
+		}
+		if dst == nil {
+			dst = model.LabelSet{}
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+// matches returns true if the labels contain every pair of the matcher set.
+func matches(match, labels model.LabelSet) bool {
+	for k, v := range match {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// keyOf returns the values of the key labels in a stable representation.
+func keyOf(keyLabels []model.LabelName, labels model.LabelSet) string {
+	key := make(model.LabelSet, len(keyLabels))
+	for _, k := range keyLabels {
+		key[k] = labels[k]
+	}
+	return key.String()
+}
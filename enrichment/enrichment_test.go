@@ -0,0 +1,61 @@
+package enrichment
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStage(t *testing.T) {
+	owners := NewStaticSource([]Mapping{{
+		Match:       model.LabelSet{"service": "api"},
+		Labels:      model.LabelSet{"owner": "team-a", "tier": "1"},
+		Annotations: model.LabelSet{"runbook_url": "https://runbooks/api"},
+	}})
+	tiers := SourceFunc(func(_ context.Context, labels model.LabelSet) (Result, error) {
+		return Result{Labels: model.LabelSet{"tier": "2", "instance": "overwritten"}}, nil
+	})
+	failing := SourceFunc(func(_ context.Context, labels model.LabelSet) (Result, error) {
+		return Result{}, errors.New("unavailable")
+	})
+
+	alerts := []*types.Alert{
+		{Alert: model.Alert{
+			Labels:      model.LabelSet{"alertname": "HighLatency", "service": "api", "instance": "api-1"},
+			Annotations: model.LabelSet{"runbook_url": "https://runbooks/custom"},
+		}},
+		{Alert: model.Alert{
+			Labels: model.LabelSet{"alertname": "HighLatency", "service": "web", "instance": "web-1"},
+		}},
+	}
+
+	_, res, err := NewStage(failing, owners, tiers).Exec(context.Background(), log.NewNopLogger(), alerts...)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+
+	// The first source providing a key wins, and the alert's own labels and annotations are never overwritten.
+	require.Equal(t, model.LabelSet{"alertname": "HighLatency", "service": "api", "instance": "api-1", "owner": "team-a", "tier": "1"}, res[0].Labels)
+	require.Equal(t, model.LabelSet{"runbook_url": "https://runbooks/custom"}, res[0].Annotations)
+	require.Equal(t, model.LabelSet{"alertname": "HighLatency", "service": "web", "instance": "web-1", "tier": "2"}, res[1].Labels)
+
+	// The original alerts are left untouched.
+	require.Equal(t, model.LabelSet{"alertname": "HighLatency", "service": "api", "instance": "api-1"}, alerts[0].Labels)
+	require.Equal(t, model.LabelSet{"alertname": "HighLatency", "service": "web", "instance": "web-1"}, alerts[1].Labels)
+
+	// Enrichment is deterministic.
+	_, again, err := NewStage(failing, owners, tiers).Exec(context.Background(), log.NewNopLogger(), alerts...)
+	require.NoError(t, err)
+	require.Equal(t, res, again)
+}
+
+func TestStage_NoEnrichment(t *testing.T) {
+	alert := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "test"}}}
+	_, res, err := NewStage(NewStaticSource(nil)).Exec(context.Background(), log.NewNopLogger(), alert)
+	require.NoError(t, err)
+	require.Same(t, alert, res[0])
+}
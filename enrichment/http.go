@@ -0,0 +1,172 @@
+package enrichment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	defaultHTTPSourceTTL        = 5 * time.Minute
+	defaultHTTPSourceTimeout    = 5 * time.Second
+	defaultHTTPSourceMaxEntries = 10000
+)
+
+// HTTPSourceConfig is the configuration of an HTTPSource.
+type HTTPSourceConfig struct {
+	// URL is requested with the values of the key labels as query parameters, and must respond with a JSON
+	// encoded Result. A 404 response means that there is no enrichment for the key.
+	URL string
+	// KeyLabels are the labels that identify an enrichment. Alerts missing any of them are not looked up.
+	KeyLabels []model.LabelName
+	// TTL is for how long a response is cached. Defaults to 5 minutes.
+	TTL time.Duration
+	// Timeout of each request. Defaults to 5 seconds.
+	Timeout time.Duration
+	// MaxEntries bounds the number of cached responses. Defaults to 10000.
+	MaxEntries int
+	Headers    map[string]string
+	Client     *http.Client
+}
+
+type cacheEntry struct {
+	result  Result
+	expires time.Time
+}
+
+// HTTPSource is a Source that looks up the enrichment of alerts from an HTTP endpoint and caches the responses.
+// When a request fails, the last known response for the key is used for as long as it stays cached.
+type HTTPSource struct {
+	cfg HTTPSourceConfig
+	url *url.URL
+	now func() time.Time
+
+	mtx   sync.Mutex
+	cache map[string]cacheEntry
+}
+
+// NewHTTPSource returns a new HTTPSource.
+func NewHTTPSource(cfg HTTPSourceConfig) (*HTTPSource, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if len(cfg.KeyLabels) == 0 {
+		return nil, errors.New("at least one key label is required")
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultHTTPSourceTTL
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultHTTPSourceTimeout
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = defaultHTTPSourceMaxEntries
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &HTTPSource{
+		cfg:   cfg,
+		url:   u,
+		now:   time.Now,
+		cache: make(map[string]cacheEntry),
+	}, nil
+}
+
+// Lookup implements the Source interface.
+func (s *HTTPSource) Lookup(ctx context.Context, labels model.LabelSet) (Result, error) {
+	for _, k := range s.cfg.KeyLabels {
+		if _, ok := labels[k]; !ok {
+			return Result{}, nil
+		}
+	}
+
+	key := keyOf(s.cfg.KeyLabels, labels)
+	now := s.now()
+
+	s.mtx.Lock()
+	cached, ok := s.cache[key]
+	s.mtx.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.result, nil
+	}
+
+	r, err := s.fetch(ctx, labels)
+	if err != nil {
+		if ok {
+			return cached.result, nil
+		}
+		return Result{}, err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if len(s.cache) >= s.cfg.MaxEntries {
+		s.evict(now)
+	}
+	s.cache[key] = cacheEntry{result: r, expires: now.Add(s.cfg.TTL)}
+	return r, nil
+}
+
+func (s *HTTPSource) fetch(ctx context.Context, labels model.LabelSet) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+
+	u := *s.url
+	q := u.Query()
+	for _, k := range s.cfg.KeyLabels {
+		q.Set(string(k), string(labels[k]))
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return Result{}, nil
+	}
+	if resp.StatusCode/100 != 2 {
+		return Result{}, fmt.Errorf("failed to look up enrichment - status code %d", resp.StatusCode)
+	}
+
+	var r Result
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&r); err != nil {
+		return Result{}, fmt.Errorf("failed to decode enrichment: %w", err)
+	}
+	return r, nil
+}
+
+// evict removes the expired entries of the cache or, if none are expired, all of them.
+func (s *HTTPSource) evict(now time.Time) {
+	for k, e := range s.cache {
+		if !now.Before(e.expires) {
+			delete(s.cache, k)
+		}
+	}
+	if len(s.cache) >= s.cfg.MaxEntries {
+		s.cache = make(map[string]cacheEntry)
+	}
+}
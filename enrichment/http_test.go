@@ -0,0 +1,91 @@
+package enrichment
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPSource(t *testing.T) {
+	var (
+		requests int32
+		healthy  int32 = 1
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		require.Equal(t, "secret", r.Header.Get("Authorization"))
+		switch r.URL.Query().Get("service") {
+		case "api":
+			_, _ = w.Write([]byte(`{"labels": {"owner": "team-a"}, "annotations": {"runbook_url": "https://runbooks/api"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	s, err := NewHTTPSource(HTTPSourceConfig{
+		URL:       server.URL + "/lookup",
+		KeyLabels: []model.LabelName{"service"},
+		TTL:       time.Minute,
+		Headers:   map[string]string{"Authorization": "secret"},
+	})
+	require.NoError(t, err)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	expected := Result{
+		Labels:      model.LabelSet{"owner": "team-a"},
+		Annotations: model.LabelSet{"runbook_url": "https://runbooks/api"},
+	}
+
+	r, err := s.Lookup(context.Background(), model.LabelSet{"service": "api", "instance": "api-1"})
+	require.NoError(t, err)
+	require.Equal(t, expected, r)
+
+	// The response is cached per key label values.
+	r, err = s.Lookup(context.Background(), model.LabelSet{"service": "api", "instance": "api-2"})
+	require.NoError(t, err)
+	require.Equal(t, expected, r)
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// Unknown keys have no enrichment.
+	r, err = s.Lookup(context.Background(), model.LabelSet{"service": "web"})
+	require.NoError(t, err)
+	require.Equal(t, Result{}, r)
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// Alerts without the key labels are not looked up.
+	r, err = s.Lookup(context.Background(), model.LabelSet{"alertname": "test"})
+	require.NoError(t, err)
+	require.Equal(t, Result{}, r)
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// Once expired, a failed lookup falls back to the cached response.
+	atomic.StoreInt32(&healthy, 0)
+	now = now.Add(2 * time.Minute)
+	r, err = s.Lookup(context.Background(), model.LabelSet{"service": "api"})
+	require.NoError(t, err)
+	require.Equal(t, expected, r)
+	require.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	_, err = s.Lookup(context.Background(), model.LabelSet{"service": "db"})
+	require.EqualError(t, err, "failed to look up enrichment - status code 500")
+}
+
+func TestNewHTTPSource(t *testing.T) {
+	_, err := NewHTTPSource(HTTPSourceConfig{URL: "http://localhost"})
+	require.EqualError(t, err, "at least one key label is required")
+
+	_, err = NewHTTPSource(HTTPSourceConfig{URL: ":", KeyLabels: []model.LabelName{"service"}})
+	require.Error(t, err)
+}
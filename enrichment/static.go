@@ -0,0 +1,137 @@
+package enrichment
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	csvLabelPrefix      = "label:"
+	csvAnnotationPrefix = "annotation:"
+)
+
+// Mapping is an entry of a StaticSource. Alerts that have every label of Match receive its labels and annotations.
+type Mapping struct {
+	Match       model.LabelSet `json:"match" yaml:"match"`
+	Labels      model.LabelSet `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Annotations model.LabelSet `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+}
+
+// StaticSource is a Source that enriches alerts from a fixed list of mappings. Mappings are evaluated in order and
+// all matching mappings apply, with earlier mappings taking precedence on conflicting keys.
+type StaticSource struct {
+	mappings []Mapping
+}
+
+// NewStaticSource returns a new StaticSource for the given mappings.
+func NewStaticSource(mappings []Mapping) *StaticSource {
+	return &StaticSource{mappings: mappings}
+}
+
+// Lookup implements the Source interface.
+func (s *StaticSource) Lookup(_ context.Context, labels model.LabelSet) (Result, error) {
+	var r Result
+	for _, m := range s.mappings {
+		if !matches(m.Match, labels) {
+			continue
+		}
+		r.Labels = merge(r.Labels, nil, m.Labels)
+		r.Annotations = merge(r.Annotations, nil, m.Annotations)
+	}
+	return r, nil
+}
+
+// ParseYAML parses a list of mappings, for example:
+//
+//	# Alerts of the api service are owned by team-a.
+//	- match:
+//	    service: api
+//	  labels:
+//	    owner: team-a
+//	  annotations:
+//	    runbook_url: https://runbooks/api
+func ParseYAML(r io.Reader) (*StaticSource, error) {
+	var mappings []Mapping
+	if err := yaml.NewDecoder(r).Decode(&mappings); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse mappings: %w", err)
+	}
+	for i, m := range mappings {
+		if len(m.Match) == 0 {
+			return nil, fmt.Errorf("mapping %d has no labels to match", i)
+		}
+	}
+	return NewStaticSource(mappings), nil
+}
+
+// ParseCSV parses a table of mappings. The header row names the columns: columns prefixed with "label:" or
+// "annotation:" hold the labels and annotations to add, any other column is a label to match. Empty cells are
+// ignored. For example:
+//
+//	service,label:owner,annotation:runbook_url
+//	api,team-a,https://runbooks/api
+func ParseCSV(r io.Reader) (*StaticSource, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mappings: %w", err)
+	}
+	if len(records) == 0 {
+		return NewStaticSource(nil), nil
+	}
+
+	header := records[0]
+	mappings := make([]Mapping, 0, len(records)-1)
+	for i, record := range records[1:] {
+		m := Mapping{Match: model.LabelSet{}}
+		for j, value := range record {
+			if value == "" {
+				continue
+			}
+			column := strings.TrimSpace(header[j])
+			switch {
+			case strings.HasPrefix(column, csvLabelPrefix):
+				if m.Labels == nil {
+					m.Labels = model.LabelSet{}
+				}
+				m.Labels[model.LabelName(strings.TrimPrefix(column, csvLabelPrefix))] = model.LabelValue(value)
+			case strings.HasPrefix(column, csvAnnotationPrefix):
+				if m.Annotations == nil {
+					m.Annotations = model.LabelSet{}
+				}
+				m.Annotations[model.LabelName(strings.TrimPrefix(column, csvAnnotationPrefix))] = model.LabelValue(value)
+			default:
+				m.Match[model.LabelName(column)] = model.LabelValue(value)
+			}
+		}
+		if len(m.Match) == 0 {
+			// The header is the first line of the file.
+			return nil, fmt.Errorf("mapping on line %d has no labels to match", i+2)
+		}
+		mappings = append(mappings, m)
+	}
+	return NewStaticSource(mappings), nil
+}
+
+// LoadFile loads a StaticSource from a CSV file or, for any other extension, a YAML file.
+func LoadFile(path string) (*StaticSource, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return ParseCSV(f)
+	}
+	return ParseYAML(f)
+}
@@ -0,0 +1,101 @@
+package enrichment
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticSource_Lookup(t *testing.T) {
+	s := NewStaticSource([]Mapping{
+		{
+			Match:  model.LabelSet{"service": "api", "env": "prod"},
+			Labels: model.LabelSet{"tier": "1"},
+		}, {
+			Match:       model.LabelSet{"service": "api"},
+			Labels:      model.LabelSet{"owner": "team-a", "tier": "2"},
+			Annotations: model.LabelSet{"runbook_url": "https://runbooks/api"},
+		},
+	})
+
+	r, err := s.Lookup(context.Background(), model.LabelSet{"service": "api", "env": "prod"})
+	require.NoError(t, err)
+	require.Equal(t, Result{
+		Labels:      model.LabelSet{"owner": "team-a", "tier": "1"},
+		Annotations: model.LabelSet{"runbook_url": "https://runbooks/api"},
+	}, r)
+
+	r, err = s.Lookup(context.Background(), model.LabelSet{"service": "api", "env": "dev"})
+	require.NoError(t, err)
+	require.Equal(t, model.LabelSet{"owner": "team-a", "tier": "2"}, r.Labels)
+
+	r, err = s.Lookup(context.Background(), model.LabelSet{"service": "web"})
+	require.NoError(t, err)
+	require.Equal(t, Result{}, r)
+}
+
+func TestParseYAML(t *testing.T) {
+	s, err := ParseYAML(strings.NewReader(`
+- match:
+    service: api
+  labels:
+    owner: team-a
+  annotations:
+    runbook_url: https://runbooks/api
+`))
+	require.NoError(t, err)
+	require.Equal(t, []Mapping{{
+		Match:       model.LabelSet{"service": "api"},
+		Labels:      model.LabelSet{"owner": "team-a"},
+		Annotations: model.LabelSet{"runbook_url": "https://runbooks/api"},
+	}}, s.mappings)
+
+	s, err = ParseYAML(strings.NewReader(""))
+	require.NoError(t, err)
+	require.Empty(t, s.mappings)
+
+	_, err = ParseYAML(strings.NewReader(`- labels: {owner: team-a}`))
+	require.EqualError(t, err, "mapping 0 has no labels to match")
+}
+
+func TestParseCSV(t *testing.T) {
+	s, err := ParseCSV(strings.NewReader(`service,instance,label:owner,annotation:runbook_url
+api,,team-a,https://runbooks/api
+web,web-1,team-b,
+`))
+	require.NoError(t, err)
+	require.Equal(t, []Mapping{
+		{
+			Match:       model.LabelSet{"service": "api"},
+			Labels:      model.LabelSet{"owner": "team-a"},
+			Annotations: model.LabelSet{"runbook_url": "https://runbooks/api"},
+		}, {
+			Match:  model.LabelSet{"service": "web", "instance": "web-1"},
+			Labels: model.LabelSet{"owner": "team-b"},
+		},
+	}, s.mappings)
+
+	_, err = ParseCSV(strings.NewReader("service,label:owner\n,team-a\n"))
+	require.EqualError(t, err, "mapping on line 2 has no labels to match")
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "owners.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte("service,label:owner\napi,team-a\n"), 0600))
+	yamlPath := filepath.Join(dir, "owners.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte("- match: {service: api}\n  labels: {owner: team-a}\n"), 0600))
+
+	for _, path := range []string{csvPath, yamlPath} {
+		s, err := LoadFile(path)
+		require.NoError(t, err)
+		r, err := s.Lookup(context.Background(), model.LabelSet{"service": "api"})
+		require.NoError(t, err)
+		require.Equal(t, model.LabelSet{"owner": "team-a"}, r.Labels)
+	}
+}
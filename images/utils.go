@@ -13,6 +13,7 @@ import (
 
 	"github.com/grafana/alerting/logging"
 	"github.com/grafana/alerting/models"
+	"github.com/grafana/alerting/tracing"
 )
 
 const (
@@ -33,7 +34,9 @@ func getImage(ctx context.Context, l logging.Logger, imageStore ImageStore, aler
 	ctx, cancelFunc := context.WithTimeout(ctx, ImageStoreTimeout)
 	defer cancelFunc()
 
+	ctx, span := tracing.Start(ctx, "images.GetImage")
 	img, err := imageStore.GetImage(ctx, token)
+	tracing.End(span, err)
 	if errors.Is(err, ErrImageNotFound) || errors.Is(err, ErrImagesUnavailable) {
 		return nil, nil
 	} else if err != nil {
@@ -0,0 +1,201 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/alertmanager/dispatch"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+var (
+	ErrAlertGroupNotFound     = errors.New("alert group not found")
+	ErrInvalidAcknowledgement = errors.New("invalid acknowledgement")
+)
+
+const defaultAcknowledgementsGCInterval = 15 * time.Minute
+
+// GroupAcknowledgement acknowledges the firing alerts of an aggregation group: the repeat notifications of the group
+// are suppressed until its firing alerts change or the acknowledgement expires.
+type GroupAcknowledgement struct {
+	GroupKey string `json:"groupKey"`
+	By       string `json:"by"`
+	Comment  string `json:"comment,omitempty"`
+	// Alerts are the fingerprints of the firing alerts acknowledged, sorted.
+	Alerts    []model.Fingerprint `json:"alerts"`
+	Until     time.Time           `json:"until"`
+	UpdatedAt time.Time           `json:"updatedAt"`
+}
+
+func (a *GroupAcknowledgement) active(now time.Time) bool {
+	return now.Before(a.Until)
+}
+
+func (a *GroupAcknowledgement) storeKey() string {
+	return a.GroupKey
+}
+
+func (a *GroupAcknowledgement) lastUpdate() time.Time {
+	return a.UpdatedAt
+}
+
+// acknowledgements stores the acknowledgements of the aggregation groups, by group key. Like silences, they are
+// replicated to the other peers of the cluster, the most recently updated acknowledgement of a group winning.
+type acknowledgements struct {
+	*replicatedStore[*GroupAcknowledgement]
+	retention time.Duration
+}
+
+func newAcknowledgements(snapshotFile string, retention time.Duration) (*acknowledgements, error) {
+	s, err := newReplicatedStore[*GroupAcknowledgement]("acknowledgements", snapshotFile)
+	if err != nil {
+		return nil, err
+	}
+	return &acknowledgements{replicatedStore: s, retention: retention}, nil
+}
+
+// get returns the active acknowledgement of the group, if any.
+func (a *acknowledgements) get(groupKey string, now time.Time) (*GroupAcknowledgement, bool) {
+	e, ok := a.replicatedStore.get(groupKey)
+	if !ok || !e.active(now) {
+		return nil, false
+	}
+	return e, true
+}
+
+// expire ends the acknowledgement of the group.
+func (a *acknowledgements) expire(groupKey string, now time.Time) {
+	e, ok := a.replicatedStore.get(groupKey)
+	if !ok {
+		return
+	}
+
+	expired := *e
+	expired.Until = now
+	expired.UpdatedAt = now
+	a.set(&expired)
+}
+
+// gc removes the acknowledgements which expired longer than the retention ago and returns how many were removed.
+func (a *acknowledgements) gc(now time.Time) int {
+	return a.deleteIf(func(e *GroupAcknowledgement) bool {
+		return e.Until.Add(a.retention).Before(now)
+	})
+}
+
+// firingFingerprints returns the sorted fingerprints of the alerts which are firing at the given time.
+func firingFingerprints(alerts []*types.Alert, now time.Time) []model.Fingerprint {
+	res := make([]model.Fingerprint, 0, len(alerts))
+	for _, a := range alerts {
+		if !a.ResolvedAt(now) {
+			res = append(res, a.Fingerprint())
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+func equalFingerprints(a, b []model.Fingerprint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// acknowledgementStage suppresses the notifications of the acknowledged groups whose firing alerts did not change.
+// The acknowledgement of a group ends as soon as its firing alerts change.
+type acknowledgementStage struct {
+	acks *acknowledgements
+}
+
+// Exec implements the Stage interface.
+func (s *acknowledgementStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	gkey, ok := notify.GroupKey(ctx)
+	if !ok {
+		return ctx, alerts, nil
+	}
+	now, ok := notify.Now(ctx)
+	if !ok {
+		now = time.Now()
+	}
+	ack, ok := s.acks.get(gkey, now)
+	if !ok {
+		return ctx, alerts, nil
+	}
+
+	if equalFingerprints(ack.Alerts, firingFingerprints(alerts, now)) {
+		level.Debug(l).Log("msg", "notification suppressed by acknowledgement", "by", ack.By, "until", ack.Until)
+		return ctx, nil, nil
+	}
+	s.acks.expire(gkey, now)
+	return ctx, alerts, nil
+}
+
+// AcknowledgeGroup acknowledges the firing alerts of the aggregation group with the given key until the given time.
+// It returns ErrAlertGroupNotFound if there is no such group.
+func (am *GrafanaAlertmanager) AcknowledgeGroup(groupKey, by, comment string, until time.Time) (*GroupAcknowledgement, error) {
+	now := time.Now()
+	if by == "" {
+		return nil, fmt.Errorf("%w: the author is required", ErrInvalidAcknowledgement)
+	}
+	if !until.After(now) {
+		return nil, fmt.Errorf("%w: the end must be in the future", ErrInvalidAcknowledgement)
+	}
+
+	am.reloadConfigMtx.RLock()
+	var group *dispatch.AlertGroup
+	if am.dispatcher != nil {
+		groups, _ := am.dispatcher.Groups(
+			func(*dispatch.Route) bool { return true },
+			func(*types.Alert, time.Time) bool { return true },
+		)
+		for _, g := range groups {
+			if am.groupKey(g) == groupKey {
+				group = g
+				break
+			}
+		}
+	}
+	am.reloadConfigMtx.RUnlock()
+	if group == nil {
+		return nil, ErrAlertGroupNotFound
+	}
+
+	ack := &GroupAcknowledgement{
+		GroupKey:  groupKey,
+		By:        by,
+		Comment:   comment,
+		Alerts:    firingFingerprints(group.Alerts, now),
+		Until:     until,
+		UpdatedAt: now,
+	}
+	am.acknowledgements.set(ack)
+	return ack, nil
+}
+
+// groupKey returns the key of the aggregation group, empty if no route of the tree matches it anymore.
+func (am *GrafanaAlertmanager) groupKey(g *dispatch.AlertGroup) string {
+	r := routeOfGroup(am.route, g)
+	if r == nil {
+		return ""
+	}
+	return routeGroupKey(r, g.Labels)
+}
+
+// routeGroupKey returns the key of the aggregation group of the route with the group labels. It is the key that
+// identifies groups across the API, to acknowledge them and in the events of watches.
+func routeGroupKey(r *dispatch.Route, groupLabels model.LabelSet) string {
+	return fmt.Sprintf("%s:%s", r.Key(), groupLabels)
+}
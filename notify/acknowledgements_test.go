@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcknowledgementStage(t *testing.T) {
+	now := time.Now()
+	a := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "a"}, StartsAt: now}}
+	b := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "b"}, StartsAt: now}}
+	resolved := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "c"}, StartsAt: now, EndsAt: now.Add(-time.Minute)}}
+
+	var broadcasts int
+	acks, err := newAcknowledgements("", 0)
+	require.NoError(t, err)
+	acks.setBroadcast(func([]byte) { broadcasts++ })
+	acks.set(&GroupAcknowledgement{
+		GroupKey:  "group",
+		By:        "admin",
+		Alerts:    firingFingerprints([]*types.Alert{a, b}, now),
+		Until:     now.Add(time.Hour),
+		UpdatedAt: now,
+	})
+	s := &acknowledgementStage{acks: acks}
+
+	ctx := notify.WithNow(notify.WithGroupKey(context.Background(), "group"), now)
+	_, res, err := s.Exec(ctx, log.NewNopLogger(), b, a, resolved)
+	require.NoError(t, err)
+	require.Empty(t, res, "the firing alerts are acknowledged")
+
+	_, res, err = s.Exec(notify.WithGroupKey(ctx, "other"), log.NewNopLogger(), a)
+	require.NoError(t, err)
+	require.Len(t, res, 1, "the group is not acknowledged")
+
+	_, res, err = s.Exec(ctx, log.NewNopLogger(), a)
+	require.NoError(t, err)
+	require.Len(t, res, 1, "the firing alerts changed")
+	_, ok := acks.get("group", now)
+	require.False(t, ok, "the acknowledgement ended")
+	require.Equal(t, 2, broadcasts)
+
+	_, res, err = s.Exec(ctx, log.NewNopLogger(), a, b)
+	require.NoError(t, err)
+	require.Len(t, res, 2, "the acknowledgement does not apply again")
+}
+
+func TestAcknowledgementsMerge(t *testing.T) {
+	now := time.Now()
+	acks, err := newAcknowledgements("", time.Hour)
+	require.NoError(t, err)
+	var broadcast []byte
+	acks.setBroadcast(func(b []byte) { broadcast = b })
+
+	older := &GroupAcknowledgement{GroupKey: "group", By: "older", Until: now.Add(time.Hour), UpdatedAt: now.Add(-time.Minute)}
+	newer := &GroupAcknowledgement{GroupKey: "group", By: "newer", Until: now.Add(time.Hour), UpdatedAt: now}
+	expired := &GroupAcknowledgement{GroupKey: "expired", By: "admin", Until: now.Add(-2 * time.Hour), UpdatedAt: now.Add(-3 * time.Hour)}
+
+	b, err := json.Marshal([]*GroupAcknowledgement{newer, expired})
+	require.NoError(t, err)
+	require.NoError(t, acks.Merge(b))
+	require.Equal(t, b, broadcast, "new acknowledgements are broadcast again")
+
+	broadcast = nil
+	b, err = json.Marshal([]*GroupAcknowledgement{older})
+	require.NoError(t, err)
+	require.NoError(t, acks.Merge(b))
+	require.Nil(t, broadcast)
+	ack, ok := acks.get("group", now)
+	require.True(t, ok)
+	require.Equal(t, "newer", ack.By)
+
+	require.Equal(t, 1, acks.gc(now))
+	state, err := acks.MarshalBinary()
+	require.NoError(t, err)
+	var entries []*GroupAcknowledgement
+	require.NoError(t, json.Unmarshal(state, &entries))
+	require.Len(t, entries, 1)
+	require.Equal(t, "group", entries[0].GroupKey)
+
+	require.Error(t, acks.Merge([]byte("invalid")))
+}
+
+func TestAcknowledgeGroup(t *testing.T) {
+	am, err := NewGrafanaAlertmanager("org", 1, &GrafanaAlertmanagerConfig{
+		Silences: newFakeMaintanenceOptions(t),
+		Nflog:    newFakeMaintanenceOptions(t),
+	}, &NilPeer{}, log.NewNopLogger(), NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry()))
+	require.NoError(t, err)
+	t.Cleanup(am.StopAndWait)
+
+	n := &fakeNotifier{}
+	groupWait, groupInterval, repeatInterval := model.Duration(time.Millisecond), model.Duration(10*time.Millisecond), model.Duration(20*time.Millisecond)
+	require.NoError(t, am.ApplyConfig(newFakeConfig(t, &Route{
+		Receiver:       "recv",
+		GroupWait:      &groupWait,
+		GroupInterval:  &groupInterval,
+		RepeatInterval: &repeatInterval,
+	}, map[string][]*Integration{
+		"recv": {NewIntegration(n, n, "webhook", 0)},
+	})))
+
+	putAlert := func(name string) {
+		require.NoError(t, am.PutAlerts(amv2.PostableAlerts{{
+			Alert:    amv2.Alert{Labels: amv2.LabelSet{"alertname": name}},
+			StartsAt: strfmt.DateTime(time.Now()),
+		}}))
+	}
+	putAlert("a")
+	require.Eventually(t, func() bool {
+		return len(n.notifications()) >= 2
+	}, 5*time.Second, 10*time.Millisecond, "the notification is repeated")
+
+	groups, err := am.GetAlertGroupsWithState(true, true, true, nil, "")
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	require.Equal(t, "{}:{}", groups[0].GroupKey)
+	require.Nil(t, groups[0].Acknowledgement)
+
+	_, err = am.AcknowledgeGroup("unknown", "admin", "", time.Now().Add(time.Hour))
+	require.ErrorIs(t, err, ErrAlertGroupNotFound)
+	_, err = am.AcknowledgeGroup("{}:{}", "admin", "", time.Now().Add(-time.Hour))
+	require.ErrorIs(t, err, ErrInvalidAcknowledgement)
+
+	ack, err := am.AcknowledgeGroup("{}:{}", "admin", "looking into it", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, ack.Alerts, 1)
+	groups, err = am.GetAlertGroupsWithState(true, true, true, nil, "")
+	require.NoError(t, err)
+	require.Equal(t, ack, groups[0].Acknowledgement)
+
+	// Wait for a notification in flight, if any, then the repeat notifications stop.
+	time.Sleep(50 * time.Millisecond)
+	sent := len(n.notifications())
+	require.Never(t, func() bool {
+		return len(n.notifications()) != sent
+	}, 200*time.Millisecond, 10*time.Millisecond)
+
+	// A new alert in the group ends the acknowledgement.
+	putAlert("b")
+	require.Eventually(t, func() bool {
+		return len(n.notifications()) > sent
+	}, 5*time.Second, 10*time.Millisecond)
+	groups, err = am.GetAlertGroupsWithState(true, true, true, nil, "")
+	require.NoError(t, err)
+	require.Nil(t, groups[0].Acknowledgement)
+}
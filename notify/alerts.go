@@ -11,6 +11,7 @@ import (
 	amv2 "github.com/prometheus/alertmanager/api/v2/models"
 	"github.com/prometheus/alertmanager/dispatch"
 	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/provider/mem"
 	"github.com/prometheus/alertmanager/types"
 	prometheus_model "github.com/prometheus/common/model"
 )
@@ -26,6 +27,18 @@ type GettableAlerts = amv2.GettableAlerts
 type GettableAlert = amv2.GettableAlert
 type AlertGroups = amv2.AlertGroups
 type AlertGroup = amv2.AlertGroup
+type AlertGroupsWithState []*AlertGroupWithState
+
+// AlertGroupWithState is an aggregation group of alerts, along with the state of its notifications.
+type AlertGroupWithState struct {
+	amv2.AlertGroup
+
+	GroupKey string `json:"groupKey"`
+	// Acknowledgement is the active acknowledgement of the group, if any.
+	Acknowledgement *GroupAcknowledgement `json:"acknowledgement,omitempty"`
+	// Escalation is the escalation of the group, if its receiver is an escalation policy.
+	Escalation *EscalationStatus `json:"escalation,omitempty"`
+}
 type Receiver = amv2.Receiver
 type PostableAlerts = amv2.PostableAlerts
 type PostableAlert = amv2.PostableAlert
@@ -97,6 +110,19 @@ func (am *GrafanaAlertmanager) GetAlerts(active, silenced, inhibited bool, filte
 }
 
 func (am *GrafanaAlertmanager) GetAlertGroups(active, silenced, inhibited bool, filter []string, receivers string) (AlertGroups, error) {
+	groups, err := am.GetAlertGroupsWithState(active, silenced, inhibited, filter, receivers)
+	if err != nil {
+		return nil, err
+	}
+	res := make(AlertGroups, 0, len(groups))
+	for _, g := range groups {
+		res = append(res, &g.AlertGroup)
+	}
+	return res, nil
+}
+
+// GetAlertGroupsWithState is like GetAlertGroups, and returns the key, acknowledgement and escalation of the groups.
+func (am *GrafanaAlertmanager) GetAlertGroupsWithState(active, silenced, inhibited bool, filter []string, receivers string) (AlertGroupsWithState, error) {
 	matchers, err := parseFilter(filter)
 	if err != nil {
 		level.Error(am.logger).Log("msg", "failed to parse matchers", "err", err)
@@ -119,29 +145,46 @@ func (am *GrafanaAlertmanager) GetAlertGroups(active, silenced, inhibited bool,
 		}
 	}(receiverFilter)
 
+	am.reloadConfigMtx.RLock()
+	defer am.reloadConfigMtx.RUnlock()
+
 	af := am.alertFilter(matchers, silenced, inhibited, active)
 	alertGroups, allReceivers := am.dispatcher.Groups(rf, af)
 
-	res := make(AlertGroups, 0, len(alertGroups))
+	res := make(AlertGroupsWithState, 0, len(alertGroups))
+	now := time.Now()
 
 	for _, alertGroup := range alertGroups {
-		ag := &AlertGroup{
+		res = append(res, am.toAlertGroup(alertGroup, allReceivers, now))
+	}
+
+	return res, nil
+}
+
+// toAlertGroup returns the API representation of the aggregation group, along with the state of its notifications.
+// The caller must hold reloadConfigMtx.
+func (am *GrafanaAlertmanager) toAlertGroup(alertGroup *dispatch.AlertGroup, allReceivers map[prometheus_model.Fingerprint][]string, now time.Time) *AlertGroupWithState {
+	ag := &AlertGroupWithState{
+		AlertGroup: amv2.AlertGroup{
 			Receiver: &Receiver{Name: &alertGroup.Receiver},
 			Labels:   v2.ModelLabelSetToAPILabelSet(alertGroup.Labels),
 			Alerts:   make([]*GettableAlert, 0, len(alertGroup.Alerts)),
-		}
-
-		for _, alert := range alertGroup.Alerts {
-			fp := alert.Fingerprint()
-			receivers := allReceivers[fp]
-			status := am.marker.Status(fp)
-			apiAlert := v2.AlertToOpenAPIAlert(alert, status, receivers)
-			ag.Alerts = append(ag.Alerts, apiAlert)
-		}
-		res = append(res, ag)
+		},
+		GroupKey: am.groupKey(alertGroup),
 	}
-
-	return res, nil
+	if ack, ok := am.acknowledgements.get(ag.GroupKey, now); ok {
+		ag.Acknowledgement = ack
+	}
+	ag.Escalation = am.escalationStatus(alertGroup.Receiver, ag.GroupKey, ag.Acknowledgement != nil)
+
+	for _, alert := range alertGroup.Alerts {
+		fp := alert.Fingerprint()
+		receivers := allReceivers[fp]
+		status := am.marker.Status(fp)
+		apiAlert := v2.AlertToOpenAPIAlert(alert, status, receivers)
+		ag.Alerts = append(ag.Alerts, apiAlert)
+	}
+	return ag
 }
 
 func (am *GrafanaAlertmanager) alertFilter(matchers []*labels.Matcher, silenced, inhibited, active bool) func(a *types.Alert, now time.Time) bool {
@@ -156,21 +199,28 @@ func (am *GrafanaAlertmanager) alertFilter(matchers []*labels.Matcher, silenced,
 
 		// Get alert's current status after seeing if it is suppressed.
 		status := am.marker.Status(a.Fingerprint())
-
-		if !active && status.State == types.AlertStateActive {
+		if !statusMatchesFilter(status, silenced, inhibited, active) {
 			return false
 		}
 
-		if !silenced && len(status.SilencedBy) != 0 {
-			return false
-		}
+		return alertMatchesFilterLabels(&a.Alert, matchers)
+	}
+}
 
-		if !inhibited && len(status.InhibitedBy) != 0 {
-			return false
-		}
+func statusMatchesFilter(status types.AlertStatus, silenced, inhibited, active bool) bool {
+	if !active && status.State == types.AlertStateActive {
+		return false
+	}
 
-		return alertMatchesFilterLabels(&a.Alert, matchers)
+	if !silenced && len(status.SilencedBy) != 0 {
+		return false
+	}
+
+	if !inhibited && len(status.InhibitedBy) != 0 {
+		return false
 	}
+
+	return true
 }
 
 func alertMatchesFilterLabels(a *prometheus_model.Alert, matchers []*labels.Matcher) bool {
@@ -235,3 +285,36 @@ func receiversMatchFilter(receivers []string, filter *regexp.Regexp) bool {
 
 	return false
 }
+
+// alertStoreCallback follows the alerts of the store for the Alertmanager, then calls the callback of the host, if
+// any.
+type alertStoreCallback struct {
+	am   *GrafanaAlertmanager
+	next mem.AlertStoreCallback
+}
+
+func (c alertStoreCallback) PreStore(alert *types.Alert, existing bool) error {
+	if c.next == nil {
+		return nil
+	}
+	return c.next.PreStore(alert, existing)
+}
+
+func (c alertStoreCallback) PostStore(alert *types.Alert, existing bool) {
+	c.am.receipts.stored(alert)
+	c.am.activeAlerts.stored(alert)
+	if c.next != nil {
+		c.next.PostStore(alert, existing)
+	}
+}
+
+func (c alertStoreCallback) PostDelete(alert *types.Alert) {
+	c.am.receipts.deleted(alert)
+	c.am.activeAlerts.deleted(alert)
+	if c.am.history != nil {
+		c.am.history.expired(alert)
+	}
+	if c.next != nil {
+		c.next.PostDelete(alert)
+	}
+}
@@ -0,0 +1,220 @@
+package notify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+)
+
+// AuditAction is an action recorded in the audit event stream.
+type AuditAction string
+
+const (
+	AuditCreateSilence AuditAction = "create_silence"
+	AuditDeleteSilence AuditAction = "delete_silence"
+	AuditApplyConfig   AuditAction = "apply_config"
+	AuditTestReceivers AuditAction = "test_receivers"
+	AuditImportState   AuditAction = "import_state"
+)
+
+// Actor is who performed an audited action.
+type Actor struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+	// Metadata is any other information about the actor, for example the address of the request.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type actorKey struct{}
+
+// WithActor returns a context in which the actions of the Alertmanager are audited as performed by the actor.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set with WithActor, if any.
+func ActorFromContext(ctx context.Context) (Actor, bool) {
+	a, ok := ctx.Value(actorKey{}).(Actor)
+	return a, ok
+}
+
+// AuditEvent is a record of an action performed on the Alertmanager. Failed actions are recorded along with their
+// error.
+type AuditEvent struct {
+	Time     time.Time   `json:"time"`
+	TenantID int64       `json:"tenantId"`
+	Action   AuditAction `json:"action"`
+	Actor    *Actor      `json:"actor,omitempty"`
+	Error    string      `json:"error,omitempty"`
+
+	// SilenceID and Silence are set for silence actions. Silence is only set for creations.
+	SilenceID string           `json:"silenceId,omitempty"`
+	Silence   *PostableSilence `json:"silence,omitempty"`
+
+	// ConfigDiff is set for configuration changes.
+	ConfigDiff *ConfigDiff `json:"configDiff,omitempty"`
+
+	// Receivers and DryRun are set for receiver tests.
+	Receivers []string `json:"receivers,omitempty"`
+	DryRun    bool     `json:"dryRun,omitempty"`
+}
+
+// AuditSink receives the audit events of the Alertmanager. It is called synchronously by the audited actions and
+// must be safe to call concurrently.
+type AuditSink interface {
+	Audit(ctx context.Context, e AuditEvent) error
+}
+
+// ConfigDiff summarizes the changes of a configuration. Receivers and time intervals are listed by name.
+type ConfigDiff struct {
+	PreviousHash string `json:"previousHash,omitempty"`
+	Hash         string `json:"hash"`
+
+	ReceiversAdded   []string `json:"receiversAdded,omitempty"`
+	ReceiversRemoved []string `json:"receiversRemoved,omitempty"`
+	ReceiversChanged []string `json:"receiversChanged,omitempty"`
+
+	TimeIntervalsAdded   []string `json:"timeIntervalsAdded,omitempty"`
+	TimeIntervalsRemoved []string `json:"timeIntervalsRemoved,omitempty"`
+	TimeIntervalsChanged []string `json:"timeIntervalsChanged,omitempty"`
+
+	RoutesChanged       bool `json:"routesChanged,omitempty"`
+	InhibitRulesChanged bool `json:"inhibitRulesChanged,omitempty"`
+}
+
+// configSummary holds the digests of the parts of a configuration, to compare it with the next one without keeping
+// it, and its secrets, around.
+type configSummary struct {
+	hash          [16]byte
+	receivers     map[string][32]byte
+	timeIntervals map[string][32]byte
+	routes        [32]byte
+	inhibitRules  [32]byte
+}
+
+func digest(v interface{}) [32]byte {
+	// The parts of the configuration are all encodable, a failure only makes them look changed.
+	b, _ := json.Marshal(v)
+	return sha256.Sum256(b)
+}
+
+func newConfigSummary(cfg Configuration) *configSummary {
+	s := &configSummary{
+		hash:          cfg.Hash(),
+		receivers:     map[string][32]byte{},
+		timeIntervals: map[string][32]byte{},
+		routes:        digest(cfg.RoutingTree()),
+		inhibitRules:  digest(cfg.InhibitRules()),
+	}
+	for _, r := range cfg.Receivers() {
+		s.receivers[r.Name] = digest(r)
+	}
+	for _, ti := range cfg.MuteTimeIntervals() {
+		s.timeIntervals[ti.Name] = digest(ti)
+	}
+	return s
+}
+
+// diff returns the changes from the previous configuration, which is nil for the first one.
+func (s *configSummary) diff(prev *configSummary) *ConfigDiff {
+	d := &ConfigDiff{Hash: fmt.Sprintf("%x", s.hash)}
+	if prev == nil {
+		d.ReceiversAdded = sortedKeys(s.receivers)
+		d.TimeIntervalsAdded = sortedKeys(s.timeIntervals)
+		return d
+	}
+	d.PreviousHash = fmt.Sprintf("%x", prev.hash)
+	d.ReceiversAdded, d.ReceiversRemoved, d.ReceiversChanged = diffDigests(prev.receivers, s.receivers)
+	d.TimeIntervalsAdded, d.TimeIntervalsRemoved, d.TimeIntervalsChanged = diffDigests(prev.timeIntervals, s.timeIntervals)
+	d.RoutesChanged = prev.routes != s.routes
+	d.InhibitRulesChanged = prev.inhibitRules != s.inhibitRules
+	return d
+}
+
+func diffDigests(prev, next map[string][32]byte) (added, removed, changed []string) {
+	for name, d := range next {
+		p, ok := prev[name]
+		if !ok {
+			added = append(added, name)
+		} else if p != d {
+			changed = append(changed, name)
+		}
+	}
+	for name := range prev {
+		if _, ok := next[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+func sortedKeys(m map[string][32]byte) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// audit sends the event to the audit sink, if any, with the actor of the context and the error of the action.
+func (am *GrafanaAlertmanager) audit(ctx context.Context, e AuditEvent, err error) {
+	if am.auditSink == nil {
+		return
+	}
+	e.Time = time.Now()
+	e.TenantID = am.tenantID
+	if actor, ok := ActorFromContext(ctx); ok {
+		e.Actor = &actor
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if err := am.auditSink.Audit(ctx, e); err != nil {
+		level.Error(am.logger).Log("msg", "failed to record audit event", "action", e.Action, "err", err)
+	}
+}
+
+// FileAuditSink is an AuditSink that appends the events to a file, one JSON object per line.
+type FileAuditSink struct {
+	mtx  sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewFileAuditSink opens the file at path for appending, creating it if needed.
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	f, err := os.OpenFile(filepath.Clean(path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	return &FileAuditSink{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Audit implements the AuditSink interface.
+func (s *FileAuditSink) Audit(_ context.Context, e AuditEvent) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.enc.Encode(e)
+}
+
+// Close closes the file.
+func (s *FileAuditSink) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingAuditSink records the events it receives.
+type recordingAuditSink struct {
+	mtx    sync.Mutex
+	events []AuditEvent
+}
+
+func (s *recordingAuditSink) Audit(_ context.Context, e AuditEvent) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *recordingAuditSink) last() AuditEvent {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.events[len(s.events)-1]
+}
+
+func TestConfigSummaryDiff(t *testing.T) {
+	cfg := newFakeConfig(t, &Route{Receiver: "a"}, nil)
+	cfg.receivers = []*APIReceiver{
+		{ConfigReceiver: ConfigReceiver{Name: "a"}},
+		{ConfigReceiver: ConfigReceiver{Name: "b"}, GrafanaReceivers: GrafanaReceivers{Receivers: []*GrafanaReceiver{{Type: "email"}}}},
+	}
+	cfg.muteTimeIntervals = []MuteTimeInterval{{Name: "weekends"}}
+	first := newConfigSummary(cfg)
+
+	d := first.diff(nil)
+	require.Equal(t, []string{"a", "b"}, d.ReceiversAdded)
+	require.Equal(t, []string{"weekends"}, d.TimeIntervalsAdded)
+	require.Empty(t, d.PreviousHash)
+
+	next := newFakeConfig(t, &Route{Receiver: "c"}, nil)
+	next.receivers = []*APIReceiver{
+		{ConfigReceiver: ConfigReceiver{Name: "b"}, GrafanaReceivers: GrafanaReceivers{Receivers: []*GrafanaReceiver{{Type: "slack"}}}},
+		{ConfigReceiver: ConfigReceiver{Name: "c"}},
+	}
+	next.muteTimeIntervals = []MuteTimeInterval{{Name: "weekends"}}
+	next.inhibitRules = []InhibitRule{{Equal: model.LabelNames{"cluster"}}}
+
+	d = newConfigSummary(next).diff(first)
+	require.Equal(t, &ConfigDiff{
+		PreviousHash:        "00000000000000000000000000000000",
+		Hash:                "00000000000000000000000000000000",
+		ReceiversAdded:      []string{"c"},
+		ReceiversRemoved:    []string{"a"},
+		ReceiversChanged:    []string{"b"},
+		RoutesChanged:       true,
+		InhibitRulesChanged: true,
+	}, d)
+}
+
+func TestAudit(t *testing.T) {
+	sink := &recordingAuditSink{}
+	am, err := NewGrafanaAlertmanager("org", 1, &GrafanaAlertmanagerConfig{
+		Silences:  newFakeMaintanenceOptions(t),
+		Nflog:     newFakeMaintanenceOptions(t),
+		AuditSink: sink,
+	}, &NilPeer{}, log.NewNopLogger(), NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry()))
+	require.NoError(t, err)
+
+	actor := Actor{ID: "1", Name: "admin", Metadata: map[string]string{"ip": "127.0.0.1"}}
+	ctx := WithActor(context.Background(), actor)
+
+	cfg := newFakeConfig(t, &Route{Receiver: "recv"}, nil)
+	cfg.receivers = []*APIReceiver{{ConfigReceiver: ConfigReceiver{Name: "recv"}}}
+	require.NoError(t, am.ApplyConfigWithContext(ctx, cfg))
+	e := sink.last()
+	require.Equal(t, AuditApplyConfig, e.Action)
+	require.Equal(t, int64(1), e.TenantID)
+	require.Equal(t, &actor, e.Actor)
+	require.Equal(t, []string{"recv"}, e.ConfigDiff.ReceiversAdded)
+
+	cfg.route = &Route{Receiver: "recv", MuteTimeIntervals: []string{"missing"}}
+	require.Error(t, am.ApplyConfigWithContext(ctx, cfg))
+	e = sink.last()
+	require.Equal(t, `undefined time interval "missing" used in route`, e.Error)
+	require.True(t, e.ConfigDiff.RoutesChanged)
+
+	startsAt, endsAt := strfmt.DateTime(time.Now()), strfmt.DateTime(time.Now().Add(time.Hour))
+	matcherName, matcherValue, isRegex := "alertname", "test", false
+	silenceID, err := am.CreateSilenceWithContext(ctx, &PostableSilence{Silence: amv2.Silence{
+		Comment:   new(string),
+		CreatedBy: &actor.Name,
+		StartsAt:  &startsAt,
+		EndsAt:    &endsAt,
+		Matchers:  amv2.Matchers{{Name: &matcherName, Value: &matcherValue, IsRegex: &isRegex}},
+	}})
+	require.NoError(t, err)
+	e = sink.last()
+	require.Equal(t, AuditCreateSilence, e.Action)
+	require.Equal(t, silenceID, e.SilenceID)
+	require.Equal(t, &actor, e.Actor)
+	require.NotNil(t, e.Silence)
+
+	require.NoError(t, am.DeleteSilence(silenceID))
+	e = sink.last()
+	require.Equal(t, AuditDeleteSilence, e.Action)
+	require.Equal(t, silenceID, e.SilenceID)
+	require.Nil(t, e.Actor)
+
+	require.ErrorIs(t, am.DeleteSilenceWithContext(ctx, "unknown"), ErrSilenceNotFound)
+	require.Equal(t, ErrSilenceNotFound.Error(), sink.last().Error)
+
+	_, err = am.TestReceivers(ctx, TestReceiversConfigBodyParams{DryRun: true})
+	require.ErrorIs(t, err, ErrNoReceivers)
+	e = sink.last()
+	require.Equal(t, AuditTestReceivers, e.Action)
+	require.True(t, e.DryRun)
+	require.Equal(t, ErrNoReceivers.Error(), e.Error)
+	require.Len(t, sink.events, 6)
+}
+
+func TestFileAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileAuditSink(path)
+		require.NoError(t, err)
+		require.NoError(t, sink.Audit(context.Background(), AuditEvent{
+			Action:    AuditDeleteSilence,
+			SilenceID: "id",
+			Actor:     &Actor{Name: "admin"},
+		}))
+		require.NoError(t, sink.Close())
+	}
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e AuditEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		require.Equal(t, AuditDeleteSilence, e.Action)
+		require.Equal(t, "admin", e.Actor.Name)
+		lines++
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, 2, lines)
+}
@@ -0,0 +1,264 @@
+package notify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/alertmanager/nflog/nflogpb"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+var (
+	ErrFailedNotificationNotFound = errors.New("failed notification not found")
+	ErrDeadLettersDisabled        = errors.New("the dead-letter store is not enabled")
+)
+
+// FailedNotification is a notification that could not be delivered by an integration once all of its retries
+// failed. There is at most one FailedNotification per aggregation group and integration, holding the last failure.
+type FailedNotification struct {
+	ID string `json:"id"`
+
+	GroupKey       string         `json:"groupKey"`
+	GroupLabels    model.LabelSet `json:"groupLabels"`
+	Receiver       string         `json:"receiver"`
+	Integration    string         `json:"integration"`
+	Index          int            `json:"index"`
+	Alerts         []*types.Alert `json:"alerts"`
+	RepeatInterval time.Duration  `json:"repeatInterval"`
+
+	// FiringAlerts and ResolvedAlerts are the hashes used by the notification log to deduplicate the notification.
+	FiringAlerts   []uint64 `json:"firingAlerts,omitempty"`
+	ResolvedAlerts []uint64 `json:"resolvedAlerts,omitempty"`
+
+	LastError string    `json:"lastError"`
+	Failures  int       `json:"failures"`
+	FailedAt  time.Time `json:"failedAt"`
+}
+
+func failedNotificationID(groupKey string, recv *nflogpb.Receiver) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s\xff%s\xff%s\xff%d", groupKey, recv.GroupName, recv.Integration, recv.Idx)))
+	return hex.EncodeToString(h[:8])
+}
+
+// deadLetters stores the failed notifications.
+type deadLetters struct {
+	retention time.Duration
+
+	mtx     sync.RWMutex
+	entries map[string]*FailedNotification
+}
+
+func newDeadLetters(snapshotFile string, retention time.Duration) (*deadLetters, error) {
+	d := &deadLetters{
+		retention: retention,
+		entries:   make(map[string]*FailedNotification),
+	}
+	if snapshotFile == "" {
+		return d, nil
+	}
+
+	b, err := os.ReadFile(filepath.Clean(snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*FailedNotification
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode the dead-letter snapshot: %w", err)
+	}
+	for _, e := range entries {
+		d.entries[e.ID] = e
+	}
+	return d, nil
+}
+
+// MarshalBinary implements the State interface.
+func (d *deadLetters) MarshalBinary() ([]byte, error) {
+	return json.Marshal(d.list())
+}
+
+func (d *deadLetters) add(e *FailedNotification) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if prev, ok := d.entries[e.ID]; ok {
+		e.Failures += prev.Failures
+	}
+	d.entries[e.ID] = e
+}
+
+func (d *deadLetters) get(id string) (*FailedNotification, bool) {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+
+	e, ok := d.entries[id]
+	return e, ok
+}
+
+func (d *deadLetters) delete(id string) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	delete(d.entries, id)
+}
+
+// list returns the failed notifications, the most recent first.
+func (d *deadLetters) list() []FailedNotification {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+
+	res := make([]FailedNotification, 0, len(d.entries))
+	for _, e := range d.entries {
+		res = append(res, *e)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].FailedAt.Equal(res[j].FailedAt) {
+			return res[i].FailedAt.After(res[j].FailedAt)
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// gc removes the failed notifications older than the retention and returns how many were removed. They are kept
+// forever if there is no retention.
+func (d *deadLetters) gc(now time.Time) int {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	n := 0
+	if d.retention <= 0 {
+		return n
+	}
+	for id, e := range d.entries {
+		if e.FailedAt.Add(d.retention).Before(now) {
+			delete(d.entries, id)
+			n++
+		}
+	}
+	return n
+}
+
+// deadLetterStage records the notifications that its inner stage fails to send, and forgets them once a
+// notification of the same aggregation group is sent successfully.
+type deadLetterStage struct {
+	next  notify.Stage
+	store *deadLetters
+	recv  *nflogpb.Receiver
+}
+
+// Exec implements the Stage interface.
+func (s *deadLetterStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	ctx, res, err := s.next.Exec(ctx, l, alerts...)
+
+	gkey, ok := notify.GroupKey(ctx)
+	if !ok {
+		return ctx, res, err
+	}
+	id := failedNotificationID(gkey, s.recv)
+	if err == nil {
+		s.store.delete(id)
+		return ctx, res, nil
+	}
+
+	e := &FailedNotification{
+		ID:          id,
+		GroupKey:    gkey,
+		Receiver:    s.recv.GroupName,
+		Integration: s.recv.Integration,
+		Index:       int(s.recv.Idx),
+		Alerts:      alerts,
+		LastError:   err.Error(),
+		Failures:    1,
+		FailedAt:    time.Now(),
+	}
+	e.GroupLabels, _ = notify.GroupLabels(ctx)
+	e.RepeatInterval, _ = notify.RepeatInterval(ctx)
+	e.FiringAlerts, _ = notify.FiringAlerts(ctx)
+	e.ResolvedAlerts, _ = notify.ResolvedAlerts(ctx)
+	s.store.add(e)
+	level.Debug(l).Log("msg", "recorded failed notification", "id", id, "receiver", e.Receiver, "integration", e.Integration)
+
+	return ctx, res, err
+}
+
+// ListFailedNotifications returns the notifications that could not be delivered, the most recent first.
+func (am *GrafanaAlertmanager) ListFailedNotifications() []FailedNotification {
+	if am.deadLetters == nil {
+		return []FailedNotification{}
+	}
+	return am.deadLetters.list()
+}
+
+// ReplayFailedNotification sends a failed notification again through its integration in the current configuration.
+// It is attempted once: on success the notification is recorded in the notification log and removed from the
+// dead-letter store, otherwise it is kept with the new error.
+func (am *GrafanaAlertmanager) ReplayFailedNotification(ctx context.Context, id string) error {
+	if am.deadLetters == nil {
+		return ErrDeadLettersDisabled
+	}
+	e, ok := am.deadLetters.get(id)
+	if !ok {
+		return ErrFailedNotificationNotFound
+	}
+
+	integration, err := am.findIntegration(e.Receiver, e.Integration, e.Index)
+	if err != nil {
+		return err
+	}
+
+	ctx = notify.WithGroupKey(ctx, e.GroupKey)
+	ctx = notify.WithGroupLabels(ctx, e.GroupLabels)
+	ctx = notify.WithReceiverName(ctx, e.Receiver)
+	ctx = notify.WithRepeatInterval(ctx, e.RepeatInterval)
+	ctx = notify.WithNow(ctx, time.Now())
+
+	start := time.Now()
+	_, err = integration.Notify(ctx, e.Alerts...)
+	integration.Report(start, model.Duration(time.Since(start)), err)
+	if err != nil {
+		failed := *e
+		failed.LastError = err.Error()
+		failed.Failures = 1
+		failed.FailedAt = time.Now()
+		am.deadLetters.add(&failed)
+		return fmt.Errorf("failed to replay notification: %w", err)
+	}
+
+	recv := &nflogpb.Receiver{GroupName: e.Receiver, Integration: e.Integration, Idx: uint32(e.Index)}
+	if err := am.notificationLog.Log(recv, e.GroupKey, e.FiringAlerts, e.ResolvedAlerts, 2*e.RepeatInterval); err != nil {
+		level.Warn(am.logger).Log("msg", "failed to record replayed notification in the notification log", "id", id, "err", err)
+	}
+	am.deadLetters.delete(id)
+	return nil
+}
+
+// findIntegration returns the integration of the current configuration with the given receiver, name and index.
+func (am *GrafanaAlertmanager) findIntegration(receiver, name string, idx int) (*notify.Integration, error) {
+	for _, r := range am.GetReceivers() {
+		if r.Name() != receiver {
+			continue
+		}
+		for _, i := range r.Integrations() {
+			if i.Name() == name && i.Index() == idx {
+				return i, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("integration %s[%d] of receiver %q is not in the current configuration", name, idx, receiver)
+}
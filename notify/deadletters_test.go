@@ -0,0 +1,145 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/alertmanager/nflog"
+	"github.com/prometheus/alertmanager/nflog/nflogpb"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetters(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	d, err := newDeadLetters("", time.Hour)
+	require.NoError(t, err)
+
+	d.add(&FailedNotification{ID: "old", Receiver: "recv", Failures: 1, FailedAt: now.Add(-2 * time.Hour)})
+	d.add(&FailedNotification{ID: "new", Receiver: "recv", Failures: 1, FailedAt: now})
+	d.add(&FailedNotification{ID: "new", Receiver: "recv", Failures: 1, FailedAt: now})
+
+	list := d.list()
+	require.Len(t, list, 2)
+	require.Equal(t, "new", list[0].ID)
+	require.Equal(t, 2, list[0].Failures)
+
+	// The snapshot is loaded back on start.
+	b, err := d.MarshalBinary()
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "deadletters")
+	require.NoError(t, os.WriteFile(file, b, 0600))
+	loaded, err := newDeadLetters(file, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, list, loaded.list())
+
+	require.Equal(t, 1, loaded.gc(now))
+	require.Len(t, loaded.list(), 1)
+}
+
+func TestDeadLetterStage(t *testing.T) {
+	d, err := newDeadLetters("", time.Hour)
+	require.NoError(t, err)
+	recv := &nflogpb.Receiver{GroupName: "recv", Integration: "webhook", Idx: 1}
+	alerts := []*types.Alert{{Alert: model.Alert{Labels: model.LabelSet{"alertname": "test"}}}}
+
+	var sendErr error
+	s := &deadLetterStage{
+		next: notify.StageFunc(func(ctx context.Context, _ log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+			if sendErr != nil {
+				return ctx, nil, sendErr
+			}
+			return ctx, alerts, nil
+		}),
+		store: d,
+		recv:  recv,
+	}
+
+	ctx := notify.WithGroupKey(context.Background(), "{}:{alertname=\"test\"}")
+	ctx = notify.WithGroupLabels(ctx, model.LabelSet{"alertname": "test"})
+	ctx = notify.WithRepeatInterval(ctx, time.Hour)
+	ctx = notify.WithFiringAlerts(ctx, []uint64{1})
+	ctx = notify.WithResolvedAlerts(ctx, []uint64{})
+
+	sendErr = errors.New("unavailable")
+	for i := 0; i < 2; i++ {
+		_, _, err = s.Exec(ctx, log.NewNopLogger(), alerts...)
+		require.ErrorIs(t, err, sendErr)
+	}
+
+	list := d.list()
+	require.Len(t, list, 1)
+	require.Equal(t, failedNotificationID("{}:{alertname=\"test\"}", recv), list[0].ID)
+	require.Equal(t, "recv", list[0].Receiver)
+	require.Equal(t, "webhook", list[0].Integration)
+	require.Equal(t, 1, list[0].Index)
+	require.Equal(t, model.LabelSet{"alertname": "test"}, list[0].GroupLabels)
+	require.Equal(t, alerts, list[0].Alerts)
+	require.Equal(t, time.Hour, list[0].RepeatInterval)
+	require.Equal(t, []uint64{1}, list[0].FiringAlerts)
+	require.Equal(t, "unavailable", list[0].LastError)
+	require.Equal(t, 2, list[0].Failures)
+
+	// A successful notification of the same group means the failure is obsolete.
+	sendErr = nil
+	_, _, err = s.Exec(ctx, log.NewNopLogger(), alerts...)
+	require.NoError(t, err)
+	require.Empty(t, d.list())
+}
+
+func TestReplayFailedNotification(t *testing.T) {
+	am := setupAMTest(t)
+	require.Equal(t, []FailedNotification{}, am.ListFailedNotifications())
+	require.ErrorIs(t, am.ReplayFailedNotification(context.Background(), "id"), ErrDeadLettersDisabled)
+
+	var err error
+	am.deadLetters, err = newDeadLetters("", time.Hour)
+	require.NoError(t, err)
+
+	n := &fakeNotifier{err: errors.New("unavailable")}
+	require.NoError(t, am.ApplyConfig(newFakeConfig(t, &Route{Receiver: "recv"}, map[string][]*Integration{
+		"recv": {NewIntegration(n, n, "webhook", 0)},
+	})))
+
+	alerts := []*types.Alert{{Alert: model.Alert{Labels: model.LabelSet{"alertname": "test"}, StartsAt: time.Now()}}}
+	recv := &nflogpb.Receiver{GroupName: "recv", Integration: "webhook"}
+	id := failedNotificationID("group", recv)
+	am.deadLetters.add(&FailedNotification{
+		ID:             id,
+		GroupKey:       "group",
+		Receiver:       "recv",
+		Integration:    "webhook",
+		Alerts:         alerts,
+		RepeatInterval: time.Hour,
+		FiringAlerts:   []uint64{1},
+		LastError:      "unavailable",
+		Failures:       1,
+		FailedAt:       time.Now(),
+	})
+
+	require.ErrorIs(t, am.ReplayFailedNotification(context.Background(), "unknown"), ErrFailedNotificationNotFound)
+
+	// A failed replay keeps the notification.
+	require.EqualError(t, am.ReplayFailedNotification(context.Background(), id), "failed to replay notification: unavailable")
+	require.Len(t, am.ListFailedNotifications(), 1)
+	require.Equal(t, 2, am.ListFailedNotifications()[0].Failures)
+
+	n.err = nil
+	require.NoError(t, am.ReplayFailedNotification(context.Background(), id))
+	require.Empty(t, am.ListFailedNotifications())
+	require.Len(t, n.notifications(), 2)
+	require.Equal(t, alerts, n.notifications()[1])
+
+	// The replayed notification is logged so that it is not sent again.
+	entries, err := am.notificationLog.Query(nflog.QReceiver(recv), nflog.QGroupKey("group"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, []uint64{1}, entries[0].FiringAlerts)
+}
@@ -0,0 +1,408 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/alerting/templates"
+)
+
+const (
+	// DigestAlertName is the alertname of the digests of the notifications of a receiver.
+	DigestAlertName = "NotificationDigest"
+	// DigestTemplate is the template that renders the description of a digest.
+	DigestTemplate = "default.digest"
+
+	digestSendTimeout = time.Minute
+)
+
+// Digest batches the notifications of a receiver into periodic summaries: instead of being sent, its notifications
+// are collected and a single digest of their alerts is sent on the schedule, either every Interval or every day At a
+// time of day. The notifications collected are recorded in the notification log as if they were sent.
+type Digest struct {
+	// Interval sends a digest at every multiple of the interval, e.g. every hour on the hour.
+	Interval model.Duration `yaml:"interval,omitempty" json:"interval,omitempty"`
+	// At sends a digest every day at the time of day, as "15:04", in the timezone.
+	At string `yaml:"at,omitempty" json:"at,omitempty"`
+	// Timezone is the timezone of At, UTC by default.
+	Timezone string `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+}
+
+func (d Digest) Validate() error {
+	if (d.Interval == 0) == (d.At == "") {
+		return errors.New("exactly one of interval and at must be set")
+	}
+	if d.Interval < 0 {
+		return errors.New("interval must be greater than zero")
+	}
+	if d.Timezone != "" && d.At == "" {
+		return errors.New("timezone requires at")
+	}
+	_, err := d.schedule()
+	return err
+}
+
+// digestSchedule is a validated digest schedule.
+type digestSchedule struct {
+	interval     time.Duration
+	hour, minute int
+	location     *time.Location
+}
+
+func (d Digest) schedule() (digestSchedule, error) {
+	s := digestSchedule{interval: time.Duration(d.Interval), location: time.UTC}
+	if d.At == "" {
+		return s, nil
+	}
+	at, err := time.Parse("15:04", d.At)
+	if err != nil {
+		return s, fmt.Errorf("invalid at %q: %w", d.At, err)
+	}
+	s.hour, s.minute = at.Hour(), at.Minute()
+	if d.Timezone != "" {
+		if s.location, err = time.LoadLocation(d.Timezone); err != nil {
+			return s, fmt.Errorf("invalid timezone %q: %w", d.Timezone, err)
+		}
+	}
+	return s, nil
+}
+
+// next returns the time of the first digest after now.
+func (s digestSchedule) next(now time.Time) time.Time {
+	if s.interval > 0 {
+		return now.Truncate(s.interval).Add(s.interval)
+	}
+	local := now.In(s.location)
+	y, m, d := local.Date()
+	next := time.Date(y, m, d, s.hour, s.minute, 0, 0, s.location)
+	if !next.After(now) {
+		next = time.Date(y, m, d+1, s.hour, s.minute, 0, 0, s.location)
+	}
+	return next
+}
+
+// digestEntry is the pending content of the digest of an integration.
+type digestEntry struct {
+	Receiver    string `json:"receiver"`
+	Integration string `json:"integration"`
+	// Notifications is the number of notifications collected since Since.
+	Notifications int       `json:"notifications"`
+	Since         time.Time `json:"since"`
+	// Alerts are the alerts of the notifications, in their latest state.
+	Alerts []*types.Alert `json:"alerts"`
+}
+
+func (e *digestEntry) add(alerts []*types.Alert) {
+	e.Notifications++
+	for _, a := range alerts {
+		replaced := false
+		for i, prev := range e.Alerts {
+			if prev.Fingerprint() == a.Fingerprint() {
+				e.Alerts[i] = a
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			e.Alerts = append(e.Alerts, a)
+		}
+	}
+}
+
+// digests stores the pending content of the digests, by receiver and integration. It is kept in memory and persisted
+// by the maintenance of the Alertmanager, if enabled, so that the content collected survives restarts. It is not
+// replicated: the content is collected by the peer that would have sent the notifications.
+type digests struct {
+	retention time.Duration
+
+	mtx     sync.Mutex
+	entries map[string]*digestEntry
+}
+
+func digestKey(receiver, integration string) string {
+	return receiver + "/" + integration
+}
+
+func newDigests(snapshotFile string, retention time.Duration) (*digests, error) {
+	d := &digests{
+		retention: retention,
+		entries:   make(map[string]*digestEntry),
+	}
+	if snapshotFile == "" {
+		return d, nil
+	}
+
+	b, err := os.ReadFile(filepath.Clean(snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*digestEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode the digests snapshot: %w", err)
+	}
+	for _, e := range entries {
+		d.entries[digestKey(e.Receiver, e.Integration)] = e
+	}
+	return d, nil
+}
+
+// MarshalBinary implements the State interface.
+func (d *digests) MarshalBinary() ([]byte, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	res := make([]*digestEntry, 0, len(d.entries))
+	for _, e := range d.entries {
+		res = append(res, e)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return digestKey(res[i].Receiver, res[i].Integration) < digestKey(res[j].Receiver, res[j].Integration)
+	})
+	return json.Marshal(res)
+}
+
+// add collects the alerts of a notification into the digest of the integration.
+func (d *digests) add(receiver, integration string, alerts []*types.Alert, now time.Time) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	k := digestKey(receiver, integration)
+	e, ok := d.entries[k]
+	if !ok {
+		e = &digestEntry{Receiver: receiver, Integration: integration, Since: now}
+		d.entries[k] = e
+	}
+	e.add(alerts)
+}
+
+// take removes and returns the pending content of the digest of the integration, if any.
+func (d *digests) take(receiver, integration string) (*digestEntry, bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	k := digestKey(receiver, integration)
+	e, ok := d.entries[k]
+	delete(d.entries, k)
+	return e, ok
+}
+
+// restore puts back content taken whose digest could not be sent, before the content collected since.
+func (d *digests) restore(e *digestEntry) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	k := digestKey(e.Receiver, e.Integration)
+	if newer, ok := d.entries[k]; ok {
+		n := e.Notifications + newer.Notifications
+		e.add(newer.Alerts)
+		e.Notifications = n
+	}
+	d.entries[k] = e
+}
+
+// retain removes the content of the digests of the integrations which are not in keys.
+func (d *digests) retain(keys map[string]struct{}) int {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	n := 0
+	for k := range d.entries {
+		if _, ok := keys[k]; !ok {
+			delete(d.entries, k)
+			n++
+		}
+	}
+	return n
+}
+
+// gc removes the content collected for longer than the retention, whose digest could not be sent, and returns how
+// many digests were removed.
+func (d *digests) gc(now time.Time) int {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	n := 0
+	for k, e := range d.entries {
+		if e.Since.Add(d.retention).Before(now) {
+			delete(d.entries, k)
+			n++
+		}
+	}
+	return n
+}
+
+// digester sends the digests of an integration on schedule, through the stage that sends its notifications.
+type digester struct {
+	integration *notify.Integration
+	groupName   string
+	next        notify.Stage
+	schedule    digestSchedule
+	store       *digests
+	template    func() (*template.Template, error)
+	metric      prometheus.Counter
+	logger      log.Logger
+	now         func() time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mtx   sync.Mutex
+	timer *time.Timer
+}
+
+func newDigester(i *notify.Integration, groupName string, next notify.Stage, schedule digestSchedule, store *digests, tmpl func() (*template.Template, error), metric prometheus.Counter, l log.Logger) *digester {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &digester{
+		integration: i,
+		groupName:   groupName,
+		next:        next,
+		schedule:    schedule,
+		store:       store,
+		template:    tmpl,
+		metric:      metric,
+		logger:      log.With(l, "receiver", groupName, "integration", i.String()),
+		now:         time.Now,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+func (d *digester) key() string {
+	return digestKey(d.groupName, d.integration.String())
+}
+
+// start schedules the next digest.
+func (d *digester) start() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if d.ctx.Err() == nil {
+		d.timer = time.AfterFunc(d.schedule.next(d.now()).Sub(d.now()), d.flush)
+	}
+}
+
+// collect adds the alerts of a notification to the pending digest.
+func (d *digester) collect(alerts []*types.Alert) {
+	d.metric.Inc()
+	d.store.add(d.groupName, d.integration.String(), alerts, d.now())
+}
+
+// flush sends the pending digest, if any, and schedules the next one. The content of a digest that fails to be sent
+// is sent with the next one.
+func (d *digester) flush() {
+	if d.ctx.Err() != nil {
+		return
+	}
+	if e, ok := d.store.take(d.groupName, d.integration.String()); ok {
+		if err := d.send(e); err != nil {
+			level.Warn(d.logger).Log("msg", "Failed to send the digest of notifications", "notifications", e.Notifications, "err", err)
+			d.store.restore(e)
+		}
+	}
+	d.start()
+}
+
+func (d *digester) send(e *digestEntry) error {
+	now := d.now()
+	labels := model.LabelSet{
+		model.AlertNameLabel: DigestAlertName,
+		"receiver":           model.LabelValue(d.groupName),
+	}
+
+	ctx, cancel := context.WithTimeout(d.ctx, digestSendTimeout)
+	defer cancel()
+	ctx = notify.WithGroupKey(ctx, "digest:"+d.key())
+	ctx = notify.WithGroupLabels(ctx, labels)
+	ctx = notify.WithReceiverName(ctx, d.groupName)
+	ctx = notify.WithRepeatInterval(ctx, 0)
+	ctx = notify.WithNow(ctx, now)
+
+	firing := 0
+	for _, a := range e.Alerts {
+		if !a.ResolvedAt(now) {
+			firing++
+		}
+	}
+	summary := fmt.Sprintf("%d notifications of %d alerts, %d firing, since %s", e.Notifications, len(e.Alerts), firing, e.Since.UTC().Format(time.RFC3339))
+	description, err := d.render(ctx, e.Alerts)
+	if err != nil {
+		level.Warn(d.logger).Log("msg", "Failed to render the digest template, sending the summary only", "template", DigestTemplate, "err", err)
+		description = summary
+	}
+
+	alert := &types.Alert{
+		Alert: model.Alert{
+			Labels: labels.Merge(model.LabelSet{"integration": model.LabelValue(d.integration.String())}),
+			Annotations: model.LabelSet{
+				"summary":     model.LabelValue(summary),
+				"description": model.LabelValue(description),
+			},
+			StartsAt: now,
+		},
+		UpdatedAt: now,
+	}
+
+	ctx = notify.WithFiringAlerts(ctx, []uint64{uint64(alert.Fingerprint())})
+	ctx = notify.WithResolvedAlerts(ctx, nil)
+
+	_, _, err = d.next.Exec(ctx, d.logger, alert)
+	return err
+}
+
+// render renders the digest template with the alerts of the digest.
+func (d *digester) render(ctx context.Context, alerts []*types.Alert) (string, error) {
+	tmpl, err := d.template()
+	if err != nil {
+		return "", err
+	}
+	data := templates.ExtendData(notify.GetTemplateData(ctx, tmpl, alerts, d.logger), &logAdapter{Logger: d.logger})
+	return tmpl.ExecuteTextString(fmt.Sprintf("{{ template %q . }}", DigestTemplate), data)
+}
+
+// stop cancels the next digest. The pending content is kept for the digester of the next configuration.
+func (d *digester) stop() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.cancel()
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+}
+
+// digestStage collects the notifications of an integration into its digest instead of sending them. They are
+// reported as sent so that the notification log records them and deduplication stays consistent.
+type digestStage struct {
+	digester *digester
+}
+
+// Exec implements the Stage interface.
+func (s *digestStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	if !s.digester.integration.SendResolved() {
+		if firing, ok := notify.FiringAlerts(ctx); ok && len(firing) == 0 {
+			return ctx, alerts, nil
+		}
+	}
+	s.digester.collect(alerts)
+	level.Debug(l).Log("msg", "Notification collected into the digest", "receiver", s.digester.groupName, "integration", s.digester.integration.String())
+	return ctx, alerts, nil
+}
@@ -0,0 +1,168 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/alerting/templates"
+)
+
+func TestDigestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		digest Digest
+		expErr string
+	}{
+		{name: "empty", digest: Digest{}, expErr: "exactly one of interval and at must be set"},
+		{name: "interval and at", digest: Digest{Interval: model.Duration(time.Hour), At: "09:00"}, expErr: "exactly one of interval and at must be set"},
+		{name: "negative interval", digest: Digest{Interval: model.Duration(-time.Hour)}, expErr: "interval must be greater than zero"},
+		{name: "timezone without at", digest: Digest{Interval: model.Duration(time.Hour), Timezone: "UTC"}, expErr: "timezone requires at"},
+		{name: "invalid at", digest: Digest{At: "9am"}, expErr: `invalid at "9am"`},
+		{name: "invalid timezone", digest: Digest{At: "09:00", Timezone: "Mars/Olympus"}, expErr: `invalid timezone "Mars/Olympus"`},
+		{name: "interval", digest: Digest{Interval: model.Duration(time.Hour)}},
+		{name: "daily", digest: Digest{At: "09:00", Timezone: "Europe/Paris"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.digest.Validate()
+			if c.expErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, c.expErr)
+		})
+	}
+}
+
+func TestDigestScheduleNext(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+
+	hourly, err := Digest{Interval: model.Duration(time.Hour)}.schedule()
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2023, 1, 2, 11, 0, 0, 0, time.UTC), hourly.next(time.Date(2023, 1, 2, 10, 15, 0, 0, time.UTC)))
+	require.Equal(t, time.Date(2023, 1, 2, 12, 0, 0, 0, time.UTC), hourly.next(time.Date(2023, 1, 2, 11, 0, 0, 0, time.UTC)))
+
+	daily, err := Digest{At: "09:00", Timezone: "Europe/Paris"}.schedule()
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2023, 1, 2, 9, 0, 0, 0, paris), daily.next(time.Date(2023, 1, 2, 7, 59, 0, 0, time.UTC)))
+	require.Equal(t, time.Date(2023, 1, 3, 9, 0, 0, 0, paris), daily.next(time.Date(2023, 1, 2, 8, 0, 0, 0, time.UTC)))
+	// Daylight saving time starts on 2023-03-26 in Paris.
+	require.Equal(t, time.Date(2023, 3, 26, 9, 0, 0, 0, paris), daily.next(time.Date(2023, 3, 25, 10, 0, 0, 0, paris)))
+}
+
+func TestDigests(t *testing.T) {
+	now := time.Now()
+	a := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "a"}, StartsAt: now}}
+	b := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "b"}, StartsAt: now}}
+	resolvedA := &types.Alert{Alert: model.Alert{Labels: a.Labels, StartsAt: now, EndsAt: now}}
+
+	d, err := newDigests("", time.Hour)
+	require.NoError(t, err)
+	d.add("recv", "webhook[0]", []*types.Alert{a}, now)
+	d.add("recv", "webhook[0]", []*types.Alert{a, b}, now.Add(time.Minute))
+
+	e, ok := d.take("recv", "webhook[0]")
+	require.True(t, ok)
+	require.Equal(t, 2, e.Notifications)
+	require.Equal(t, now, e.Since)
+	require.Len(t, e.Alerts, 2)
+	_, ok = d.take("recv", "webhook[0]")
+	require.False(t, ok)
+
+	// The content of a digest that failed to be sent goes before the content collected since.
+	d.add("recv", "webhook[0]", []*types.Alert{resolvedA}, now.Add(2*time.Minute))
+	d.restore(e)
+	e, ok = d.take("recv", "webhook[0]")
+	require.True(t, ok)
+	require.Equal(t, 3, e.Notifications)
+	require.Equal(t, now, e.Since)
+	require.Equal(t, []*types.Alert{resolvedA, b}, e.Alerts)
+
+	// The pending content survives restarts through the snapshot.
+	d.add("recv", "webhook[0]", []*types.Alert{a}, now)
+	d.add("other", "email[0]", []*types.Alert{b}, now.Add(-2*time.Hour))
+	snapshot, err := d.MarshalBinary()
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "digests")
+	require.NoError(t, os.WriteFile(file, snapshot, 0o600))
+
+	d, err = newDigests(file, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, 1, d.gc(now))
+	e, ok = d.take("recv", "webhook[0]")
+	require.True(t, ok)
+	require.Equal(t, 1, e.Notifications)
+	require.Equal(t, a.Labels, e.Alerts[0].Labels)
+
+	d.add("recv", "webhook[0]", []*types.Alert{a}, now)
+	require.Equal(t, 0, d.retain(map[string]struct{}{digestKey("recv", "webhook[0]"): {}}))
+	require.Equal(t, 1, d.retain(nil))
+}
+
+func TestDigest(t *testing.T) {
+	am, err := NewGrafanaAlertmanager("org", 1, &GrafanaAlertmanagerConfig{
+		Silences: newFakeMaintanenceOptions(t),
+		Nflog:    newFakeMaintanenceOptions(t),
+	}, &NilPeer{}, log.NewNopLogger(), NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry()))
+	require.NoError(t, err)
+	t.Cleanup(am.StopAndWait)
+
+	f := filepath.Join(t.TempDir(), "template")
+	require.NoError(t, os.WriteFile(f, []byte(templates.DefaultTemplateString), 0o600))
+	tmpl, err := template.FromGlobs([]string{f})
+	require.NoError(t, err)
+
+	n := &fakeNotifier{}
+	groupWait := model.Duration(time.Millisecond)
+	cfg := newFakeConfig(t, &Route{Receiver: "recv", GroupWait: &groupWait}, map[string][]*Integration{
+		"recv": {NewIntegration(n, n, "webhook", 0)},
+	})
+	tmpl.ExternalURL = cfg.templates.ExternalURL
+	cfg.templates = tmpl
+
+	cfg.digests = map[string]Digest{"recv": {}}
+	require.ErrorContains(t, am.ApplyConfig(cfg), `invalid digest for receiver "recv": exactly one of interval and at must be set`)
+
+	cfg.digests = map[string]Digest{"recv": {Interval: model.Duration(300 * time.Millisecond)}}
+	cfg.rateLimits = map[string]RateLimit{"recv": {Integration: &TokenBucket{Limit: 1, Interval: model.Duration(time.Minute)}}}
+	require.ErrorContains(t, am.ApplyConfig(cfg), `invalid digest for receiver "recv": a receiver with a digest cannot have a rate limit`)
+
+	cfg.rateLimits = nil
+	require.NoError(t, am.ApplyConfig(cfg))
+
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{{
+		Alert:    amv2.Alert{Labels: amv2.LabelSet{"alertname": "a"}},
+		StartsAt: strfmt.DateTime(time.Now()),
+	}}))
+
+	require.Eventually(t, func() bool {
+		return len(n.notifications()) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	notifications := n.notifications()
+	require.Len(t, notifications[0], 1, "the notification is collected into the digest")
+	digest := notifications[0][0]
+	require.Equal(t, model.LabelValue(DigestAlertName), digest.Labels[model.AlertNameLabel])
+	require.Equal(t, model.LabelValue("recv"), digest.Labels["receiver"])
+	require.True(t, strings.HasPrefix(string(digest.Annotations["summary"]), "1 notifications of 1 alerts, 1 firing, since "), digest.Annotations["summary"])
+	require.True(t, strings.HasPrefix(string(digest.Annotations["description"]), "1 alerts, 1 firing and 0 resolved."), digest.Annotations["description"])
+	require.Contains(t, digest.Annotations["description"], "alertname = a")
+
+	// The digest is sent through the stages of the integration.
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(am.Metrics.ReceiverNotifications.WithLabelValues("recv", "webhook[0]", "sent")) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
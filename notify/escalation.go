@@ -0,0 +1,223 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// EscalationPolicy notifies an ordered list of receivers, each after its delay, until the alert group is
+// acknowledged or resolved. Routes use an escalation policy by having its name as receiver.
+type EscalationPolicy struct {
+	Name  string           `yaml:"name" json:"name"`
+	Steps []EscalationStep `yaml:"steps" json:"steps"`
+}
+
+// EscalationStep is a step of an escalation policy.
+type EscalationStep struct {
+	Receiver string `yaml:"receiver" json:"receiver"`
+	// Delay is how long after the group started firing the receiver is notified. The step is notified on the first
+	// flush of the group past the delay, so the group interval of the route bounds its precision.
+	Delay model.Duration `yaml:"delay,omitempty" json:"delay,omitempty"`
+}
+
+// Validate checks the policy against the receivers of the configuration.
+func (p EscalationPolicy) Validate(receivers map[string][]*notify.Integration) error {
+	if p.Name == "" {
+		return errors.New("name must not be empty")
+	}
+	if _, ok := receivers[p.Name]; ok {
+		return fmt.Errorf("name %q is already used by a receiver", p.Name)
+	}
+	if len(p.Steps) == 0 {
+		return errors.New("at least one step is required")
+	}
+	for i, s := range p.Steps {
+		if _, ok := receivers[s.Receiver]; !ok {
+			return fmt.Errorf("step %d: undefined receiver %q", i, s.Receiver)
+		}
+		if s.Delay < 0 {
+			return fmt.Errorf("step %d: delay must not be negative", i)
+		}
+		if i > 0 && s.Delay < p.Steps[i-1].Delay {
+			return fmt.Errorf("step %d: delay must be greater than or equal to the delay of the previous step", i)
+		}
+	}
+	return nil
+}
+
+// stepAt returns the last step due after the group fired for the given duration, -1 if none is.
+func (p EscalationPolicy) stepAt(elapsed time.Duration) int {
+	step := -1
+	for i, s := range p.Steps {
+		if time.Duration(s.Delay) > elapsed {
+			break
+		}
+		step = i
+	}
+	return step
+}
+
+// EscalationStatus is the escalation of an alert group.
+type EscalationStatus struct {
+	Policy string `json:"policy"`
+	// Step is the index of the last step notified, -1 if none is yet. Receiver is its receiver.
+	Step      int       `json:"step"`
+	Receiver  string    `json:"receiver,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	// NextStepAt is when the next step is due, if there is one and the group is not acknowledged.
+	NextStepAt *time.Time `json:"nextStepAt,omitempty"`
+}
+
+// escalation is the state of the escalation of an alert group.
+type escalation struct {
+	GroupKey  string    `json:"groupKey"`
+	Policy    string    `json:"policy"`
+	Step      int       `json:"step"`
+	StartedAt time.Time `json:"startedAt"`
+	// Resolved is set once the alerts of the group are resolved, the next firing alert starts a new escalation.
+	Resolved  bool      `json:"resolved,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (e *escalation) storeKey() string {
+	return e.GroupKey
+}
+
+func (e *escalation) lastUpdate() time.Time {
+	return e.UpdatedAt
+}
+
+// escalations stores the escalations of the alert groups, by group key. Like the notification log, they are
+// replicated to the other peers of the cluster, the most recently updated escalation of a group winning, and kept
+// for the retention after their last update.
+type escalations struct {
+	*replicatedStore[*escalation]
+	retention time.Duration
+}
+
+func newEscalations(snapshotFile string, retention time.Duration) (*escalations, error) {
+	s, err := newReplicatedStore[*escalation]("escalations", snapshotFile)
+	if err != nil {
+		return nil, err
+	}
+	return &escalations{replicatedStore: s, retention: retention}, nil
+}
+
+// gc removes the escalations not updated for longer than the retention and returns how many were removed.
+func (e *escalations) gc(now time.Time) int {
+	return e.deleteIf(func(s *escalation) bool {
+		return s.UpdatedAt.Add(e.retention).Before(now)
+	})
+}
+
+// escalationStage notifies the receivers of the steps of an escalation policy which are due.
+type escalationStage struct {
+	policy EscalationPolicy
+	// stages are the stages of the receivers of the steps.
+	stages      []notify.Stage
+	escalations *escalations
+}
+
+// Exec implements the Stage interface.
+func (s *escalationStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	gkey, ok := notify.GroupKey(ctx)
+	if !ok {
+		return ctx, nil, errors.New("group key missing")
+	}
+	now, ok := notify.Now(ctx)
+	if !ok {
+		now = time.Now()
+	}
+	firing := len(firingFingerprints(alerts, now)) > 0
+
+	e, ok := s.escalations.get(gkey)
+	if !ok || e.Resolved || e.Policy != s.policy.Name {
+		e = &escalation{
+			GroupKey:  gkey,
+			Policy:    s.policy.Name,
+			Step:      s.policy.stepAt(0),
+			StartedAt: now,
+			UpdatedAt: now,
+		}
+		if firing {
+			s.escalations.set(e)
+		}
+	}
+
+	switch {
+	case !firing:
+		if !e.Resolved {
+			resolved := *e
+			resolved.Resolved = true
+			resolved.UpdatedAt = now
+			s.escalations.set(&resolved)
+		}
+	default:
+		if step := s.policy.stepAt(now.Sub(e.StartedAt)); step > e.Step {
+			escalated := *e
+			escalated.Step = step
+			escalated.UpdatedAt = now
+			s.escalations.set(&escalated)
+			e = &escalated
+			level.Info(l).Log("msg", "alert group escalated", "policy", s.policy.Name, "step", step, "receiver", s.policy.Steps[step].Receiver)
+		} else if now.Sub(e.UpdatedAt) > s.escalations.retention/2 {
+			// Keep the escalation of a group that fires for longer than the retention.
+			refreshed := *e
+			refreshed.UpdatedAt = now
+			s.escalations.set(&refreshed)
+		}
+	}
+
+	// The receivers of the steps reached so far are notified, each of them deduplicates its notifications.
+	var fs notify.FanoutStage
+	for i := 0; i <= e.Step && i < len(s.stages); i++ {
+		fs = append(fs, &receiverNameStage{name: s.policy.Steps[i].Receiver, next: s.stages[i]})
+	}
+	return fs.Exec(ctx, l, alerts...)
+}
+
+// receiverNameStage executes the stage of a receiver with its name in the context.
+type receiverNameStage struct {
+	name string
+	next notify.Stage
+}
+
+// Exec implements the Stage interface.
+func (s *receiverNameStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	return s.next.Exec(notify.WithReceiverName(ctx, s.name), l, alerts...)
+}
+
+// escalationStatus returns the escalation of the group with the given key, if its receiver is an escalation policy
+// and it is escalating. The caller must hold reloadConfigMtx.
+func (am *GrafanaAlertmanager) escalationStatus(receiver, groupKey string, acknowledged bool) *EscalationStatus {
+	policy, ok := am.escalationPolicies[receiver]
+	if !ok {
+		return nil
+	}
+	e, ok := am.escalations.get(groupKey)
+	if !ok || e.Resolved || e.Policy != policy.Name {
+		return nil
+	}
+
+	status := &EscalationStatus{
+		Policy:    policy.Name,
+		Step:      e.Step,
+		StartedAt: e.StartedAt,
+	}
+	if e.Step >= 0 && e.Step < len(policy.Steps) {
+		status.Receiver = policy.Steps[e.Step].Receiver
+	}
+	if next := e.Step + 1; next < len(policy.Steps) && !acknowledged {
+		at := e.StartedAt.Add(time.Duration(policy.Steps[next].Delay))
+		status.NextStepAt = &at
+	}
+	return status
+}
@@ -0,0 +1,255 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+// receiverRecorder records the receiver names of the contexts it is executed with.
+type receiverRecorder struct {
+	mtx       sync.Mutex
+	receivers []string
+}
+
+func (r *receiverRecorder) Exec(ctx context.Context, _ log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	name, _ := notify.ReceiverName(ctx)
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.receivers = append(r.receivers, name)
+	return ctx, alerts, nil
+}
+
+func (r *receiverRecorder) reset() []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	res := r.receivers
+	r.receivers = nil
+	return res
+}
+
+func TestEscalationPolicyValidate(t *testing.T) {
+	receivers := map[string][]*notify.Integration{"slack": nil, "pagerduty": nil}
+	cases := []struct {
+		name   string
+		policy EscalationPolicy
+		expErr string
+	}{
+		{
+			name:   "missing name",
+			policy: EscalationPolicy{Steps: []EscalationStep{{Receiver: "slack"}}},
+			expErr: "name must not be empty",
+		},
+		{
+			name:   "name of a receiver",
+			policy: EscalationPolicy{Name: "slack", Steps: []EscalationStep{{Receiver: "slack"}}},
+			expErr: `name "slack" is already used by a receiver`,
+		},
+		{
+			name:   "no steps",
+			policy: EscalationPolicy{Name: "policy"},
+			expErr: "at least one step is required",
+		},
+		{
+			name:   "undefined receiver",
+			policy: EscalationPolicy{Name: "policy", Steps: []EscalationStep{{Receiver: "email"}}},
+			expErr: `step 0: undefined receiver "email"`,
+		},
+		{
+			name: "decreasing delays",
+			policy: EscalationPolicy{Name: "policy", Steps: []EscalationStep{
+				{Receiver: "slack", Delay: model.Duration(time.Hour)},
+				{Receiver: "pagerduty", Delay: model.Duration(time.Minute)},
+			}},
+			expErr: "step 1: delay must be greater than or equal to the delay of the previous step",
+		},
+		{
+			name: "valid",
+			policy: EscalationPolicy{Name: "policy", Steps: []EscalationStep{
+				{Receiver: "slack"},
+				{Receiver: "pagerduty", Delay: model.Duration(10 * time.Minute)},
+			}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.policy.Validate(receivers)
+			if c.expErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, c.expErr)
+		})
+	}
+}
+
+func TestEscalationStage(t *testing.T) {
+	start := time.Now()
+	firing := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "a"}, StartsAt: start}}
+
+	escs, err := newEscalations("", time.Hour)
+	require.NoError(t, err)
+	rec := &receiverRecorder{}
+	s := &escalationStage{
+		policy: EscalationPolicy{Name: "policy", Steps: []EscalationStep{
+			{Receiver: "slack"},
+			{Receiver: "pagerduty", Delay: model.Duration(10 * time.Minute)},
+			{Receiver: "email", Delay: model.Duration(30 * time.Minute)},
+		}},
+		stages:      []notify.Stage{rec, rec, rec},
+		escalations: escs,
+	}
+	exec := func(now time.Time, alerts ...*types.Alert) {
+		t.Helper()
+		ctx := notify.WithNow(notify.WithGroupKey(context.Background(), "group"), now)
+		_, _, err := s.Exec(ctx, log.NewNopLogger(), alerts...)
+		require.NoError(t, err)
+	}
+
+	exec(start, firing)
+	require.Equal(t, []string{"slack"}, rec.reset())
+	e, ok := escs.get("group")
+	require.True(t, ok)
+	require.Equal(t, 0, e.Step)
+
+	exec(start.Add(10*time.Minute), firing)
+	require.ElementsMatch(t, []string{"slack", "pagerduty"}, rec.reset())
+
+	// The acknowledgement stage in front of the escalation stops it at its current step.
+	acks, err := newAcknowledgements("", 0)
+	require.NoError(t, err)
+	acks.set(&GroupAcknowledgement{GroupKey: "group", By: "admin", Alerts: []model.Fingerprint{firing.Fingerprint()}, Until: start.Add(time.Hour), UpdatedAt: start})
+	ctx := notify.WithNow(notify.WithGroupKey(context.Background(), "group"), start.Add(40*time.Minute))
+	_, _, err = notify.MultiStage{&acknowledgementStage{acks: acks}, s}.Exec(ctx, log.NewNopLogger(), firing)
+	require.NoError(t, err)
+	require.Empty(t, rec.reset())
+	e, _ = escs.get("group")
+	require.Equal(t, 1, e.Step)
+
+	exec(start.Add(40*time.Minute), firing)
+	require.ElementsMatch(t, []string{"slack", "pagerduty", "email"}, rec.reset())
+	e, _ = escs.get("group")
+	require.Equal(t, 2, e.Step)
+
+	// The resolved notification goes to all the steps reached, then the escalation starts over.
+	resolved := &types.Alert{Alert: model.Alert{Labels: firing.Labels, StartsAt: start, EndsAt: start.Add(45 * time.Minute)}}
+	exec(start.Add(50*time.Minute), resolved)
+	require.ElementsMatch(t, []string{"slack", "pagerduty", "email"}, rec.reset())
+	e, _ = escs.get("group")
+	require.True(t, e.Resolved)
+
+	exec(start.Add(time.Hour), firing)
+	require.Equal(t, []string{"slack"}, rec.reset())
+	e, _ = escs.get("group")
+	require.False(t, e.Resolved)
+	require.Equal(t, start.Add(time.Hour), e.StartedAt)
+}
+
+func TestEscalationsMerge(t *testing.T) {
+	now := time.Now()
+	escs, err := newEscalations("", time.Hour)
+	require.NoError(t, err)
+	var broadcast []byte
+	escs.setBroadcast(func(b []byte) { broadcast = b })
+
+	older := &escalation{GroupKey: "group", Policy: "policy", Step: 0, UpdatedAt: now.Add(-time.Minute)}
+	newer := &escalation{GroupKey: "group", Policy: "policy", Step: 1, UpdatedAt: now}
+	stale := &escalation{GroupKey: "stale", Policy: "policy", UpdatedAt: now.Add(-2 * time.Hour)}
+
+	b, err := json.Marshal([]*escalation{newer, stale})
+	require.NoError(t, err)
+	require.NoError(t, escs.Merge(b))
+	require.Equal(t, b, broadcast, "new escalations are broadcast again")
+
+	broadcast = nil
+	b, err = json.Marshal([]*escalation{older})
+	require.NoError(t, err)
+	require.NoError(t, escs.Merge(b))
+	require.Nil(t, broadcast)
+	e, ok := escs.get("group")
+	require.True(t, ok)
+	require.Equal(t, 1, e.Step)
+
+	require.Equal(t, 1, escs.gc(now))
+	state, err := escs.MarshalBinary()
+	require.NoError(t, err)
+	var entries []*escalation
+	require.NoError(t, json.Unmarshal(state, &entries))
+	require.Len(t, entries, 1)
+	require.Equal(t, "group", entries[0].GroupKey)
+
+	require.Error(t, escs.Merge([]byte("invalid")))
+}
+
+func TestEscalationPolicies(t *testing.T) {
+	// The notification log and the escalations are kept for the duration of the test.
+	am, err := NewGrafanaAlertmanager("org", 1, &GrafanaAlertmanagerConfig{
+		Silences:    newFakeMaintanenceOptions(t),
+		Nflog:       &fakeMaintenanceOptions{retention: time.Hour},
+		Escalations: &fakeMaintenanceOptions{retention: time.Hour},
+	}, &NilPeer{}, log.NewNopLogger(), NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry()))
+	require.NoError(t, err)
+	t.Cleanup(am.StopAndWait)
+
+	first, second := &fakeNotifier{}, &fakeNotifier{}
+	groupWait, groupInterval := model.Duration(time.Millisecond), model.Duration(10*time.Millisecond)
+	cfg := newFakeConfig(t, &Route{
+		Receiver:      "escalate",
+		GroupWait:     &groupWait,
+		GroupInterval: &groupInterval,
+	}, map[string][]*Integration{
+		"first":  {NewIntegration(first, first, "webhook", 0)},
+		"second": {NewIntegration(second, second, "webhook", 0)},
+	})
+
+	cfg.escalationPolicies = []EscalationPolicy{{Name: "escalate", Steps: []EscalationStep{{Receiver: "unknown"}}}}
+	require.ErrorContains(t, am.ApplyConfig(cfg), `invalid escalation policy "escalate": step 0: undefined receiver "unknown"`)
+
+	cfg.escalationPolicies = []EscalationPolicy{{Name: "escalate", Steps: []EscalationStep{
+		{Receiver: "first"},
+		{Receiver: "second", Delay: model.Duration(300 * time.Millisecond)},
+	}}}
+	require.NoError(t, am.ApplyConfig(cfg))
+
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{{
+		Alert:    amv2.Alert{Labels: amv2.LabelSet{"alertname": "a"}},
+		StartsAt: strfmt.DateTime(time.Now()),
+	}}))
+	require.Eventually(t, func() bool {
+		return len(first.notifications()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	groups, err := am.GetAlertGroupsWithState(true, true, true, nil, "")
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	esc := groups[0].Escalation
+	require.NotNil(t, esc)
+	require.Equal(t, "escalate", esc.Policy)
+	require.Equal(t, 0, esc.Step)
+	require.Equal(t, "first", esc.Receiver)
+	require.NotNil(t, esc.NextStepAt)
+	require.Equal(t, esc.StartedAt.Add(300*time.Millisecond), *esc.NextStepAt)
+
+	require.Eventually(t, func() bool {
+		return len(second.notifications()) == 1
+	}, 5*time.Second, 10*time.Millisecond, "the group escalates to the second step")
+	require.Len(t, first.notifications(), 1, "the first step is not notified again")
+
+	groups, err = am.GetAlertGroupsWithState(true, true, true, nil, "")
+	require.NoError(t, err)
+	esc = groups[0].Escalation
+	require.Equal(t, 1, esc.Step)
+	require.Equal(t, "second", esc.Receiver)
+	require.Nil(t, esc.NextStepAt)
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/grafana/alerting/receivers/googlechat"
 	"github.com/grafana/alerting/receivers/kafka"
 	"github.com/grafana/alerting/receivers/line"
+	"github.com/grafana/alerting/receivers/oncall"
 	"github.com/grafana/alerting/receivers/opsgenie"
 	"github.com/grafana/alerting/receivers/pagerduty"
 	"github.com/grafana/alerting/receivers/pushover"
@@ -50,6 +51,23 @@ var receiverFactories = map[string]func(receivers.FactoryConfig) (NotificationCh
 	"webex":                   wrap(webex.New),
 }
 
+func init() {
+	// The on-call receiver delegates to the other receivers, so it cannot be in the literal above without an
+	// initialization cycle.
+	receiverFactories["oncall"] = wrap(newOnCall)
+}
+
+// newOnCall builds an on-call receiver whose participants are notified with the receivers of Factory.
+func newOnCall(fc receivers.FactoryConfig) (*oncall.Notifier, error) {
+	return oncall.New(fc, func(fc receivers.FactoryConfig) (oncall.ContactNotifier, error) {
+		factory, ok := Factory(fc.Config.Type)
+		if !ok {
+			return nil, fmt.Errorf("unsupported contact type %q", fc.Config.Type)
+		}
+		return factory(fc)
+	})
+}
+
 type NotificationChannel interface {
 	notify.Notifier
 	notify.ResolvedSender
@@ -61,9 +79,12 @@ func Factory(receiverType string) (func(receivers.FactoryConfig) (NotificationCh
 	return factory, exists
 }
 
-// wrap wraps the notifier's factory errors with receivers.ReceiverInitError
+// wrap wraps the notifier's factory errors with receivers.ReceiverInitError. The notifier sends with the
+// NotificationSender of the context, if any, whether or not the FactoryConfig was built by receivers.NewFactoryConfig,
+// so that dry runs never send notifications.
 func wrap[T NotificationChannel](f func(fc receivers.FactoryConfig) (T, error)) func(receivers.FactoryConfig) (NotificationChannel, error) {
 	return func(fc receivers.FactoryConfig) (NotificationChannel, error) {
+		fc.NotificationService = receivers.ContextSender(fc.NotificationService)
 		ch, err := f(fc)
 		if err != nil {
 			return nil, ReceiverInitError{
@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/alertmanager/cluster"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultGossipListenAddress = "0.0.0.0:9094"
+	defaultGossipLeaveTimeout  = 10 * time.Second
+)
+
+// GossipPeerConfig configures a peer of a cluster whose members replicate their state with memberlist gossip.
+// Durations default to those of the Alertmanager when zero.
+type GossipPeerConfig struct {
+	// ListenAddress is the host:port the peer listens on for gossip, 0.0.0.0:9094 by default.
+	ListenAddress string
+	// AdvertiseAddress is the host:port the other peers reach the peer on. It is deduced from ListenAddress if empty.
+	AdvertiseAddress string
+
+	// Peers are the initial peers as host:port. Host names are resolved to all of their addresses, periodically, so
+	// that the name of a headless service discovers all of its members.
+	Peers []string
+	// PeersSRV is a DNS SRV record, for example "_gossip._tcp.alertmanager.example.com", whose targets are added to
+	// Peers. The record is resolved once, on creation: the addresses of its targets are refreshed like those of
+	// Peers, but targets added to the record later are not discovered.
+	PeersSRV string
+	// AllowInsecureAdvertise allows advertising a public address of the host when AdvertiseAddress is empty,
+	// ListenAddress is on all interfaces and the host has no private address.
+	AllowInsecureAdvertise bool
+
+	PushPullInterval  time.Duration
+	GossipInterval    time.Duration
+	TCPTimeout        time.Duration
+	ProbeTimeout      time.Duration
+	ProbeInterval     time.Duration
+	ReconnectInterval time.Duration
+	ReconnectTimeout  time.Duration
+	// SettleTimeout is how long WaitReady waits at most for the cluster to settle. Defaults to PushPullInterval.
+	SettleTimeout time.Duration
+
+	// TLS secures the gossip traffic, if present.
+	TLS *cluster.TLSTransportConfig
+}
+
+func (c *GossipPeerConfig) applyDefaults() {
+	if c.ListenAddress == "" {
+		c.ListenAddress = defaultGossipListenAddress
+	}
+	defaults := []struct {
+		v *time.Duration
+		d time.Duration
+	}{
+		{&c.PushPullInterval, cluster.DefaultPushPullInterval},
+		{&c.GossipInterval, cluster.DefaultGossipInterval},
+		{&c.TCPTimeout, cluster.DefaultTCPTimeout},
+		{&c.ProbeTimeout, cluster.DefaultProbeTimeout},
+		{&c.ProbeInterval, cluster.DefaultProbeInterval},
+		{&c.ReconnectInterval, cluster.DefaultReconnectInterval},
+		{&c.ReconnectTimeout, cluster.DefaultReconnectTimeout},
+		{&c.SettleTimeout, c.PushPullInterval},
+	}
+	for _, d := range defaults {
+		if *d.v == 0 {
+			*d.v = d.d
+		}
+	}
+}
+
+// GossipPeer is a ClusterPeer whose state is replicated to the other peers with memberlist gossip.
+type GossipPeer struct {
+	*cluster.Peer
+	cancelSettle context.CancelFunc
+}
+
+// NewGossipPeer creates a peer, joins the cluster of its initial peers and starts settling. Its position in the
+// cluster is its rank among the names of the members.
+func NewGossipPeer(cfg GossipPeerConfig, logger log.Logger, reg prometheus.Registerer) (*GossipPeer, error) {
+	cfg.applyDefaults()
+	logger = log.With(logger, "component", "cluster")
+
+	peers := append([]string{}, cfg.Peers...)
+	if cfg.PeersSRV != "" {
+		srvPeers, err := lookupSRVPeers(context.Background(), net.DefaultResolver, cfg.PeersSRV)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, srvPeers...)
+	}
+
+	p, err := cluster.Create(
+		logger,
+		reg,
+		cfg.ListenAddress,
+		cfg.AdvertiseAddress,
+		peers,
+		true,
+		cfg.PushPullInterval,
+		cfg.GossipInterval,
+		cfg.TCPTimeout,
+		cfg.ProbeTimeout,
+		cfg.ProbeInterval,
+		cfg.TLS,
+		cfg.AllowInsecureAdvertise,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize gossip mesh: %w", err)
+	}
+
+	if err := p.Join(cfg.ReconnectInterval, cfg.ReconnectTimeout); err != nil {
+		// The peer keeps trying to reconnect to its initial peers.
+		level.Error(logger).Log("msg", "unable to join gossip mesh while initializing cluster for high availability mode", "err", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.SettleTimeout)
+	go p.Settle(ctx, cfg.GossipInterval*10)
+
+	return &GossipPeer{Peer: p, cancelSettle: cancel}, nil
+}
+
+// Stop leaves the cluster.
+func (p *GossipPeer) Stop() error {
+	p.cancelSettle()
+	return p.Leave(defaultGossipLeaveTimeout)
+}
+
+// lookupSRVPeers returns the targets of the SRV record as host:port.
+func lookupSRVPeers(ctx context.Context, r *net.Resolver, name string) ([]string, error) {
+	_, addrs, err := r.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up peers of SRV record %q: %w", name, err)
+	}
+	peers := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		peers = append(peers, net.JoinHostPort(strings.TrimSuffix(a.Target, "."), strconv.Itoa(int(a.Port))))
+	}
+	return peers, nil
+}
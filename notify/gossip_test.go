@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/nflog"
+	"github.com/prometheus/alertmanager/nflog/nflogpb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGossipPeer(t *testing.T, peers ...string) *GossipPeer {
+	t.Helper()
+	p, err := NewGossipPeer(GossipPeerConfig{
+		ListenAddress:  "127.0.0.1:0",
+		Peers:          peers,
+		GossipInterval: 10 * time.Millisecond,
+		SettleTimeout:  time.Second,
+	}, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, p.Stop())
+	})
+	return p
+}
+
+func TestGossipPeer(t *testing.T) {
+	first := newTestGossipPeer(t)
+	second := newTestGossipPeer(t, first.Self().Address())
+	third := newTestGossipPeer(t, first.Self().Address())
+
+	peers := []*GossipPeer{first, second, third}
+	require.Eventually(t, func() bool {
+		for _, p := range peers {
+			if p.ClusterSize() != 3 {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	positions := map[int]struct{}{}
+	for _, p := range peers {
+		require.NoError(t, p.WaitReady(ctx))
+		positions[p.Position()] = struct{}{}
+	}
+	require.Equal(t, map[int]struct{}{0: {}, 1: {}, 2: {}}, positions)
+
+	// The state of the Alertmanagers of the same tenant is replicated through their peers.
+	var ams []*GrafanaAlertmanager
+	var notifiers []*fakeNotifier
+	for _, p := range peers[:2] {
+		am, err := NewGrafanaAlertmanager("org", 1, &GrafanaAlertmanagerConfig{
+			Silences: newFakeMaintanenceOptions(t),
+			Nflog:    newFakeMaintanenceOptions(t),
+		}, p, log.NewNopLogger(), NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry()))
+		require.NoError(t, err)
+		t.Cleanup(am.StopAndWait)
+
+		n := &fakeNotifier{}
+		groupWait := model.Duration(time.Millisecond)
+		require.NoError(t, am.ApplyConfig(newFakeConfig(t, &Route{Receiver: "recv", GroupWait: &groupWait}, map[string][]*Integration{
+			"recv": {NewIntegration(n, n, "webhook", 0)},
+		})))
+		ams = append(ams, am)
+		notifiers = append(notifiers, n)
+	}
+
+	startsAt, endsAt := strfmt.DateTime(time.Now()), strfmt.DateTime(time.Now().Add(time.Hour))
+	comment, createdBy := "maintenance", "admin"
+	matcherName, matcherValue, isRegex := "alertname", "silenced", false
+	silenceID, err := ams[0].CreateSilence(&PostableSilence{Silence: amv2.Silence{
+		Comment:   &comment,
+		CreatedBy: &createdBy,
+		StartsAt:  &startsAt,
+		EndsAt:    &endsAt,
+		Matchers:  amv2.Matchers{{Name: &matcherName, Value: &matcherValue, IsRegex: &isRegex}},
+	}})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, err := ams[1].GetSilence(silenceID)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, ams[0].PutAlerts(amv2.PostableAlerts{{
+		Alert:    amv2.Alert{Labels: amv2.LabelSet{"alertname": "test"}},
+		StartsAt: strfmt.DateTime(time.Now()),
+	}}))
+	require.Eventually(t, func() bool {
+		return len(notifiers[0].notifications()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		entries, err := ams[1].notificationLog.Query(nflog.QReceiver(&nflogpb.Receiver{GroupName: "recv", Integration: "webhook"}), nflog.QGroupKey("{}:{}"))
+		return err == nil && len(entries) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
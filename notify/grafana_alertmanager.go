@@ -28,8 +28,10 @@ import (
 	"github.com/prometheus/alertmanager/types"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
-	"github.com/grafana/alerting/models"
+	"github.com/grafana/alerting/tracing"
 )
 
 const (
@@ -85,6 +87,7 @@ type GrafanaAlertmanager struct {
 	notificationLog *nflog.Log
 	dispatcher      *dispatch.Dispatcher
 	inhibitor       *inhibit.Inhibitor
+	inhibitRules    []InhibitRule
 	silencer        *silence.Silencer
 	silences        *silence.Silences
 	templates       *Template
@@ -96,6 +99,64 @@ type GrafanaAlertmanager struct {
 	stageMetrics      *notify.Metrics
 	dispatcherMetrics *dispatch.DispatcherMetrics
 
+	// templateValidation is how ApplyConfig handles templates of receivers that fail to render.
+	templateValidation TemplateValidationMode
+
+	// customStages are the host-provided stages injected into the notification pipeline, by hook.
+	customStages customStages
+	tracer       trace.Tracer
+
+	auditSink AuditSink
+	// configSummary summarizes the current configuration for the audit of the next one.
+	configSummary *configSummary
+
+	// retryPolicies are the retry policies of the current configuration, by receiver name.
+	retryPolicies map[string]RetryPolicy
+	// circuitBreakers are the circuit breakers of the integrations whose receiver has a policy with one.
+	circuitBreakers map[circuitBreakerKey]*circuitBreaker
+	// receiverDigests are the digests of the configurations of the receivers, by name.
+	receiverDigests map[string][32]byte
+
+	// rateLimits are the rate limits of the current configuration, by receiver name.
+	rateLimits map[string]RateLimit
+	// rateLimiters are the rate limiters of the integrations whose receiver has a rate limit.
+	rateLimiters map[rateLimitKey]*rateLimiter
+	// receiverBuckets are the buckets of the receivers whose rate limit has a receiver limit.
+	receiverBuckets map[rateLimitKey]*tokenBucket
+
+	// digestConfigs are the digests of the current configuration, by receiver name.
+	digestConfigs map[string]Digest
+	// digesters send the digests of the integrations whose receiver has a digest.
+	digesters []*digester
+	// digests stores the pending content of the digests.
+	digests *digests
+
+	// ingestionLimits are the limits of the alerts accepted by PutAlerts.
+	ingestionLimits IngestionLimits
+	// relabelRules relabel the alerts received by PutAlerts.
+	relabelRules []*relabelRule
+
+	// receipts records when the alerts were received, for the latency of their notifications.
+	receipts *alertReceipts
+	// activeAlerts follows the firing alerts, for the limit of active alerts.
+	activeAlerts *activeAlerts
+	// aggrGroups collects the number of aggregation groups of the routes.
+	aggrGroups *aggrGroupsCollector
+
+	// history records the state changes and notifications of every alert. It is nil if not enabled.
+	history *alertHistory
+
+	// deadLetters stores the notifications that could not be delivered. It is nil if not enabled.
+	deadLetters *deadLetters
+
+	// acknowledgements stores the acknowledgements of the alert groups.
+	acknowledgements *acknowledgements
+
+	// escalationPolicies are the escalation policies of the current configuration, by name.
+	escalationPolicies map[string]EscalationPolicy
+	// escalations stores the escalations of the alert groups routed to an escalation policy.
+	escalations *escalations
+
 	reloadConfigMtx              sync.RWMutex
 	configHash                   [16]byte
 	config                       []byte
@@ -109,6 +170,39 @@ type State interface {
 	MarshalBinary() ([]byte, error)
 }
 
+// runMaintenance runs fn at every interval, and a last time once stopc is closed.
+func runMaintenance(interval time.Duration, stopc <-chan struct{}, fn func()) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stopc:
+			fn()
+			return
+		case <-t.C:
+			fn()
+		}
+	}
+}
+
+// startMaintenance runs the garbage collection of the state at every interval until the Alertmanager stops, followed by
+// the maintenance function of the options, if present.
+func (am *GrafanaAlertmanager) startMaintenance(name string, interval time.Duration, opts MaintenanceOptions, state State, gc func()) {
+	am.wg.Add(1)
+	go func() {
+		defer am.wg.Done()
+		runMaintenance(interval, am.stopc, func() {
+			gc()
+			if opts == nil {
+				return
+			}
+			if _, err := opts.MaintenanceFunc(state); err != nil {
+				level.Error(am.logger).Log("msg", name+" maintenance failed", "err", err)
+			}
+		})
+	}()
+}
+
 // MaintenanceOptions represent the configuration options available for executing maintenance of Silences and the Notification log that the Alertmanager uses.
 type MaintenanceOptions interface {
 	// Filepath returns the string representation of the filesystem path of the file to do maintenance on.
@@ -140,10 +234,27 @@ type NotifyReceiver = notify.Receiver
 // Configuration is an interface for accessing Alertmanager configuration.
 type Configuration interface {
 	DispatcherLimits() DispatcherLimits
+	// IngestionLimits returns the limits of the alerts accepted by PutAlerts.
+	IngestionLimits() IngestionLimits
+	// AlertRelabelConfigs returns the relabel configs applied in order to the alerts received by PutAlerts, before
+	// they are validated.
+	AlertRelabelConfigs() []RelabelConfig
 	InhibitRules() []InhibitRule
 	MuteTimeIntervals() []MuteTimeInterval
 	ReceiverIntegrations() (map[string][]*Integration, error)
 	BuildReceiverIntegrationsFunc() func(next *GrafanaReceiver, tmpl *Template) (Notifier, error)
+	// RetryPolicies returns the retry policies by receiver name. Receivers without a policy retry notifications
+	// until the group interval expires.
+	RetryPolicies() map[string]RetryPolicy
+	RateLimits() map[string]RateLimit
+	// Digests returns the digests by receiver name. The notifications of receivers with a digest are batched into
+	// periodic summaries, which are sent with the retry policy of the receiver. They cannot have a rate limit.
+	Digests() map[string]Digest
+	// EscalationPolicies returns the escalation policies, which routes use by name as receiver.
+	EscalationPolicies() []EscalationPolicy
+	// Receivers returns the receivers of the configuration, whose templated settings are validated according to the
+	// TemplateValidation mode of the Alertmanager.
+	Receivers() []*APIReceiver
 
 	RoutingTree() *Route
 	Templates() *Template
@@ -159,6 +270,31 @@ type GrafanaAlertmanagerConfig struct {
 
 	Silences MaintenanceOptions
 	Nflog    MaintenanceOptions
+	// DeadLetters enables the dead-letter store of failed notifications, if present.
+	DeadLetters MaintenanceOptions
+	// AlertHistory enables the timeline of the state changes and notifications of every alert, if present.
+	AlertHistory *AlertHistoryConfig
+	// Acknowledgements persists the acknowledgements of the alert groups, if present. They are only kept in memory
+	// otherwise.
+	Acknowledgements MaintenanceOptions
+	// Escalations persists the escalations of the alert groups, if present. They are only kept in memory otherwise,
+	// for the retention of the notification log.
+	Escalations MaintenanceOptions
+	// Digests persists the pending content of the digests of receivers, if present. It is only kept in memory
+	// otherwise, and lost on restart.
+	Digests MaintenanceOptions
+
+	// TemplateValidation is how ApplyConfig handles templates of receivers that fail to render.
+	TemplateValidation TemplateValidationMode
+
+	// Stages are custom stages injected into the notification pipeline at their respective hooks.
+	Stages []CustomStage
+
+	// TracerProvider traces the ingestion of alerts and the notification pipeline. Tracing is disabled if nil.
+	TracerProvider trace.TracerProvider
+
+	// AuditSink receives the audit events of silence changes, configuration changes and receiver tests, if present.
+	AuditSink AuditSink
 }
 
 func (c *GrafanaAlertmanagerConfig) Validate() error {
@@ -170,11 +306,28 @@ func (c *GrafanaAlertmanagerConfig) Validate() error {
 		return errors.New("notification log maintenance options must be present")
 	}
 
+	if c.AlertHistory != nil {
+		if err := c.AlertHistory.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := c.TemplateValidation.Validate(); err != nil {
+		return err
+	}
+
+	for _, s := range c.Stages {
+		if err := s.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 // NewGrafanaAlertmanager creates a new Grafana-specific Alertmanager.
 func NewGrafanaAlertmanager(tenantKey string, tenantID int64, config *GrafanaAlertmanagerConfig, peer ClusterPeer, logger log.Logger, m *GrafanaAlertmanagerMetrics) (*GrafanaAlertmanager, error) {
+	m = m.forTenant(tenantID)
 	// TODO: Remove the context.
 	am := &GrafanaAlertmanager{
 		stopc:             make(chan struct{}),
@@ -192,6 +345,15 @@ func NewGrafanaAlertmanager(tenantKey string, tenantID int64, config *GrafanaAle
 		return nil, err
 	}
 
+	am.customStages = newCustomStages(config.Stages, m)
+	tp := config.TracerProvider
+	if tp == nil {
+		tp = trace.NewNoopTracerProvider()
+	}
+	am.tracer = tp.Tracer(tracing.InstrumentationName)
+	am.templateValidation = config.TemplateValidation
+	am.auditSink = config.AuditSink
+
 	var err error
 
 	// Initialize silences
@@ -248,12 +410,98 @@ func NewGrafanaAlertmanager(tenantKey string, tenantID int64, config *GrafanaAle
 		am.wg.Done()
 	}()
 
+	// Initialize the acknowledgements of the alert groups
+	var ackFile string
+	var ackRetention time.Duration
+	ackInterval := defaultAcknowledgementsGCInterval
+	if p := config.Acknowledgements; p != nil {
+		ackFile, ackRetention, ackInterval = p.Filepath(), p.Retention(), p.MaintenanceFrequency()
+	}
+	am.acknowledgements, err = newAcknowledgements(ackFile, ackRetention)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize the acknowledgements component of alerting: %w", err)
+	}
+	c = am.peer.AddState(fmt.Sprintf("acknowledgements:%d", am.tenantID), am.acknowledgements, m.Registerer)
+	am.acknowledgements.setBroadcast(c.Broadcast)
+
+	am.startMaintenance("acknowledgements", ackInterval, config.Acknowledgements, am.acknowledgements, func() {
+		am.acknowledgements.gc(time.Now())
+	})
+
+	// Initialize the escalations of the alert groups
+	escFile, escRetention, escInterval := "", config.Nflog.Retention(), config.Nflog.MaintenanceFrequency()
+	if p := config.Escalations; p != nil {
+		escFile, escRetention, escInterval = p.Filepath(), p.Retention(), p.MaintenanceFrequency()
+	}
+	am.escalations, err = newEscalations(escFile, escRetention)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize the escalations component of alerting: %w", err)
+	}
+	c = am.peer.AddState(fmt.Sprintf("escalations:%d", am.tenantID), am.escalations, m.Registerer)
+	am.escalations.setBroadcast(c.Broadcast)
+
+	am.startMaintenance("escalations", escInterval, config.Escalations, am.escalations, func() {
+		am.escalations.gc(time.Now())
+	})
+
+	// Initialize the digests of receivers
+	var digestFile string
+	if p := config.Digests; p != nil {
+		digestFile = p.Filepath()
+	}
+	am.digests, err = newDigests(digestFile, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize the digests component of alerting: %w", err)
+	}
+	if p := config.Digests; p != nil {
+		am.digests.retention = p.Retention()
+		am.startMaintenance("digests", p.MaintenanceFrequency(), p, am.digests, func() {
+			am.digests.gc(time.Now())
+		})
+	}
+
+	// Initialize the dead-letter store
+	if config.DeadLetters != nil {
+		am.deadLetters, err = newDeadLetters(config.DeadLetters.Filepath(), config.DeadLetters.Retention())
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize the dead-letter store of alerting: %w", err)
+		}
+
+		am.startMaintenance("dead-letter store", config.DeadLetters.MaintenanceFrequency(), config.DeadLetters, am.deadLetters, func() {
+			am.deadLetters.gc(time.Now())
+		})
+	}
+
+	// Initialize the alert history
+	if config.AlertHistory != nil {
+		am.history, err = newAlertHistory(config.AlertHistory)
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize the alert history of alerting: %w", err)
+		}
+		am.marker = &historyMarker{Marker: am.marker, history: am.history, getAlert: func(fp model.Fingerprint) (*types.Alert, error) {
+			return am.alerts.Get(fp)
+		}}
+
+		interval := defaultAlertHistoryGCInterval
+		if p := config.AlertHistory.Persistence; p != nil {
+			interval = p.MaintenanceFrequency()
+		}
+		am.startMaintenance("alert history", interval, config.AlertHistory.Persistence, am.history, am.history.gc)
+	}
+
 	// Initialize in-memory alerts
-	am.alerts, err = mem.NewAlerts(context.Background(), am.marker, memoryAlertsGCInterval, config.AlertStoreCallback, am.logger, m.Registerer)
+	am.receipts = newAlertReceipts()
+	am.activeAlerts = newActiveAlerts()
+	am.alerts, err = mem.NewAlerts(context.Background(), am.marker, memoryAlertsGCInterval, alertStoreCallback{am: am, next: config.AlertStoreCallback}, am.logger, m.Registerer)
 	if err != nil {
 		return nil, fmt.Errorf("unable to initialize the alert provider component of alerting: %w", err)
 	}
 
+	am.aggrGroups = newAggrGroupsCollector(am)
+	if m.Registerer != nil {
+		m.Registerer.MustRegister(am.aggrGroups)
+	}
+
 	return am, nil
 }
 
@@ -282,9 +530,24 @@ func (am *GrafanaAlertmanager) StopAndWait() {
 
 	am.alerts.Close()
 
+	am.stopDigesters()
+
 	close(am.stopc)
 
 	am.wg.Wait()
+
+	// The dispatcher is stopped, the summaries of the suppressed notifications are the last notifications.
+	limiters := make([]*rateLimiter, 0, len(am.rateLimiters))
+	for _, l := range am.rateLimiters {
+		limiters = append(limiters, l)
+	}
+	stopRateLimiters(limiters)
+
+	if am.Metrics.Registerer != nil {
+		am.Metrics.Registerer.Unregister(am.aggrGroups)
+	}
+	// The metrics of a tenant are registered again by its next Alertmanager.
+	am.Metrics.unregisterTenant()
 }
 
 // GetReceivers returns the receivers configured as part of the current configuration.
@@ -336,17 +599,119 @@ func (am *GrafanaAlertmanager) buildMuteTimesMap(muteTimeIntervals []config.Mute
 	return muteTimes
 }
 
+// newTimeStage creates the stage that drops the notifications of routes that are within one of their
+// mute_time_intervals or, if they have active_time_intervals, outside all of them.
+func newTimeStage(muteTimes map[string][]timeinterval.TimeInterval) notify.Stage {
+	return notify.MultiStage{notify.NewTimeMuteStage(muteTimes), notify.NewTimeActiveStage(muteTimes)}
+}
+
+// validateRouteTimeIntervals checks that every time interval referenced by the routing tree is defined.
+func validateRouteTimeIntervals(r *Route, muteTimes map[string][]timeinterval.TimeInterval) error {
+	if r == nil {
+		return nil
+	}
+	for _, names := range [][]string{r.MuteTimeIntervals, r.ActiveTimeIntervals} {
+		for _, name := range names {
+			if _, ok := muteTimes[name]; !ok {
+				return fmt.Errorf("undefined time interval %q used in route", name)
+			}
+		}
+	}
+	for _, child := range r.Routes {
+		if err := validateRouteTimeIntervals(child, muteTimes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ApplyConfig applies a new configuration by re-initializing all components using the configuration provided.
 // It is not safe to call concurrently.
-func (am *GrafanaAlertmanager) ApplyConfig(cfg Configuration) (err error) {
+func (am *GrafanaAlertmanager) ApplyConfig(cfg Configuration) error {
+	return am.ApplyConfigWithContext(context.Background(), cfg)
+}
+
+// ApplyConfigWithContext is like ApplyConfig, and the change is audited with the actor of the context.
+func (am *GrafanaAlertmanager) ApplyConfigWithContext(ctx context.Context, cfg Configuration) (err error) {
+	if am.auditSink != nil {
+		summary := newConfigSummary(cfg)
+		defer func() {
+			am.audit(ctx, AuditEvent{Action: AuditApplyConfig, ConfigDiff: summary.diff(am.configSummary)}, err)
+			if err == nil {
+				am.configSummary = summary
+			}
+		}()
+	}
+
 	// Finally, build the integrations map using the receiver configuration and templates.
 	integrationsMap, err := cfg.ReceiverIntegrations()
 	if err != nil {
 		return fmt.Errorf("failed to build integration map: %w", err)
 	}
+	integrationsMap = am.instrumentIntegrations(integrationsMap)
+
+	retryPolicies := cfg.RetryPolicies()
+	for name, p := range retryPolicies {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("invalid retry policy for receiver %q: %w", name, err)
+		}
+	}
+
+	rateLimits := cfg.RateLimits()
+	for name, l := range rateLimits {
+		if err := l.Validate(); err != nil {
+			return fmt.Errorf("invalid rate limit for receiver %q: %w", name, err)
+		}
+	}
+
+	ingestionLimits := cfg.IngestionLimits()
+	if err := ingestionLimits.Validate(); err != nil {
+		return fmt.Errorf("invalid ingestion limits: %w", err)
+	}
+
+	relabelRules, err := newRelabelRules(cfg.AlertRelabelConfigs())
+	if err != nil {
+		return err
+	}
+
+	digestConfigs := cfg.Digests()
+	for name, d := range digestConfigs {
+		if err := d.Validate(); err != nil {
+			return fmt.Errorf("invalid digest for receiver %q: %w", name, err)
+		}
+		// The digest already bounds the notifications of the receiver to one per schedule.
+		if _, ok := rateLimits[name]; ok {
+			return fmt.Errorf("invalid digest for receiver %q: a receiver with a digest cannot have a rate limit", name)
+		}
+	}
+
+	escalationPolicies := make(map[string]EscalationPolicy)
+	for _, p := range cfg.EscalationPolicies() {
+		if err := p.Validate(integrationsMap); err != nil {
+			return fmt.Errorf("invalid escalation policy %q: %w", p.Name, err)
+		}
+		if _, ok := escalationPolicies[p.Name]; ok {
+			return fmt.Errorf("duplicate escalation policy %q", p.Name)
+		}
+		escalationPolicies[p.Name] = p
+	}
+
+	if am.templateValidation != TemplateValidationDisabled {
+		if err := ValidateReceiverTemplates(cfg.Templates(), cfg.Receivers()); err != nil {
+			if am.templateValidation == TemplateValidationStrict {
+				return err
+			}
+			level.Warn(am.logger).Log("msg", "Configuration has receivers with invalid templates", "err", err)
+		}
+	}
+
+	muteTimes := am.buildMuteTimesMap(cfg.MuteTimeIntervals())
+	if err := validateRouteTimeIntervals(cfg.RoutingTree(), muteTimes); err != nil {
+		return err
+	}
 
 	// Now, let's put together our notification pipeline
-	routingStage := make(notify.RoutingStage, len(integrationsMap))
+	routingStage := make(notify.RoutingStage, len(integrationsMap)+len(escalationPolicies))
 
 	if am.inhibitor != nil {
 		am.inhibitor.Stop()
@@ -355,43 +720,111 @@ func (am *GrafanaAlertmanager) ApplyConfig(cfg Configuration) (err error) {
 		am.dispatcher.Stop()
 	}
 
-	am.inhibitor = inhibit.NewInhibitor(am.alerts, cfg.InhibitRules(), am.marker, am.logger)
-	am.muteTimes = am.buildMuteTimesMap(cfg.MuteTimeIntervals())
+	am.inhibitRules = cfg.InhibitRules()
+	if m, ok := am.marker.(*historyMarker); ok {
+		m.setInhibitRules(am.inhibitRules)
+	}
+	am.inhibitor = inhibit.NewInhibitor(am.alerts, am.inhibitRules, am.marker, am.logger)
+	am.muteTimes = muteTimes
 	am.silencer = silence.NewSilencer(am.silences, am.marker, am.logger)
 
 	meshStage := notify.NewGossipSettleStage(am.peer)
 	inhibitionStage := notify.NewMuteStage(am.inhibitor)
-	timeMuteStage := notify.NewTimeMuteStage(am.muteTimes)
+	ackStage := &acknowledgementStage{acks: am.acknowledgements}
+	timeStage := newTimeStage(am.muteTimes)
 	silencingStage := notify.NewMuteStage(am.silencer)
 
 	am.route = dispatch.NewRoute(cfg.RoutingTree(), nil)
-	am.dispatcher = dispatch.NewDispatcher(am.alerts, am.route, routingStage, am.marker, am.timeoutFunc, cfg.DispatcherLimits(), am.logger, am.dispatcherMetrics)
+	var pipeline notify.Stage = routingStage
+	if preRoute := am.customStages[StageHookPreRoute]; len(preRoute) > 0 {
+		pipeline = append(append(notify.MultiStage{}, preRoute...), routingStage)
+	}
+
+	if am.history != nil {
+		pipeline = &historyFlushStage{next: pipeline, history: am.history}
+	}
+	pipeline = &flushStage{next: pipeline, tracer: am.tracer}
+
+	am.dispatcher = dispatch.NewDispatcher(am.alerts, am.route, pipeline, am.marker, am.timeoutFunc, cfg.DispatcherLimits(), am.logger, am.dispatcherMetrics)
 
 	// TODO: This has not been upstreamed yet. Should be aligned when https://github.com/prometheus/alertmanager/pull/3016 is merged.
+	am.retryPolicies = retryPolicies
+	am.receiverDigests = make(map[string][32]byte)
+	for _, r := range cfg.Receivers() {
+		am.receiverDigests[r.Name] = digest(r)
+	}
+	if am.circuitBreakers == nil {
+		am.circuitBreakers = make(map[circuitBreakerKey]*circuitBreaker)
+	}
+	if am.rateLimiters == nil {
+		am.rateLimiters = make(map[rateLimitKey]*rateLimiter)
+		am.receiverBuckets = make(map[rateLimitKey]*tokenBucket)
+	}
+	am.rateLimits = rateLimits
+	am.stopDigesters()
+	am.digestConfigs = digestConfigs
+
 	var receivers []*notify.Receiver
 	activeReceivers := am.getActiveReceiversMap(am.route)
+	for name, p := range escalationPolicies {
+		if _, ok := activeReceivers[name]; ok {
+			for _, s := range p.Steps {
+				activeReceivers[s.Receiver] = struct{}{}
+			}
+		}
+	}
 	for name := range integrationsMap {
 		stage := am.createReceiverStage(name, integrationsMap[name], am.waitFunc, am.notificationLog)
-		routingStage[name] = notify.MultiStage{meshStage, silencingStage, timeMuteStage, inhibitionStage, stage}
+		routingStage[name] = notify.MultiStage{
+			meshStage,
+			am.newSuppressionStage(newTracedStage("notify.silence", silencingStage), name, suppressedBySilence),
+			am.newSuppressionStage(newTracedStage("notify.time_intervals", timeStage), name, suppressedByMuteTime),
+			am.newSuppressionStage(newTracedStage("notify.inhibition", inhibitionStage), name, suppressedByInhibition),
+			am.newSuppressionStage(newTracedStage("notify.acknowledgement", ackStage), name, suppressedByAcknowledgement),
+			stage,
+		}
 		_, isActive := activeReceivers[name]
 
 		receivers = append(receivers, notify.NewReceiver(name, isActive, integrationsMap[name]))
 	}
 	am.receivers = receivers
+	am.startDigesters()
+	am.dropCircuitBreakers(integrationsMap)
+	am.dropRateLimiters(integrationsMap)
+
+	for name, p := range escalationPolicies {
+		stages := make([]notify.Stage, 0, len(p.Steps))
+		for _, s := range p.Steps {
+			stages = append(stages, routingStage[s.Receiver])
+		}
+		// An acknowledged group does not escalate further.
+		routingStage[name] = notify.MultiStage{
+			am.newSuppressionStage(newTracedStage("notify.acknowledgement", ackStage), name, suppressedByAcknowledgement),
+			newTracedStage("notify.escalation", &escalationStage{
+				policy:      p,
+				stages:      stages,
+				escalations: am.escalations,
+			}),
+		}
+	}
+	am.escalationPolicies = escalationPolicies
 	am.buildReceiverIntegrationFunc = cfg.BuildReceiverIntegrationsFunc()
 
+	dispatcher, inhibitor := am.dispatcher, am.inhibitor
 	am.wg.Add(1)
 	go func() {
 		defer am.wg.Done()
-		am.dispatcher.Run()
+		dispatcher.Run()
 	}()
 
 	am.wg.Add(1)
 	go func() {
 		defer am.wg.Done()
-		am.inhibitor.Run()
+		inhibitor.Run()
 	}()
 
+	am.ingestionLimits = ingestionLimits
+	am.relabelRules = relabelRules
 	am.configHash = cfg.Hash()
 	am.config = cfg.Raw()
 	am.templates = cfg.Templates()
@@ -400,15 +833,47 @@ func (am *GrafanaAlertmanager) ApplyConfig(cfg Configuration) (err error) {
 }
 
 // PutAlerts receives the alerts and then sends them through the corresponding route based on whenever the alert has a receiver embedded or not
-func (am *GrafanaAlertmanager) PutAlerts(postableAlerts amv2.PostableAlerts) error {
+func (am *GrafanaAlertmanager) PutAlerts(postableAlerts amv2.PostableAlerts) (err error) {
+	_, span := am.tracer.Start(context.Background(), "alertmanager.PutAlerts", trace.WithAttributes(attribute.Int("alerts", len(postableAlerts))))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	am.reloadConfigMtx.RLock()
+	limits := am.ingestionLimits
+	relabelRules := am.relabelRules
+	am.reloadConfigMtx.RUnlock()
+
 	now := time.Now()
 	alerts := make([]*types.Alert, 0, len(postableAlerts))
 	var validationErr *AlertValidationError
-	for _, a := range postableAlerts {
+	reject := func(a *amv2.PostableAlert, reason AlertRejectionReason, err error) {
+		if validationErr == nil {
+			validationErr = &AlertValidationError{}
+		}
+		validationErr.Alerts = append(validationErr.Alerts, a)
+		validationErr.Errors = append(validationErr.Errors, err)
+		am.Metrics.RejectedAlerts.WithLabelValues(string(reason)).Inc()
+	}
+	for i, a := range postableAlerts {
+		if limits.MaxAlertsPerRequest > 0 && i >= limits.MaxAlertsPerRequest {
+			reject(a, AlertRejectionMaxAlertsPerRequest, newAlertLimitError(AlertRejectionMaxAlertsPerRequest,
+				"request has %d alerts, more than the limit of %d", len(postableAlerts), limits.MaxAlertsPerRequest))
+			continue
+		}
+
+		labels, annotations := postableAlertLabels(a)
+		if len(relabelRules) > 0 {
+			if labels, _ = relabel(relabelRules, labels, annotations); labels == nil {
+				am.Metrics.RelabelDroppedAlerts.Inc()
+				continue
+			}
+		}
+
 		alert := &types.Alert{
 			Alert: model.Alert{
-				Labels:       model.LabelSet{},
-				Annotations:  model.LabelSet{},
+				Labels:       labels,
+				Annotations:  annotations,
 				StartsAt:     time.Time(a.StartsAt),
 				EndsAt:       time.Time(a.EndsAt),
 				GeneratorURL: a.GeneratorURL.String(),
@@ -416,21 +881,6 @@ func (am *GrafanaAlertmanager) PutAlerts(postableAlerts amv2.PostableAlerts) err
 			UpdatedAt: now,
 		}
 
-		for k, v := range a.Labels {
-			if len(v) == 0 || k == models.NamespaceUIDLabel { // Skip empty and namespace UID labels.
-				continue
-			}
-
-			alert.Alert.Labels[model.LabelName(k)] = model.LabelValue(v)
-		}
-
-		for k, v := range a.Annotations {
-			if len(v) == 0 { // Skip empty annotation.
-				continue
-			}
-			alert.Alert.Annotations[model.LabelName(k)] = model.LabelValue(v)
-		}
-
 		// Ensure StartsAt is set.
 		if alert.StartsAt.IsZero() {
 			if alert.EndsAt.IsZero() {
@@ -453,22 +903,36 @@ func (am *GrafanaAlertmanager) PutAlerts(postableAlerts amv2.PostableAlerts) err
 		}
 
 		if err := validateAlert(alert); err != nil {
-			if validationErr == nil {
-				validationErr = &AlertValidationError{}
-			}
-			validationErr.Alerts = append(validationErr.Alerts, a)
-			validationErr.Errors = append(validationErr.Errors, err)
+			reject(a, AlertRejectionInvalid, err)
 			am.Metrics.Invalid().Inc()
 			continue
 		}
+		if err := limits.checkAlert(alert); err != nil {
+			reject(a, err.Reason, err)
+			continue
+		}
+		if limits.MaxActiveAlerts > 0 && !alert.ResolvedAt(now) {
+			// The alert is counted as soon as it is accepted, so that concurrent requests cannot exceed the limit.
+			if n, ok := am.activeAlerts.reserve(alert, limits.MaxActiveAlerts, now); !ok {
+				reject(a, AlertRejectionMaxActiveAlerts, newAlertLimitError(AlertRejectionMaxActiveAlerts,
+					"the tenant has %d active alerts, the limit", n))
+				continue
+			}
+		}
 
 		alerts = append(alerts, alert)
 	}
 
-	if err := am.alerts.Put(alerts...); err != nil {
+	err = am.alerts.Put(alerts...)
+	// The store skips the alerts that its callback rejects, they do not count as active.
+	am.activeAlerts.release(alerts...)
+	if err != nil {
 		// Notification sending alert takes precedence over validation errors.
 		return err
 	}
+	if am.history != nil {
+		am.history.received(alerts...)
+	}
 	if validationErr != nil {
 		// Even if validationErr is nil, the require.NoError fails on it.
 		return validationErr
@@ -522,7 +986,8 @@ func isValidLabelName(ln model.LabelName) bool {
 }
 
 // AlertValidationError is the error capturing the validation errors
-// faced on the alerts.
+// faced on the alerts. The errors of the alerts rejected by an ingestion
+// limit are *AlertLimitError, with the reason.
 type AlertValidationError struct {
 	Alerts amv2.PostableAlerts
 	Errors []error // Errors[i] refers to Alerts[i].
@@ -541,6 +1006,16 @@ func (e AlertValidationError) Error() string {
 
 // createReceiverStage creates a pipeline of stages for a receiver.
 func (am *GrafanaAlertmanager) createReceiverStage(name string, integrations []*notify.Integration, wait func() time.Duration, notificationLog notify.NotificationLog) notify.Stage {
+	var receiverBucket *tokenBucket
+	rateLimit, hasRateLimit := am.rateLimits[name]
+	if hasRateLimit && rateLimit.Receiver != nil {
+		key := receiverBucketKey(name, rateLimit)
+		if receiverBucket = am.receiverBuckets[key]; receiverBucket == nil {
+			receiverBucket = newTokenBucket(*rateLimit.Receiver, time.Now())
+			am.receiverBuckets[key] = receiverBucket
+		}
+	}
+
 	var fs notify.FanoutStage
 	for i := range integrations {
 		recv := &nflogpb.Receiver{
@@ -550,15 +1025,173 @@ func (am *GrafanaAlertmanager) createReceiverStage(name string, integrations []*
 		}
 		var s notify.MultiStage
 		s = append(s, notify.NewWaitStage(wait))
-		s = append(s, notify.NewDedupStage(integrations[i], notificationLog, recv))
-		s = append(s, notify.NewRetryStage(integrations[i], name, am.stageMetrics))
+		s = append(s, newTracedStage("notify.dedup", notify.NewDedupStage(integrations[i], notificationLog, recv)))
+		s = append(s, am.customStages[StageHookPreIntegration]...)
+
+		notifyStage := newTracedStage("notify.retry", am.createRetryStage(name, integrations[i]))
+		notifyStage = &outcomeStage{
+			next:          notifyStage,
+			notifications: am.Metrics.ReceiverNotifications,
+			alerts:        am.Metrics.ReceiverAlerts,
+			receiver:      name,
+			integration:   integrations[i].String(),
+		}
+		if am.deadLetters != nil {
+			notifyStage = &deadLetterStage{next: notifyStage, store: am.deadLetters, recv: recv}
+		}
+		if am.history != nil {
+			notifyStage = &historyStage{next: notifyStage, history: am.history, receiver: name, integration: integrations[i].String()}
+		}
+		if digest, ok := am.digestConfigs[name]; ok {
+			// The notifications are collected into the digest, which is sent through the stage that sends them.
+			schedule, _ := digest.schedule()
+			d := newDigester(integrations[i], name, notifyStage, schedule, am.digests, am.getTemplate, am.Metrics.DigestedNotifications.WithLabelValues(name, integrations[i].String()), am.logger)
+			am.digesters = append(am.digesters, d)
+			notifyStage = &digestStage{digester: d}
+		} else if hasRateLimit {
+			// The limiter of an unchanged rate limit is kept, with its tokens and suppressed notifications.
+			key := rateLimiterKey(name, integrations[i], rateLimit)
+			limiter, ok := am.rateLimiters[key]
+			if !ok {
+				var bucket *tokenBucket
+				if rateLimit.Integration != nil {
+					bucket = newTokenBucket(*rateLimit.Integration, time.Now())
+				}
+				limiter = newRateLimiter(name, integrations[i].String(), bucket, receiverBucket, am.Metrics.RateLimitedNotifications.WithLabelValues(name, integrations[i].String()), am.logger)
+				am.rateLimiters[key] = limiter
+			}
+			limiter.use(notifyStage)
+			notifyStage = &rateLimitStage{limiter: limiter, integration: integrations[i], next: notifyStage}
+		}
+		s = append(s, notifyStage)
 		s = append(s, notify.NewSetNotifiesStage(notificationLog, recv))
+		s = append(s, am.customStages[StageHookPostNotify]...)
 
-		fs = append(fs, s)
+		fs = append(fs, newTracedStage("notify.integration", s, attribute.String("integration", integrations[i].String())))
+	}
+	if receiverBucket != nil {
+		return &receiverRateLimitStage{next: fs}
 	}
 	return fs
 }
 
+// createRetryStage creates the stage that sends the notifications of an integration, which applies the receiver's
+// retry policy if it has one.
+func (am *GrafanaAlertmanager) createRetryStage(name string, integration *notify.Integration) notify.Stage {
+	policy, ok := am.retryPolicies[name]
+	if !ok {
+		return notify.NewRetryStage(integration, name, am.stageMetrics)
+	}
+
+	var breaker *circuitBreaker
+	if key, ok := am.circuitBreakerKey(name, integration); ok {
+		// The breaker of an unchanged integration is kept, so that an open circuit stays open.
+		if breaker, ok = am.circuitBreakers[key]; !ok {
+			breaker = newCircuitBreaker(*policy.CircuitBreaker, am.Metrics.CircuitBreakerState.WithLabelValues(name, integration.String()))
+			am.circuitBreakers[key] = breaker
+		}
+	}
+	return newRetryStage(integration, name, policy, breaker, am.Metrics)
+}
+
+// circuitBreakerKey returns the key of the circuit breaker of an integration, if the retry policy of its receiver has
+// a circuit breaker.
+func (am *GrafanaAlertmanager) circuitBreakerKey(receiver string, integration *notify.Integration) (circuitBreakerKey, bool) {
+	policy, ok := am.retryPolicies[receiver]
+	if !ok || policy.CircuitBreaker == nil {
+		return circuitBreakerKey{}, false
+	}
+	return circuitBreakerKey{
+		receiver:    receiver,
+		integration: integration.String(),
+		config:      digest([]interface{}{am.receiverDigests[receiver], policy.CircuitBreaker}),
+	}, true
+}
+
+// dropCircuitBreakers drops the circuit breakers of the previous configurations that the integrations of the current
+// one do not use, and the state metric of the integrations that do not have a circuit breaker anymore.
+func (am *GrafanaAlertmanager) dropCircuitBreakers(integrationsMap map[string][]*notify.Integration) {
+	used := make(map[circuitBreakerKey]struct{})
+	labels := make(map[[2]string]struct{})
+	for name, integrations := range integrationsMap {
+		for _, i := range integrations {
+			if key, ok := am.circuitBreakerKey(name, i); ok {
+				used[key] = struct{}{}
+				labels[[2]string{key.receiver, key.integration}] = struct{}{}
+			}
+		}
+	}
+	for key := range am.circuitBreakers {
+		if _, ok := used[key]; ok {
+			continue
+		}
+		delete(am.circuitBreakers, key)
+		if _, ok := labels[[2]string{key.receiver, key.integration}]; !ok {
+			am.Metrics.CircuitBreakerState.DeleteLabelValues(key.receiver, key.integration)
+		}
+	}
+}
+
+// dropRateLimiters drops the rate limiters and the receiver buckets of the previous configurations that the current
+// one does not use. The dropped limiters send the summaries of their suppressed notifications in the background.
+func (am *GrafanaAlertmanager) dropRateLimiters(integrationsMap map[string][]*notify.Integration) {
+	usedLimiters := make(map[rateLimitKey]struct{})
+	usedBuckets := make(map[rateLimitKey]struct{})
+	for name, integrations := range integrationsMap {
+		l, ok := am.rateLimits[name]
+		if !ok {
+			continue
+		}
+		if l.Receiver != nil {
+			usedBuckets[receiverBucketKey(name, l)] = struct{}{}
+		}
+		for _, i := range integrations {
+			usedLimiters[rateLimiterKey(name, i, l)] = struct{}{}
+		}
+	}
+
+	var dropped []*rateLimiter
+	for key, l := range am.rateLimiters {
+		if _, ok := usedLimiters[key]; !ok {
+			delete(am.rateLimiters, key)
+			dropped = append(dropped, l)
+		}
+	}
+	for key := range am.receiverBuckets {
+		if _, ok := usedBuckets[key]; !ok {
+			delete(am.receiverBuckets, key)
+		}
+	}
+	if len(dropped) > 0 {
+		am.wg.Add(1)
+		go func() {
+			defer am.wg.Done()
+			stopRateLimiters(dropped)
+		}()
+	}
+}
+
+// startDigesters schedules the digests of the current configuration, and drops the pending content of the digests
+// which are not in the configuration anymore.
+func (am *GrafanaAlertmanager) startDigesters() {
+	keys := make(map[string]struct{}, len(am.digesters))
+	for _, d := range am.digesters {
+		keys[d.key()] = struct{}{}
+		d.start()
+	}
+	if n := am.digests.retain(keys); n > 0 {
+		level.Info(am.logger).Log("msg", "dropped the pending content of digests removed from the configuration", "digests", n)
+	}
+}
+
+// stopDigesters stops the digesters of the current configuration. Their pending content is kept.
+func (am *GrafanaAlertmanager) stopDigesters() {
+	for _, d := range am.digesters {
+		d.stop()
+	}
+	am.digesters = nil
+}
+
 // getActiveReceiversMap returns all receivers that are in use by a route.
 func (am *GrafanaAlertmanager) getActiveReceiversMap(r *dispatch.Route) map[string]struct{} {
 	receiversMap := make(map[string]struct{})
@@ -1,6 +1,9 @@
 package notify
 
 import (
+	"strconv"
+	"sync"
+
 	"github.com/prometheus/alertmanager/api/metrics"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -8,12 +11,174 @@ import (
 type GrafanaAlertmanagerMetrics struct {
 	Registerer prometheus.Registerer
 	*metrics.Alerts
+
+	// shared is whether the registry is shared by the Alertmanagers of several tenants.
+	shared bool
+
+	CustomStageErrors   *prometheus.CounterVec
+	NotificationRetries *prometheus.CounterVec
+	FailedNotifications *prometheus.CounterVec
+	CircuitBreakerState *prometheus.GaugeVec
+
+	RateLimitedNotifications *prometheus.CounterVec
+	DigestedNotifications    *prometheus.CounterVec
+
+	RejectedAlerts       *prometheus.CounterVec
+	RelabelDroppedAlerts prometheus.Counter
+
+	NotificationLatency        *prometheus.HistogramVec
+	IntegrationRequestDuration *prometheus.HistogramVec
+	ReceiverNotifications      *prometheus.CounterVec
+	ReceiverAlerts             *prometheus.CounterVec
+	SuppressedNotifications    *prometheus.CounterVec
+	SuppressedAlerts           *prometheus.CounterVec
 }
 
 // NewGrafanaAlertmanagerMetrics creates a set of metrics for the Alertmanager.
 func NewGrafanaAlertmanagerMetrics(r prometheus.Registerer) *GrafanaAlertmanagerMetrics {
-	return &GrafanaAlertmanagerMetrics{
+	m := &GrafanaAlertmanagerMetrics{
 		Registerer: r,
 		Alerts:     metrics.NewAlerts("grafana", r),
+		CustomStageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "alertmanager",
+			Name:      "custom_stage_errors_total",
+			Help:      "The total number of errors returned by custom notification pipeline stages.",
+		}, []string{"hook", "stage"}),
+		NotificationRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "alertmanager",
+			Name:      "notification_retries_total",
+			Help:      "The total number of notification attempts retried by a receiver retry policy.",
+		}, []string{"receiver", "integration"}),
+		FailedNotifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "alertmanager",
+			Name:      "receiver_notifications_failed_total",
+			Help:      "The total number of notifications given up by a receiver retry policy, by reason.",
+		}, []string{"receiver", "integration", "reason"}),
+		CircuitBreakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "alertmanager",
+			Name:      "integration_circuit_breaker_state",
+			Help:      "The state of the circuit breaker of an integration: 0 closed, 1 half-open, 2 open.",
+		}, []string{"receiver", "integration"}),
+		RateLimitedNotifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "alertmanager",
+			Name:      "notifications_rate_limited_total",
+			Help:      "The total number of notifications suppressed by the rate limit of their receiver.",
+		}, []string{"receiver", "integration"}),
+		DigestedNotifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "alertmanager",
+			Name:      "notifications_digested_total",
+			Help:      "The total number of notifications collected into the digest of their receiver instead of being sent.",
+		}, []string{"receiver", "integration"}),
+		RejectedAlerts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "alertmanager",
+			Name:      "rejected_alerts_total",
+			Help:      "The total number of alerts rejected by PutAlerts, by reason: invalid or the ingestion limit exceeded.",
+		}, []string{"reason"}),
+		RelabelDroppedAlerts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "alertmanager",
+			Name:      "relabel_dropped_alerts_total",
+			Help:      "The total number of alerts dropped by the alert relabel configs.",
+		}),
+		NotificationLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "alertmanager",
+			Name:      "notification_e2e_latency_seconds",
+			Help:      "The latency from the time alerts are received, firing or resolved, to the time they are first delivered in that state by an integration.",
+			Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+		}, []string{"receiver", "integration"}),
+		IntegrationRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "alertmanager",
+			Name:      "integration_request_duration_seconds",
+			Help:      "The duration of the attempts of integrations to send notifications.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"receiver", "integration"}),
+		ReceiverNotifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "alertmanager",
+			Name:      "receiver_notifications_total",
+			Help:      "The total number of notifications of a receiver, by status: sent or failed.",
+		}, []string{"receiver", "integration", "status"}),
+		ReceiverAlerts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "alertmanager",
+			Name:      "receiver_alerts_total",
+			Help:      "The total number of alerts in the notifications of a receiver, by status: sent or failed.",
+		}, []string{"receiver", "integration", "status"}),
+		SuppressedNotifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "alertmanager",
+			Name:      "receiver_notifications_suppressed_total",
+			Help:      "The total number of notifications of a receiver suppressed by silences, inhibition or time intervals.",
+		}, []string{"receiver", "reason"}),
+		SuppressedAlerts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "alertmanager",
+			Name:      "receiver_alerts_suppressed_total",
+			Help:      "The total number of alerts removed from the notifications of a receiver by silences, inhibition or time intervals.",
+		}, []string{"receiver", "reason"}),
+	}
+
+	if r != nil {
+		r.MustRegister(m.CustomStageErrors, m.NotificationRetries, m.FailedNotifications, m.CircuitBreakerState, m.RateLimitedNotifications, m.DigestedNotifications, m.RejectedAlerts, m.RelabelDroppedAlerts,
+			m.NotificationLatency, m.IntegrationRequestDuration, m.ReceiverNotifications, m.ReceiverAlerts, m.SuppressedNotifications, m.SuppressedAlerts)
+	}
+
+	return m
+}
+
+// NewSharedGrafanaAlertmanagerMetrics creates the metrics of the Alertmanagers of several tenants that share the
+// registry. Each Alertmanager registers its own metrics with a tenant label, so a tenant must not have more than one
+// Alertmanager at a time. The metrics of a tenant are unregistered when its Alertmanager stops.
+func NewSharedGrafanaAlertmanagerMetrics(r prometheus.Registerer) *GrafanaAlertmanagerMetrics {
+	m := NewGrafanaAlertmanagerMetrics(nil)
+	m.Registerer = r
+	m.shared = true
+	return m
+}
+
+// forTenant returns the metrics of the Alertmanager of the tenant.
+func (m *GrafanaAlertmanagerMetrics) forTenant(tenantID int64) *GrafanaAlertmanagerMetrics {
+	if !m.shared || m.Registerer == nil {
+		return m
+	}
+	return NewGrafanaAlertmanagerMetrics(&tenantRegisterer{
+		Registerer: prometheus.WrapRegistererWith(prometheus.Labels{"tenant": strconv.FormatInt(tenantID, 10)}, m.Registerer),
+	})
+}
+
+// unregisterTenant unregisters the metrics of the tenant, if they are in a shared registry.
+func (m *GrafanaAlertmanagerMetrics) unregisterTenant() {
+	if r, ok := m.Registerer.(*tenantRegisterer); ok {
+		r.unregisterAll()
+	}
+}
+
+// tenantRegisterer keeps the collectors of a tenant that it registers, to unregister them when its Alertmanager stops.
+type tenantRegisterer struct {
+	prometheus.Registerer
+
+	mtx        sync.Mutex
+	collectors []prometheus.Collector
+}
+
+func (r *tenantRegisterer) Register(c prometheus.Collector) error {
+	if err := r.Registerer.Register(c); err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.collectors = append(r.collectors, c)
+	return nil
+}
+
+func (r *tenantRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (r *tenantRegisterer) unregisterAll() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, c := range r.collectors {
+		r.Registerer.Unregister(c)
 	}
+	r.collectors = nil
 }
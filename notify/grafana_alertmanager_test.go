@@ -11,7 +11,9 @@ import (
 	"github.com/go-openapi/strfmt"
 	"github.com/prometheus/alertmanager/api/v2/models"
 	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/notify"
 	"github.com/prometheus/alertmanager/provider/mem"
+	"github.com/prometheus/alertmanager/timeinterval"
 	"github.com/prometheus/alertmanager/types"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
@@ -309,6 +311,86 @@ func TestPutAlert(t *testing.T) {
 	}
 }
 
+func TestTimeStage(t *testing.T) {
+	muteTimes := map[string][]timeinterval.TimeInterval{
+		"office-hours": {{Times: []timeinterval.TimeRange{{StartMinute: 9 * 60, EndMinute: 17 * 60}}}},
+		"lunch":        {{Times: []timeinterval.TimeRange{{StartMinute: 12 * 60, EndMinute: 13 * 60}}}},
+	}
+	stage := newTimeStage(muteTimes)
+	alerts := []*types.Alert{{Alert: model.Alert{Labels: model.LabelSet{"alertname": "test"}}}}
+	day := time.Date(2023, time.January, 2, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name    string
+		mute    []string
+		active  []string
+		now     time.Time
+		expSent bool
+	}{
+		{
+			name:    "without time intervals",
+			now:     day.Add(3 * time.Hour),
+			expSent: true,
+		}, {
+			name:    "within active time interval",
+			active:  []string{"office-hours"},
+			now:     day.Add(10 * time.Hour),
+			expSent: true,
+		}, {
+			name:   "outside active time interval",
+			active: []string{"office-hours"},
+			now:    day.Add(20 * time.Hour),
+		}, {
+			name:   "within both active and mute time intervals",
+			mute:   []string{"lunch"},
+			active: []string{"office-hours"},
+			now:    day.Add(12*time.Hour + 30*time.Minute),
+		}, {
+			name:    "within active time interval and outside mute time interval",
+			mute:    []string{"lunch"},
+			active:  []string{"office-hours"},
+			now:     day.Add(14 * time.Hour),
+			expSent: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := notify.WithNow(context.Background(), c.now)
+			ctx = notify.WithMuteTimeIntervals(ctx, c.mute)
+			ctx = notify.WithActiveTimeIntervals(ctx, c.active)
+
+			_, res, err := stage.Exec(ctx, log.NewNopLogger(), alerts...)
+			require.NoError(t, err)
+			if c.expSent {
+				require.Equal(t, alerts, res)
+			} else {
+				require.Empty(t, res)
+			}
+		})
+	}
+}
+
+func TestApplyConfigTimeIntervals(t *testing.T) {
+	am := setupAMTest(t)
+
+	n := &fakeNotifier{}
+	route := &Route{
+		Receiver: "recv",
+		Routes: []*Route{{
+			Receiver:            "recv",
+			MuteTimeIntervals:   []string{"weekends"},
+			ActiveTimeIntervals: []string{"office-hours"},
+		}},
+	}
+	cfg := newFakeConfig(t, route, map[string][]*Integration{"recv": {NewIntegration(n, n, "webhook", 0)}})
+	cfg.muteTimeIntervals = []MuteTimeInterval{{Name: "weekends"}}
+	require.EqualError(t, am.ApplyConfig(cfg), `undefined time interval "office-hours" used in route`)
+
+	cfg.muteTimeIntervals = append(cfg.muteTimeIntervals, MuteTimeInterval{Name: "office-hours"})
+	require.NoError(t, am.ApplyConfig(cfg))
+}
+
 // Tests cleanup of expired Silences. We rely on prometheus/alertmanager for
 // our alert silencing functionality, so we rely on its tests. However, we
 // implement a custom maintenance function for silences, because we snapshot
@@ -372,6 +454,16 @@ func TestSilenceCleanup(t *testing.T) {
 type FakeConfig struct {
 }
 
+func (f *FakeConfig) IngestionLimits() IngestionLimits {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (f *FakeConfig) AlertRelabelConfigs() []RelabelConfig {
+	// TODO implement me
+	panic("implement me")
+}
+
 func (f *FakeConfig) DispatcherLimits() DispatcherLimits {
 	panic("implement me")
 }
@@ -391,6 +483,31 @@ func (f *FakeConfig) ReceiverIntegrations() (map[string][]Integration, error) {
 	panic("implement me")
 }
 
+func (f *FakeConfig) RetryPolicies() map[string]RetryPolicy {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (f *FakeConfig) RateLimits() map[string]RateLimit {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (f *FakeConfig) Digests() map[string]Digest {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (f *FakeConfig) EscalationPolicies() []EscalationPolicy {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (f *FakeConfig) Receivers() []*APIReceiver {
+	// TODO implement me
+	panic("implement me")
+}
+
 func (f *FakeConfig) RoutingTree() *Route {
 	// TODO implement me
 	panic("implement me")
@@ -0,0 +1,413 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/alertmanager/inhibit"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	defaultAlertHistoryMaxEvents  = 100
+	defaultAlertHistoryRetention  = 24 * time.Hour
+	defaultAlertHistoryGCInterval = 15 * time.Minute
+)
+
+var ErrAlertHistoryDisabled = errors.New("the alert history is not enabled")
+
+// AlertHistoryConfig configures the timeline of the state changes and notifications of every alert.
+type AlertHistoryConfig struct {
+	// Retention is for how long events are kept. Defaults to the retention of Persistence if present, 24h otherwise.
+	Retention time.Duration
+	// MaxEvents is the number of events kept per alert, the oldest are dropped first. Defaults to 100.
+	MaxEvents int
+	// Persistence persists the history with its maintenance function, if present.
+	Persistence MaintenanceOptions
+}
+
+func (c *AlertHistoryConfig) Validate() error {
+	if c.Retention < 0 {
+		return errors.New("alert history retention must not be negative")
+	}
+	if c.MaxEvents < 0 {
+		return errors.New("alert history max events must not be negative")
+	}
+	return nil
+}
+
+// AlertHistoryEventType is the type of an event of the history of an alert.
+type AlertHistoryEventType string
+
+const (
+	// AlertHistoryFiring is recorded when an alert is received firing, for the first time or after it resolved.
+	AlertHistoryFiring AlertHistoryEventType = "firing"
+	// AlertHistoryResolved is recorded when an alert is received resolved, or at its end when it resolves without
+	// being received resolved.
+	AlertHistoryResolved AlertHistoryEventType = "resolved"
+	// AlertHistoryStateChanged is recorded when an alert becomes active, silenced or inhibited.
+	AlertHistoryStateChanged AlertHistoryEventType = "state_changed"
+	// AlertHistoryNotified is recorded when an alert is sent by an integration.
+	AlertHistoryNotified AlertHistoryEventType = "notified"
+	// AlertHistoryNotificationFailed is recorded when an integration fails to send an alert.
+	AlertHistoryNotificationFailed AlertHistoryEventType = "notification_failed"
+)
+
+// AlertHistoryEvent is an event of the history of an alert.
+type AlertHistoryEvent struct {
+	Time time.Time             `json:"time"`
+	Type AlertHistoryEventType `json:"type"`
+
+	// State, SilencedBy and InhibitedBy are the new status of the alert, for state changes.
+	State       types.AlertState `json:"state,omitempty"`
+	SilencedBy  []string         `json:"silencedBy,omitempty"`
+	InhibitedBy []string         `json:"inhibitedBy,omitempty"`
+	// InhibitRule is the index in the configuration of the inhibit rule that inhibits the alert, for the state changes
+	// of its inhibition.
+	InhibitRule *int `json:"inhibitRule,omitempty"`
+
+	// Receiver and Integration are set for notifications, along with Error for failed ones.
+	Receiver    string `json:"receiver,omitempty"`
+	Integration string `json:"integration,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// alertTimeline is a ring buffer of the events of an alert.
+type alertTimeline struct {
+	Events []AlertHistoryEvent `json:"events"`
+	// Next is the index of the slot for the next event, once the buffer is full.
+	Next int `json:"next"`
+	// Firing is whether the alert was last received firing.
+	Firing bool `json:"firing"`
+}
+
+func (t *alertTimeline) add(e AlertHistoryEvent, max int) {
+	if len(t.Events) < max {
+		t.Events = append(t.Events, e)
+		return
+	}
+	t.Events[t.Next] = e
+	t.Next = (t.Next + 1) % max
+}
+
+// events returns the events, oldest first.
+func (t *alertTimeline) events() []AlertHistoryEvent {
+	res := make([]AlertHistoryEvent, 0, len(t.Events))
+	res = append(res, t.Events[t.Next:]...)
+	return append(res, t.Events[:t.Next]...)
+}
+
+// alertHistory records the timeline of every alert.
+type alertHistory struct {
+	retention time.Duration
+	maxEvents int
+	now       func() time.Time
+
+	mtx       sync.Mutex
+	timelines map[model.Fingerprint]*alertTimeline
+}
+
+func newAlertHistory(c *AlertHistoryConfig) (*alertHistory, error) {
+	h := &alertHistory{
+		retention: c.Retention,
+		maxEvents: c.MaxEvents,
+		now:       time.Now,
+		timelines: make(map[model.Fingerprint]*alertTimeline),
+	}
+	if h.retention == 0 {
+		h.retention = defaultAlertHistoryRetention
+		if c.Persistence != nil && c.Persistence.Retention() > 0 {
+			h.retention = c.Persistence.Retention()
+		}
+	}
+	if h.maxEvents == 0 {
+		h.maxEvents = defaultAlertHistoryMaxEvents
+	}
+	if c.Persistence == nil || c.Persistence.Filepath() == "" {
+		return h, nil
+	}
+
+	b, err := os.ReadFile(filepath.Clean(c.Persistence.Filepath()))
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &h.timelines); err != nil {
+		return nil, fmt.Errorf("failed to decode the alert history snapshot: %w", err)
+	}
+	// The maximum number of events may have changed since the snapshot.
+	for fp, t := range h.timelines {
+		timeline := &alertTimeline{Firing: t.Firing}
+		for _, e := range t.events() {
+			timeline.add(e, h.maxEvents)
+		}
+		h.timelines[fp] = timeline
+	}
+	return h, nil
+}
+
+// MarshalBinary implements the State interface.
+func (h *alertHistory) MarshalBinary() ([]byte, error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	return json.Marshal(h.timelines)
+}
+
+// record adds an event to the timeline of the alert. It must be called with the lock held.
+func (h *alertHistory) record(fp model.Fingerprint, e AlertHistoryEvent) {
+	t, ok := h.timelines[fp]
+	if !ok {
+		t = &alertTimeline{}
+		h.timelines[fp] = t
+	}
+	if e.Time.IsZero() {
+		e.Time = h.now()
+	}
+	t.add(e, h.maxEvents)
+}
+
+// received records that the alerts were received, if they started firing or resolved.
+func (h *alertHistory) received(alerts ...*types.Alert) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	for _, a := range alerts {
+		h.observe(a, time.Time{})
+	}
+}
+
+// expired records the resolution of the alerts that resolved at their end rather than by being received resolved,
+// as they are seen when their aggregation group is flushed or when they are deleted from the store.
+func (h *alertHistory) expired(alerts ...*types.Alert) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	for _, a := range alerts {
+		if a.Resolved() {
+			h.observe(a, a.EndsAt)
+		}
+	}
+}
+
+// observe records that the alert started firing or resolved at t, or now if t is zero, if it did. It must be called
+// with the lock held.
+func (h *alertHistory) observe(a *types.Alert, t time.Time) {
+	fp := a.Fingerprint()
+	firing := !a.Resolved()
+	timeline, ok := h.timelines[fp]
+	if ok && timeline.Firing == firing {
+		return
+	}
+	if !ok && !firing {
+		// The alert resolved before it was ever seen firing.
+		return
+	}
+	typ := AlertHistoryFiring
+	if !firing {
+		typ = AlertHistoryResolved
+	}
+	h.record(fp, AlertHistoryEvent{Time: t, Type: typ})
+	h.timelines[fp].Firing = firing
+}
+
+// notified records the result of a notification of the alerts by an integration.
+func (h *alertHistory) notified(receiver, integration string, alerts []*types.Alert, err error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	e := AlertHistoryEvent{Type: AlertHistoryNotified, Receiver: receiver, Integration: integration}
+	if err != nil {
+		e.Type = AlertHistoryNotificationFailed
+		e.Error = err.Error()
+	}
+	for _, a := range alerts {
+		h.record(a.Fingerprint(), e)
+	}
+}
+
+// get returns the events of the alert, oldest first.
+func (h *alertHistory) get(fp model.Fingerprint) []AlertHistoryEvent {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	t, ok := h.timelines[fp]
+	if !ok {
+		return []AlertHistoryEvent{}
+	}
+	return t.events()
+}
+
+// gc removes the events older than the retention, and the alerts that have none left.
+func (h *alertHistory) gc() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	cutoff := h.now().Add(-h.retention)
+	for fp, t := range h.timelines {
+		timeline := &alertTimeline{Firing: t.Firing}
+		for _, e := range t.events() {
+			if e.Time.After(cutoff) {
+				timeline.add(e, h.maxEvents)
+			}
+		}
+		if len(timeline.Events) == 0 {
+			delete(h.timelines, fp)
+			continue
+		}
+		h.timelines[fp] = timeline
+	}
+}
+
+// historyMarker is a types.Marker that records the state changes of alerts in their history.
+type historyMarker struct {
+	types.Marker
+	history *alertHistory
+	// getAlert returns the alert with the fingerprint from the store.
+	getAlert func(model.Fingerprint) (*types.Alert, error)
+
+	rulesMtx     sync.RWMutex
+	inhibitRules []*inhibit.InhibitRule
+}
+
+// setInhibitRules sets the inhibit rules of the configuration, to record which one inhibits an alert.
+func (m *historyMarker) setInhibitRules(rules []InhibitRule) {
+	inhibitRules := make([]*inhibit.InhibitRule, 0, len(rules))
+	for _, cr := range rules {
+		inhibitRules = append(inhibitRules, inhibit.NewInhibitRule(cr))
+	}
+	m.rulesMtx.Lock()
+	defer m.rulesMtx.Unlock()
+	m.inhibitRules = inhibitRules
+}
+
+func (m *historyMarker) SetActiveOrSilenced(alert model.Fingerprint, version int, activeSilenceIDs, pendingSilenceIDs []string) {
+	m.history.mtx.Lock()
+	defer m.history.mtx.Unlock()
+
+	prev := m.Marker.Status(alert)
+	m.Marker.SetActiveOrSilenced(alert, version, activeSilenceIDs, pendingSilenceIDs)
+	m.recordChange(alert, prev, nil)
+}
+
+func (m *historyMarker) SetInhibited(alert model.Fingerprint, alertIDs ...string) {
+	// The store is not accessed with the lock of the history held, the store calls the history with its own.
+	rule, ok := m.inhibitRule(alert, alertIDs)
+
+	m.history.mtx.Lock()
+	defer m.history.mtx.Unlock()
+
+	prev := m.Marker.Status(alert)
+	m.Marker.SetInhibited(alert, alertIDs...)
+	if !ok {
+		m.recordChange(alert, prev, nil)
+		return
+	}
+	m.recordChange(alert, prev, &rule)
+}
+
+// inhibitRule returns the index of the first inhibit rule by which a source alert inhibits the target alert, which is
+// the rule the inhibitor applied.
+func (m *historyMarker) inhibitRule(target model.Fingerprint, sources []string) (int, bool) {
+	if len(sources) == 0 {
+		return 0, false
+	}
+	t, err := m.getAlert(target)
+	if err != nil {
+		return 0, false
+	}
+	sourceLabels := make([]model.LabelSet, 0, len(sources))
+	for _, id := range sources {
+		fp, err := model.FingerprintFromString(id)
+		if err != nil {
+			continue
+		}
+		if s, err := m.getAlert(fp); err == nil {
+			sourceLabels = append(sourceLabels, s.Labels)
+		}
+	}
+
+	m.rulesMtx.RLock()
+	defer m.rulesMtx.RUnlock()
+	for i, r := range m.inhibitRules {
+		for _, s := range sourceLabels {
+			if inhibits(r, s, t.Labels) {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// recordChange must be called with the lock of the history held.
+func (m *historyMarker) recordChange(fp model.Fingerprint, prev types.AlertStatus, inhibitRule *int) {
+	s := m.Marker.Status(fp)
+	if s.State == prev.State && equalStrings(s.SilencedBy, prev.SilencedBy) && equalStrings(s.InhibitedBy, prev.InhibitedBy) {
+		return
+	}
+	m.history.record(fp, AlertHistoryEvent{
+		Type:        AlertHistoryStateChanged,
+		State:       s.State,
+		SilencedBy:  s.SilencedBy,
+		InhibitedBy: s.InhibitedBy,
+		InhibitRule: inhibitRule,
+	})
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// historyStage records the notifications sent by its inner stage in the history of the alerts.
+type historyStage struct {
+	next        notify.Stage
+	history     *alertHistory
+	receiver    string
+	integration string
+}
+
+// Exec implements the Stage interface.
+func (s *historyStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	ctx, res, err := s.next.Exec(ctx, l, alerts...)
+	s.history.notified(s.receiver, s.integration, alerts, err)
+	return ctx, res, err
+}
+
+// GetAlertHistory returns the events of the alert with the given fingerprint, oldest first.
+func (am *GrafanaAlertmanager) GetAlertHistory(fp model.Fingerprint) ([]AlertHistoryEvent, error) {
+	if am.history == nil {
+		return nil, ErrAlertHistoryDisabled
+	}
+	return am.history.get(fp), nil
+}
+
+// historyFlushStage records the resolution of the alerts of the flushed aggregation groups that resolved at their end.
+type historyFlushStage struct {
+	next    notify.Stage
+	history *alertHistory
+}
+
+// Exec implements the Stage interface.
+func (s *historyFlushStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	s.history.expired(alerts...)
+	return s.next.Exec(ctx, l, alerts...)
+}
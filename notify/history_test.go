@@ -0,0 +1,215 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertTimeline(t *testing.T) {
+	var tl alertTimeline
+	for i := 0; i < 5; i++ {
+		tl.add(AlertHistoryEvent{Receiver: string(rune('a' + i))}, 3)
+	}
+	receivers := make([]string, 0, 3)
+	for _, e := range tl.events() {
+		receivers = append(receivers, e.Receiver)
+	}
+	require.Equal(t, []string{"c", "d", "e"}, receivers)
+}
+
+func TestAlertHistory(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	h, err := newAlertHistory(&AlertHistoryConfig{Retention: time.Hour})
+	require.NoError(t, err)
+	h.now = func() time.Time { return now }
+
+	firing := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "test"}, StartsAt: now}}
+	resolved := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "test"}, StartsAt: now, EndsAt: now.Add(-time.Second)}}
+	fp := firing.Fingerprint()
+
+	h.received(firing)
+	h.received(firing)
+	h.notified("recv", "slack[0]", []*types.Alert{firing}, nil)
+	h.notified("recv", "email[0]", []*types.Alert{firing}, errors.New("unavailable"))
+	now = now.Add(time.Minute)
+	h.received(resolved)
+
+	exp := []AlertHistoryEvent{
+		{Time: now.Add(-time.Minute), Type: AlertHistoryFiring},
+		{Time: now.Add(-time.Minute), Type: AlertHistoryNotified, Receiver: "recv", Integration: "slack[0]"},
+		{Time: now.Add(-time.Minute), Type: AlertHistoryNotificationFailed, Receiver: "recv", Integration: "email[0]", Error: "unavailable"},
+		{Time: now, Type: AlertHistoryResolved},
+	}
+	require.Equal(t, exp, h.get(fp))
+	require.Equal(t, []AlertHistoryEvent{}, h.get(model.Fingerprint(1)))
+
+	// The history is loaded back from its snapshot.
+	b, err := h.MarshalBinary()
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "history")
+	require.NoError(t, os.WriteFile(file, b, 0600))
+	loaded, err := newAlertHistory(&AlertHistoryConfig{Retention: time.Hour, Persistence: &fileMaintenanceOptions{path: file}})
+	require.NoError(t, err)
+	require.Equal(t, exp, loaded.get(fp))
+
+	// Events older than the retention are removed.
+	now = now.Add(time.Hour - 30*time.Second)
+	h.gc()
+	require.Equal(t, exp[3:], h.get(fp))
+	now = now.Add(time.Hour)
+	h.gc()
+	require.Empty(t, h.timelines)
+}
+
+func TestAlertHistoryExpired(t *testing.T) {
+	h, err := newAlertHistory(&AlertHistoryConfig{})
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	firing := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "test"}, StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)}}
+	expired := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "test"}, StartsAt: now.Add(-time.Hour), EndsAt: now.Add(-time.Minute)}}
+	unknown := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "unknown"}, EndsAt: now.Add(-time.Minute)}}
+
+	h.received(firing)
+	h.expired(firing, unknown)
+	require.Len(t, h.get(firing.Fingerprint()), 1)
+	require.Empty(t, h.get(unknown.Fingerprint()))
+
+	// The resolution is recorded at the end of the alert, once.
+	h.expired(expired)
+	h.expired(expired)
+	events := h.get(firing.Fingerprint())
+	require.Len(t, events, 2)
+	require.Equal(t, AlertHistoryEvent{Time: now.Add(-time.Minute), Type: AlertHistoryResolved}, events[1])
+
+	// The store records it when it deletes the alert.
+	cb := alertStoreCallback{am: &GrafanaAlertmanager{history: h, receipts: newAlertReceipts(), activeAlerts: newActiveAlerts()}}
+	h.received(firing)
+	require.NoError(t, cb.PreStore(expired, true))
+	cb.PostStore(expired, true)
+	cb.PostDelete(expired)
+	events = h.get(firing.Fingerprint())
+	require.Len(t, events, 4)
+	require.Equal(t, AlertHistoryResolved, events[3].Type)
+}
+
+func TestHistoryMarker(t *testing.T) {
+	h, err := newAlertHistory(&AlertHistoryConfig{})
+	require.NoError(t, err)
+	target := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "target", "severity": "warning"}}}
+	source := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "source", "severity": "critical"}}}
+	alerts := map[model.Fingerprint]*types.Alert{target.Fingerprint(): target, source.Fingerprint(): source}
+	m := &historyMarker{Marker: types.NewMarker(prometheus.NewRegistry()), history: h, getAlert: func(fp model.Fingerprint) (*types.Alert, error) {
+		if a, ok := alerts[fp]; ok {
+			return a, nil
+		}
+		return nil, errors.New("not found")
+	}}
+	sourceMatcher, err := labels.NewMatcher(labels.MatchEqual, "severity", "critical")
+	require.NoError(t, err)
+	targetMatcher, err := labels.NewMatcher(labels.MatchEqual, "severity", "warning")
+	require.NoError(t, err)
+	m.setInhibitRules([]InhibitRule{
+		{SourceMatchers: config.Matchers{sourceMatcher}, TargetMatchers: config.Matchers{sourceMatcher}},
+		{SourceMatchers: config.Matchers{sourceMatcher}, TargetMatchers: config.Matchers{targetMatcher}},
+	})
+	fp := target.Fingerprint()
+	inhibiting := source.Fingerprint().String()
+
+	m.SetActiveOrSilenced(fp, 0, nil, nil)
+	m.SetInhibited(fp)
+	m.SetActiveOrSilenced(fp, 1, []string{"silence"}, nil)
+	m.SetActiveOrSilenced(fp, 2, []string{"silence"}, nil)
+	m.SetInhibited(fp, inhibiting)
+	m.SetActiveOrSilenced(fp, 3, nil, nil)
+	m.SetInhibited(fp)
+
+	type state struct {
+		State       types.AlertState
+		SilencedBy  []string
+		InhibitedBy []string
+		InhibitRule *int
+	}
+	var states []state
+	for _, e := range h.get(fp) {
+		require.Equal(t, AlertHistoryStateChanged, e.Type)
+		states = append(states, state{e.State, e.SilencedBy, e.InhibitedBy, e.InhibitRule})
+	}
+	// The inhibition records the rule that inhibits the alert.
+	rule := 1
+	require.Equal(t, []state{
+		{State: types.AlertStateActive},
+		{State: types.AlertStateSuppressed, SilencedBy: []string{"silence"}},
+		{State: types.AlertStateSuppressed, SilencedBy: []string{"silence"}, InhibitedBy: []string{inhibiting}, InhibitRule: &rule},
+		{State: types.AlertStateSuppressed, InhibitedBy: []string{inhibiting}},
+		{State: types.AlertStateActive},
+	}, states)
+}
+
+func TestHistoryStage(t *testing.T) {
+	h, err := newAlertHistory(&AlertHistoryConfig{})
+	require.NoError(t, err)
+	alert := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "test"}}}
+
+	s := &historyStage{
+		next: notify.StageFunc(func(ctx context.Context, _ log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+			return ctx, nil, errors.New("unavailable")
+		}),
+		history:     h,
+		receiver:    "recv",
+		integration: "webhook[0]",
+	}
+	_, _, err = s.Exec(context.Background(), log.NewNopLogger(), alert)
+	require.EqualError(t, err, "unavailable")
+
+	events := h.get(alert.Fingerprint())
+	require.Len(t, events, 1)
+	require.Equal(t, AlertHistoryNotificationFailed, events[0].Type)
+	require.Equal(t, "unavailable", events[0].Error)
+}
+
+func TestGetAlertHistory(t *testing.T) {
+	am := setupAMTest(t)
+	_, err := am.GetAlertHistory(model.Fingerprint(1))
+	require.ErrorIs(t, err, ErrAlertHistoryDisabled)
+
+	am, err = NewGrafanaAlertmanager("org", 1, &GrafanaAlertmanagerConfig{
+		Silences:     newFakeMaintanenceOptions(t),
+		Nflog:        newFakeMaintanenceOptions(t),
+		AlertHistory: &AlertHistoryConfig{},
+	}, &NilPeer{}, log.NewNopLogger(), NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry()))
+	require.NoError(t, err)
+
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{{
+		Alert:    amv2.Alert{Labels: amv2.LabelSet{"alertname": "test"}},
+		StartsAt: strfmt.DateTime(time.Now()),
+	}}))
+	events, err := am.GetAlertHistory(model.LabelSet{"alertname": "test"}.Fingerprint())
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, AlertHistoryFiring, events[0].Type)
+}
+
+// fileMaintenanceOptions are maintenance options of a snapshot file.
+type fileMaintenanceOptions struct {
+	fakeMaintenanceOptions
+	path string
+}
+
+func (f *fileMaintenanceOptions) Filepath() string {
+	return f.path
+}
@@ -0,0 +1,183 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// AlertRejectionReason is why PutAlerts rejects an alert.
+type AlertRejectionReason string
+
+const (
+	// AlertRejectionInvalid is the reason of the alerts that fail validation.
+	AlertRejectionInvalid             AlertRejectionReason = "invalid"
+	AlertRejectionMaxActiveAlerts     AlertRejectionReason = "max_active_alerts"
+	AlertRejectionMaxAlertsPerRequest AlertRejectionReason = "max_alerts_per_request"
+	AlertRejectionMaxLabels           AlertRejectionReason = "max_labels"
+	AlertRejectionMaxAnnotations      AlertRejectionReason = "max_annotations"
+	AlertRejectionMaxNameBytes        AlertRejectionReason = "max_name_bytes"
+	AlertRejectionMaxValueBytes       AlertRejectionReason = "max_value_bytes"
+)
+
+// IngestionLimits limits the alerts PutAlerts accepts. A limit of zero is no limit.
+type IngestionLimits struct {
+	// MaxActiveAlerts limits the number of firing alerts of the tenant. Resolved alerts and updates of the firing
+	// alerts are accepted over the limit.
+	MaxActiveAlerts int `yaml:"max_active_alerts,omitempty" json:"max_active_alerts,omitempty"`
+	// MaxAlertsPerRequest limits the number of alerts per call of PutAlerts, the alerts over it are rejected.
+	MaxAlertsPerRequest int `yaml:"max_alerts_per_request,omitempty" json:"max_alerts_per_request,omitempty"`
+	MaxLabels           int `yaml:"max_labels,omitempty" json:"max_labels,omitempty"`
+	MaxAnnotations      int `yaml:"max_annotations,omitempty" json:"max_annotations,omitempty"`
+	// MaxNameBytes limits the size of the names of the labels and annotations.
+	MaxNameBytes int `yaml:"max_name_bytes,omitempty" json:"max_name_bytes,omitempty"`
+	// MaxValueBytes limits the size of the values of the labels and annotations.
+	MaxValueBytes int `yaml:"max_value_bytes,omitempty" json:"max_value_bytes,omitempty"`
+}
+
+func (l IngestionLimits) Validate() error {
+	if l.MaxActiveAlerts < 0 || l.MaxAlertsPerRequest < 0 || l.MaxLabels < 0 || l.MaxAnnotations < 0 || l.MaxNameBytes < 0 || l.MaxValueBytes < 0 {
+		return errors.New("limits must not be negative")
+	}
+	return nil
+}
+
+// AlertLimitError is the error of an alert rejected by an ingestion limit.
+type AlertLimitError struct {
+	Reason AlertRejectionReason
+	Err    error
+}
+
+func (e *AlertLimitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AlertLimitError) Unwrap() error {
+	return e.Err
+}
+
+func newAlertLimitError(reason AlertRejectionReason, format string, args ...interface{}) *AlertLimitError {
+	return &AlertLimitError{Reason: reason, Err: fmt.Errorf(format, args...)}
+}
+
+// checkAlert checks the limits on the size of the alert.
+func (l IngestionLimits) checkAlert(a *types.Alert) *AlertLimitError {
+	if l.MaxLabels > 0 && len(a.Labels) > l.MaxLabels {
+		return newAlertLimitError(AlertRejectionMaxLabels, "alert has %d labels, more than the limit of %d", len(a.Labels), l.MaxLabels)
+	}
+	if l.MaxAnnotations > 0 && len(a.Annotations) > l.MaxAnnotations {
+		return newAlertLimitError(AlertRejectionMaxAnnotations, "alert has %d annotations, more than the limit of %d", len(a.Annotations), l.MaxAnnotations)
+	}
+	if err := l.checkLabelSet("label", a.Labels); err != nil {
+		return err
+	}
+	return l.checkLabelSet("annotation", a.Annotations)
+}
+
+func (l IngestionLimits) checkLabelSet(kind string, ls model.LabelSet) *AlertLimitError {
+	for n, v := range ls {
+		if l.MaxNameBytes > 0 && len(n) > l.MaxNameBytes {
+			return newAlertLimitError(AlertRejectionMaxNameBytes, "%s name %q is %d bytes long, more than the limit of %d", kind, truncate(string(n), l.MaxNameBytes), len(n), l.MaxNameBytes)
+		}
+		if l.MaxValueBytes > 0 && len(v) > l.MaxValueBytes {
+			return newAlertLimitError(AlertRejectionMaxValueBytes, "value of %s %q is %d bytes long, more than the limit of %d", kind, n, len(v), l.MaxValueBytes)
+		}
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// activeAlerts follows the firing alerts of the store, to enforce MaxActiveAlerts without scanning the store.
+type activeAlerts struct {
+	mtx sync.Mutex
+	// endsAt are the ends of the firing alerts, by fingerprint. The alerts which resolve by reaching their end stay
+	// in the store until its garbage collection, they are pruned once the limit is reached.
+	endsAt map[model.Fingerprint]time.Time
+	// reserved are the new alerts counted by reserve that the store did not store yet.
+	reserved map[model.Fingerprint]struct{}
+}
+
+func newActiveAlerts() *activeAlerts {
+	return &activeAlerts{
+		endsAt:   make(map[model.Fingerprint]time.Time),
+		reserved: make(map[model.Fingerprint]struct{}),
+	}
+}
+
+// reserve counts the firing alert as active until it is stored or released, unless it is new and the limit is
+// reached. It returns the number of active alerts.
+func (a *activeAlerts) reserve(alert *types.Alert, limit int, now time.Time) (int, bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	fp := alert.Fingerprint()
+	_, active := a.endsAt[fp]
+	if !active && len(a.endsAt) >= limit {
+		for k, endsAt := range a.endsAt {
+			if !endsAt.After(now) {
+				delete(a.endsAt, k)
+			}
+		}
+		if len(a.endsAt) >= limit {
+			return len(a.endsAt), false
+		}
+	}
+	if !active {
+		a.reserved[fp] = struct{}{}
+	}
+	a.endsAt[fp] = alert.EndsAt
+	return len(a.endsAt), true
+}
+
+// release forgets the reserved alerts that the store did not store, for example because its callback rejected them.
+func (a *activeAlerts) release(alerts ...*types.Alert) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	for _, alert := range alerts {
+		fp := alert.Fingerprint()
+		if _, ok := a.reserved[fp]; ok {
+			delete(a.reserved, fp)
+			delete(a.endsAt, fp)
+		}
+	}
+}
+
+// stored follows the alert once it is stored, merged with its previous state.
+func (a *activeAlerts) stored(alert *types.Alert) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	delete(a.reserved, alert.Fingerprint())
+	if alert.Resolved() {
+		delete(a.endsAt, alert.Fingerprint())
+		return
+	}
+	a.endsAt[alert.Fingerprint()] = alert.EndsAt
+}
+
+// deleted forgets the alert, once it is deleted from the store.
+func (a *activeAlerts) deleted(alert *types.Alert) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	delete(a.reserved, alert.Fingerprint())
+	delete(a.endsAt, alert.Fingerprint())
+}
+
+func (a *activeAlerts) len() int {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	return len(a.endsAt)
+}
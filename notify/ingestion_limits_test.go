@@ -0,0 +1,198 @@
+package notify
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestionLimitsValidate(t *testing.T) {
+	require.NoError(t, IngestionLimits{}.Validate())
+	require.NoError(t, IngestionLimits{MaxActiveAlerts: 10, MaxValueBytes: 1024}.Validate())
+	require.EqualError(t, IngestionLimits{MaxLabels: -1}.Validate(), "limits must not be negative")
+}
+
+func TestPutAlertsIngestionLimits(t *testing.T) {
+	am := setupAMTest(t)
+	n := &fakeNotifier{}
+	cfg := newFakeConfig(t, &Route{Receiver: "recv"}, map[string][]*Integration{
+		"recv": {NewIntegration(n, n, "webhook", 0)},
+	})
+
+	cfg.ingestionLimits = IngestionLimits{MaxLabels: -1}
+	require.EqualError(t, am.ApplyConfig(cfg), "invalid ingestion limits: limits must not be negative")
+
+	cfg.ingestionLimits = IngestionLimits{
+		MaxActiveAlerts:     3,
+		MaxAlertsPerRequest: 4,
+		MaxLabels:           2,
+		MaxAnnotations:      1,
+		MaxNameBytes:        10,
+		MaxValueBytes:       10,
+	}
+	require.NoError(t, am.ApplyConfig(cfg))
+
+	now := time.Now()
+	alert := func(labels amv2.LabelSet, annotations amv2.LabelSet) *amv2.PostableAlert {
+		return &amv2.PostableAlert{
+			Alert:       amv2.Alert{Labels: labels},
+			Annotations: annotations,
+			StartsAt:    strfmt.DateTime(now),
+		}
+	}
+	expReasons := func(t *testing.T, err error, reasons ...AlertRejectionReason) {
+		t.Helper()
+		var validationErr *AlertValidationError
+		require.ErrorAs(t, err, &validationErr)
+		require.Len(t, validationErr.Errors, len(reasons))
+		for i, reason := range reasons {
+			var limitErr *AlertLimitError
+			require.ErrorAs(t, validationErr.Errors[i], &limitErr)
+			require.Equal(t, reason, limitErr.Reason)
+		}
+	}
+
+	err := am.PutAlerts(amv2.PostableAlerts{
+		alert(amv2.LabelSet{"alertname": "a"}, nil),
+		alert(amv2.LabelSet{"alertname": "b", "team": "x", "env": "y"}, nil),
+		alert(amv2.LabelSet{"alertname": "c"}, amv2.LabelSet{"summary": "s", "runbook": "r"}),
+		alert(amv2.LabelSet{"alertname": "d", "a_long_label_name": "x"}, nil),
+		alert(amv2.LabelSet{"alertname": "e"}, amv2.LabelSet{"summary": strings.Repeat("s", 11)}),
+	})
+	expReasons(t, err,
+		AlertRejectionMaxLabels,
+		AlertRejectionMaxAnnotations,
+		AlertRejectionMaxNameBytes,
+		AlertRejectionMaxAlertsPerRequest,
+	)
+
+	// The alerts that fail validation are reported as before, without a limit error.
+	err = am.PutAlerts(amv2.PostableAlerts{alert(amv2.LabelSet{"alertname": ""}, nil)})
+	var validationErr *AlertValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Len(t, validationErr.Errors, 1)
+	var limitErr *AlertLimitError
+	require.False(t, errors.As(validationErr.Errors[0], &limitErr))
+
+	// Updates of the active alert and resolved alerts are accepted over the limit of active alerts.
+	resolved := alert(amv2.LabelSet{"alertname": "resolved"}, nil)
+	resolved.EndsAt = strfmt.DateTime(now)
+	err = am.PutAlerts(amv2.PostableAlerts{
+		alert(amv2.LabelSet{"alertname": "a"}, nil),
+		alert(amv2.LabelSet{"alertname": "f"}, nil),
+		alert(amv2.LabelSet{"alertname": "g"}, nil),
+		resolved,
+	})
+	require.NoError(t, err)
+	err = am.PutAlerts(amv2.PostableAlerts{
+		alert(amv2.LabelSet{"alertname": "a"}, amv2.LabelSet{"summary": "updated"}),
+		alert(amv2.LabelSet{"alertname": "h"}, nil),
+	})
+	expReasons(t, err, AlertRejectionMaxActiveAlerts)
+
+	require.Equal(t, 3, am.activeAlerts.len())
+
+	require.Equal(t, 1.0, testutil.ToFloat64(am.Metrics.RejectedAlerts.WithLabelValues("max_labels")))
+	require.Equal(t, 1.0, testutil.ToFloat64(am.Metrics.RejectedAlerts.WithLabelValues("max_annotations")))
+	require.Equal(t, 1.0, testutil.ToFloat64(am.Metrics.RejectedAlerts.WithLabelValues("max_name_bytes")))
+	require.Equal(t, 0.0, testutil.ToFloat64(am.Metrics.RejectedAlerts.WithLabelValues("max_value_bytes")))
+	require.Equal(t, 1.0, testutil.ToFloat64(am.Metrics.RejectedAlerts.WithLabelValues("max_alerts_per_request")))
+	require.Equal(t, 1.0, testutil.ToFloat64(am.Metrics.RejectedAlerts.WithLabelValues("max_active_alerts")))
+	require.Equal(t, 1.0, testutil.ToFloat64(am.Metrics.RejectedAlerts.WithLabelValues("invalid")))
+
+	err = am.PutAlerts(amv2.PostableAlerts{alert(amv2.LabelSet{"alertname": "a", "team": strings.Repeat("x", 11)}, nil)})
+	expReasons(t, err, AlertRejectionMaxValueBytes)
+}
+
+// rejectingStoreCallback rejects the alerts with the alertname, as the limits of a host may.
+type rejectingStoreCallback struct {
+	alertname model.LabelValue
+}
+
+func (c rejectingStoreCallback) PreStore(alert *types.Alert, _ bool) error {
+	if alert.Labels[model.AlertNameLabel] == c.alertname {
+		return errors.New("rejected")
+	}
+	return nil
+}
+
+func (c rejectingStoreCallback) PostStore(*types.Alert, bool) {}
+
+func (c rejectingStoreCallback) PostDelete(*types.Alert) {}
+
+func TestPutAlertsMaxActiveAlertsStoreRejection(t *testing.T) {
+	am, err := NewGrafanaAlertmanager("org", 1, &GrafanaAlertmanagerConfig{
+		Silences:           newFakeMaintanenceOptions(t),
+		Nflog:              newFakeMaintanenceOptions(t),
+		AlertStoreCallback: rejectingStoreCallback{alertname: "rejected"},
+	}, &NilPeer{}, log.NewNopLogger(), NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry()))
+	require.NoError(t, err)
+	n := &fakeNotifier{}
+	cfg := newFakeConfig(t, &Route{Receiver: "recv"}, map[string][]*Integration{
+		"recv": {NewIntegration(n, n, "webhook", 0)},
+	})
+	cfg.ingestionLimits = IngestionLimits{MaxActiveAlerts: 1}
+	require.NoError(t, am.ApplyConfig(cfg))
+
+	alert := func(name string) *amv2.PostableAlert {
+		return &amv2.PostableAlert{
+			Alert:    amv2.Alert{Labels: amv2.LabelSet{"alertname": name}},
+			StartsAt: strfmt.DateTime(time.Now()),
+		}
+	}
+
+	// The alert that the store rejects does not take the slot of the next alert.
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{alert("rejected")}))
+	require.Equal(t, 0, am.activeAlerts.len())
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{alert("a")}))
+	require.Equal(t, 1, am.activeAlerts.len())
+}
+
+func TestActiveAlerts(t *testing.T) {
+	now := time.Now()
+	firing := func(name string, endsAt time.Time) *types.Alert {
+		return &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": model.LabelValue(name)}, StartsAt: now.Add(-time.Hour), EndsAt: endsAt}}
+	}
+	a, b, c := firing("a", now.Add(time.Hour)), firing("b", now.Add(time.Minute)), firing("c", now.Add(time.Hour))
+
+	active := newActiveAlerts()
+	_, ok := active.reserve(a, 2, now)
+	require.True(t, ok)
+	_, ok = active.reserve(b, 2, now)
+	require.True(t, ok)
+	n, ok := active.reserve(c, 2, now)
+	require.False(t, ok)
+	require.Equal(t, 2, n)
+	_, ok = active.reserve(a, 2, now)
+	require.True(t, ok, "an active alert is not counted twice")
+
+	// The alerts which reached their end are pruned once the limit is reached.
+	_, ok = active.reserve(c, 2, now.Add(2*time.Minute))
+	require.True(t, ok)
+
+	// The store follows the resolution and deletion of alerts.
+	resolved := firing("a", now.Add(-time.Minute))
+	active.stored(resolved)
+	require.Equal(t, 1, active.len())
+	active.deleted(c)
+	require.Equal(t, 0, active.len())
+
+	// A reserved alert that is not stored is released, a stored one is not.
+	_, ok = active.reserve(a, 2, now)
+	require.True(t, ok)
+	_, ok = active.reserve(b, 2, now)
+	require.True(t, ok)
+	active.stored(a)
+	active.release(a, b)
+	require.Equal(t, 1, active.len())
+}
@@ -0,0 +1,170 @@
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	v2 "github.com/prometheus/alertmanager/api/v2"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/inhibit"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// Inhibition is the inhibition of target alerts by a source alert, according to an inhibit rule.
+type Inhibition struct {
+	Source  *GettableAlert   `json:"source"`
+	Targets []*GettableAlert `json:"targets"`
+	// Rule is the index of the inhibit rule in the configuration.
+	Rule int `json:"rule"`
+	// Equal are the values of the equal labels of the rule, which the source and the targets share.
+	Equal amv2.LabelSet `json:"equal"`
+}
+
+// GetInhibitions returns the inhibitions of the firing alerts by the inhibit rules of the configuration. A target
+// inhibited by several source alerts is listed in the inhibition of each of them.
+func (am *GrafanaAlertmanager) GetInhibitions() ([]Inhibition, error) {
+	am.reloadConfigMtx.RLock()
+	rules := am.inhibitRules
+	am.reloadConfigMtx.RUnlock()
+	return am.inhibitions(rules)
+}
+
+// TestInhibitRule returns the inhibitions the rule would cause on the firing alerts, without saving it. The Rule of
+// the inhibitions is 0.
+func (am *GrafanaAlertmanager) TestInhibitRule(rule InhibitRule) ([]Inhibition, error) {
+	for _, n := range rule.Equal {
+		if !n.IsValid() {
+			return nil, fmt.Errorf("invalid equal label %q", n)
+		}
+	}
+	return am.inhibitions([]InhibitRule{rule})
+}
+
+func (am *GrafanaAlertmanager) inhibitions(rules []InhibitRule) ([]Inhibition, error) {
+	if !am.Ready() {
+		return nil, ErrGetAlertsUnavailable
+	}
+
+	it := am.alerts.GetPending()
+	defer it.Close()
+	var alerts []*types.Alert
+	for a := range it.Next() {
+		if err := it.Err(); err != nil {
+			level.Error(am.logger).Log("msg", "failed to iterate through the alerts", "err", err)
+			return nil, fmt.Errorf("%s: %w", err.Error(), ErrGetAlertsInternal)
+		}
+		if !a.Resolved() {
+			alerts = append(alerts, a)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Fingerprint() < alerts[j].Fingerprint()
+	})
+
+	// The alerts are paired without the configuration lock, which is only needed to read the route.
+	type inhibition struct {
+		source  *types.Alert
+		targets []*types.Alert
+		rule    int
+		equal   []model.LabelName
+	}
+	var inhibitions []inhibition
+	for i, cr := range rules {
+		r := inhibit.NewInhibitRule(cr)
+		equal := make([]model.LabelName, 0, len(r.Equal))
+		for n := range r.Equal {
+			equal = append(equal, n)
+		}
+		sort.Slice(equal, func(i, j int) bool { return equal[i] < equal[j] })
+
+		// The targets are bucketed by the values of their equal labels, which the source must share.
+		targets := make(map[string][]*types.Alert)
+		for _, a := range alerts {
+			if r.TargetMatchers.Matches(a.Labels) {
+				k := equalValues(equal, a.Labels)
+				targets[k] = append(targets[k], a)
+			}
+		}
+		if len(targets) == 0 {
+			continue
+		}
+		for _, source := range alerts {
+			if !r.SourceMatchers.Matches(source.Labels) {
+				continue
+			}
+			var inhibited []*types.Alert
+			for _, target := range targets[equalValues(equal, source.Labels)] {
+				if inhibits(r, source.Labels, target.Labels) {
+					inhibited = append(inhibited, target)
+				}
+			}
+			if len(inhibited) > 0 {
+				inhibitions = append(inhibitions, inhibition{source: source, targets: inhibited, rule: i, equal: equal})
+			}
+		}
+	}
+
+	am.reloadConfigMtx.RLock()
+	route := am.route
+	am.reloadConfigMtx.RUnlock()
+
+	gettable := make(map[model.Fingerprint]*GettableAlert)
+	toGettable := func(a *types.Alert) *GettableAlert {
+		fp := a.Fingerprint()
+		if g, ok := gettable[fp]; ok {
+			return g
+		}
+		routes := route.Match(a.Labels)
+		receivers := make([]string, 0, len(routes))
+		for _, r := range routes {
+			receivers = append(receivers, r.RouteOpts.Receiver)
+		}
+		g := v2.AlertToOpenAPIAlert(a, am.marker.Status(fp), receivers)
+		gettable[fp] = g
+		return g
+	}
+
+	res := make([]Inhibition, 0, len(inhibitions))
+	for _, in := range inhibitions {
+		targets := make([]*GettableAlert, 0, len(in.targets))
+		for _, t := range in.targets {
+			targets = append(targets, toGettable(t))
+		}
+		equal := make(amv2.LabelSet, len(in.equal))
+		for _, n := range in.equal {
+			equal[string(n)] = string(in.source.Labels[n])
+		}
+		res = append(res, Inhibition{Source: toGettable(in.source), Targets: targets, Rule: in.rule, Equal: equal})
+	}
+	return res, nil
+}
+
+// equalValues returns the values of the labels, as a key.
+func equalValues(names []model.LabelName, labels model.LabelSet) string {
+	var b strings.Builder
+	for _, n := range names {
+		b.WriteString(string(labels[n]))
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
+
+// inhibits returns whether the rule inhibits the target alert with the source alert.
+func inhibits(r *inhibit.InhibitRule, source, target model.LabelSet) bool {
+	if !r.SourceMatchers.Matches(source) || !r.TargetMatchers.Matches(target) {
+		return false
+	}
+	// As in the inhibitor, alerts that match both sides of the rule are not inhibited by each other.
+	if r.TargetMatchers.Matches(source) && r.SourceMatchers.Matches(target) {
+		return false
+	}
+	for n := range r.Equal {
+		if source[n] != target[n] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetInhibitions(t *testing.T) {
+	am := setupAMTest(t)
+	_, err := am.GetInhibitions()
+	require.ErrorIs(t, err, ErrGetAlertsUnavailable)
+
+	matchers := func(t *testing.T, s ...string) config.Matchers {
+		t.Helper()
+		res := make(config.Matchers, 0, len(s))
+		for _, m := range s {
+			matcher, err := labels.ParseMatcher(m)
+			require.NoError(t, err)
+			res = append(res, matcher)
+		}
+		return res
+	}
+
+	n := &fakeNotifier{}
+	cfg := newFakeConfig(t, &Route{Receiver: "recv"}, map[string][]*Integration{
+		"recv": {NewIntegration(n, n, "webhook", 0)},
+	})
+	cfg.inhibitRules = []InhibitRule{{
+		SourceMatchers: matchers(t, "severity=critical"),
+		TargetMatchers: matchers(t, "severity=warning"),
+		Equal:          model.LabelNames{"cluster"},
+	}, {
+		SourceMatchers: matchers(t, "alertname=ClusterDown"),
+		TargetMatchers: matchers(t, "alertname=~Cluster.*"),
+		Equal:          model.LabelNames{"cluster"},
+	}}
+	require.NoError(t, am.ApplyConfig(cfg))
+
+	now := time.Now()
+	alert := func(ls amv2.LabelSet) *amv2.PostableAlert {
+		return &amv2.PostableAlert{Alert: amv2.Alert{Labels: ls}, StartsAt: strfmt.DateTime(now)}
+	}
+	resolved := alert(amv2.LabelSet{"alertname": "ClusterDown", "severity": "critical", "cluster": "us"})
+	resolved.EndsAt = strfmt.DateTime(now)
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{
+		alert(amv2.LabelSet{"alertname": "ClusterDown", "severity": "critical", "cluster": "eu"}),
+		alert(amv2.LabelSet{"alertname": "ClusterCPUHigh", "severity": "warning", "cluster": "eu"}),
+		alert(amv2.LabelSet{"alertname": "ClusterMemoryHigh", "severity": "warning", "cluster": "eu"}),
+		alert(amv2.LabelSet{"alertname": "ClusterCPUHigh", "severity": "warning", "cluster": "us"}),
+		resolved,
+	}))
+
+	labelsOf := func(alerts []*GettableAlert) []amv2.LabelSet {
+		res := make([]amv2.LabelSet, 0, len(alerts))
+		for _, a := range alerts {
+			res = append(res, a.Labels)
+		}
+		return res
+	}
+
+	inhibitions, err := am.GetInhibitions()
+	require.NoError(t, err)
+	require.Len(t, inhibitions, 2)
+	for i, inhibition := range inhibitions {
+		require.Equal(t, i, inhibition.Rule)
+		require.Equal(t, amv2.LabelSet{"alertname": "ClusterDown", "severity": "critical", "cluster": "eu"}, inhibition.Source.Labels)
+		require.Equal(t, amv2.LabelSet{"cluster": "eu"}, inhibition.Equal)
+		require.ElementsMatch(t, []amv2.LabelSet{
+			{"alertname": "ClusterCPUHigh", "severity": "warning", "cluster": "eu"},
+			{"alertname": "ClusterMemoryHigh", "severity": "warning", "cluster": "eu"},
+		}, labelsOf(inhibition.Targets))
+	}
+
+	// The candidate rule is evaluated against the current alerts, without changing the configuration.
+	inhibitions, err = am.TestInhibitRule(InhibitRule{
+		SourceMatchers: matchers(t, "alertname=ClusterCPUHigh"),
+		TargetMatchers: matchers(t, "alertname=ClusterMemoryHigh"),
+	})
+	require.NoError(t, err)
+	require.Len(t, inhibitions, 2)
+	for _, inhibition := range inhibitions {
+		require.Equal(t, 0, inhibition.Rule)
+		require.Equal(t, amv2.LabelSet{}, inhibition.Equal)
+		require.Equal(t, []amv2.LabelSet{{"alertname": "ClusterMemoryHigh", "severity": "warning", "cluster": "eu"}}, labelsOf(inhibition.Targets))
+	}
+	inhibitions, err = am.GetInhibitions()
+	require.NoError(t, err)
+	require.Len(t, inhibitions, 2)
+
+	_, err = am.TestInhibitRule(InhibitRule{Equal: model.LabelNames{"1cluster"}})
+	require.EqualError(t, err, `invalid equal label "1cluster"`)
+}
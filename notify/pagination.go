@@ -0,0 +1,424 @@
+package notify
+
+import (
+	"container/heap"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	v2 "github.com/prometheus/alertmanager/api/v2"
+	"github.com/prometheus/alertmanager/dispatch"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// AlertSortBy is the order of the results of QueryAlerts and QueryAlertGroups.
+type AlertSortBy string
+
+const (
+	// SortByFingerprint sorts the alerts by fingerprint, as GetAlerts, and the groups by group key.
+	SortByFingerprint AlertSortBy = ""
+	// SortByStartsAt sorts the alerts by start time, and the groups by the start time of their first alert.
+	SortByStartsAt AlertSortBy = "startsAt"
+	// SortBySeverity sorts the alerts from the most severe, according to their severity label, and the groups by their
+	// most severe alert.
+	SortBySeverity AlertSortBy = "severity"
+	// SortByReceiver sorts the alerts and the groups by receiver.
+	SortByReceiver AlertSortBy = "receiver"
+)
+
+// SeverityLabel is the label of the severity of the alerts, by which SortBySeverity sorts.
+const SeverityLabel model.LabelName = "severity"
+
+// severityRanks orders the common severities, from the most severe. Other severities come after them, by value, and
+// the alerts without severity last.
+var severityRanks = map[string]int64{
+	"critical": 0,
+	"high":     1,
+	"error":    1,
+	"warning":  2,
+	"medium":   2,
+	"low":      3,
+	"info":     3,
+}
+
+// AlertQuery is a query of a page of alerts or alert groups.
+type AlertQuery struct {
+	// Active, Silenced, Inhibited, Filter and Receivers filter the alerts, as the parameters of GetAlerts.
+	Active    bool
+	Silenced  bool
+	Inhibited bool
+	Filter    []string
+	Receivers string
+
+	SortBy     AlertSortBy
+	Descending bool
+	// Limit is the maximum number of results of the page. Zero is no limit.
+	Limit int
+	// Cursor is the NextCursor of the previous page, empty for the first page.
+	Cursor string
+}
+
+// AlertsSummary counts the alerts that match the labels and receivers of a query, whatever their state.
+type AlertsSummary struct {
+	Total       int `json:"total"`
+	Active      int `json:"active"`
+	Suppressed  int `json:"suppressed"`
+	Unprocessed int `json:"unprocessed"`
+	Silenced    int `json:"silenced"`
+	Inhibited   int `json:"inhibited"`
+}
+
+func (s *AlertsSummary) add(status types.AlertStatus) {
+	s.Total++
+	switch status.State {
+	case types.AlertStateActive:
+		s.Active++
+	case types.AlertStateSuppressed:
+		s.Suppressed++
+	case types.AlertStateUnprocessed:
+		s.Unprocessed++
+	}
+	if len(status.SilencedBy) > 0 {
+		s.Silenced++
+	}
+	if len(status.InhibitedBy) > 0 {
+		s.Inhibited++
+	}
+}
+
+// AlertsPage is a page of the results of QueryAlerts.
+type AlertsPage struct {
+	Alerts GettableAlerts `json:"alerts"`
+	// NextCursor is the cursor of the next page, empty for the last page.
+	NextCursor string        `json:"nextCursor,omitempty"`
+	Summary    AlertsSummary `json:"summary"`
+}
+
+// AlertGroupsPage is a page of the results of QueryAlertGroups.
+type AlertGroupsPage struct {
+	Groups AlertGroupsWithState `json:"groups"`
+	// NextCursor is the cursor of the next page, empty for the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+	// Total is the number of groups of all the pages.
+	Total   int           `json:"total"`
+	Summary AlertsSummary `json:"summary"`
+}
+
+// QueryAlerts returns a page of the alerts that match the query. Only the alerts of the page are converted to their
+// API representation.
+func (am *GrafanaAlertmanager) QueryAlerts(q AlertQuery) (*AlertsPage, error) {
+	if !am.Ready() {
+		return nil, ErrGetAlertsUnavailable
+	}
+	matchers, receiverFilter, p, err := parseAlertQuery(q)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), ErrGetAlertsBadPayload)
+	}
+
+	type alertItem struct {
+		alert     *types.Alert
+		receivers []string
+	}
+	res := &AlertsPage{Alerts: GettableAlerts{}}
+	alerts := am.alerts.GetPending()
+	defer alerts.Close()
+
+	alertFilter := am.alertFilter(matchers, true, true, true)
+	now := time.Now()
+
+	am.reloadConfigMtx.RLock()
+	for a := range alerts.Next() {
+		if err = alerts.Err(); err != nil {
+			break
+		}
+
+		routes := am.route.Match(a.Labels)
+		receivers := make([]string, 0, len(routes))
+		for _, r := range routes {
+			receivers = append(receivers, r.RouteOpts.Receiver)
+		}
+		if receiverFilter != nil && !receiversMatchFilter(receivers, receiverFilter) {
+			continue
+		}
+		if !alertFilter(a, now) {
+			continue
+		}
+
+		status := am.marker.Status(a.Fingerprint())
+		res.Summary.add(status)
+		if !statusMatchesFilter(status, q.Silenced, q.Inhibited, q.Active) {
+			continue
+		}
+		p.add(alertPageKey(q.SortBy, a, receivers), alertItem{alert: a, receivers: receivers})
+	}
+	am.reloadConfigMtx.RUnlock()
+
+	if err != nil {
+		level.Error(am.logger).Log("msg", "failed to iterate through the alerts", "err", err)
+		return nil, fmt.Errorf("%s: %w", err.Error(), ErrGetAlertsInternal)
+	}
+
+	items, next, err := p.results()
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		a := item.(alertItem)
+		res.Alerts = append(res.Alerts, v2.AlertToOpenAPIAlert(a.alert, am.marker.Status(a.alert.Fingerprint()), a.receivers))
+	}
+	res.NextCursor = next
+	return res, nil
+}
+
+// QueryAlertGroups returns a page of the alert groups that have alerts that match the query. Only the groups of the
+// page are converted to their API representation.
+func (am *GrafanaAlertmanager) QueryAlertGroups(q AlertQuery) (*AlertGroupsPage, error) {
+	if !am.Ready() {
+		return nil, ErrGetAlertsUnavailable
+	}
+	matchers, receiverFilter, p, err := parseAlertQuery(q)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), ErrGetAlertGroupsBadPayload)
+	}
+
+	rf := func(r *dispatch.Route) bool {
+		return receiverFilter == nil || receiverFilter.MatchString(r.RouteOpts.Receiver)
+	}
+
+	am.reloadConfigMtx.RLock()
+	defer am.reloadConfigMtx.RUnlock()
+
+	alertGroups, allReceivers := am.dispatcher.Groups(rf, am.alertFilter(matchers, true, true, true))
+
+	res := &AlertGroupsPage{Groups: AlertGroupsWithState{}}
+	counted := make(map[model.Fingerprint]struct{})
+	for _, g := range alertGroups {
+		alerts := make([]*types.Alert, 0, len(g.Alerts))
+		for _, a := range g.Alerts {
+			fp := a.Fingerprint()
+			status := am.marker.Status(fp)
+			if _, ok := counted[fp]; !ok {
+				counted[fp] = struct{}{}
+				res.Summary.add(status)
+			}
+			if statusMatchesFilter(status, q.Silenced, q.Inhibited, q.Active) {
+				alerts = append(alerts, a)
+			}
+		}
+		if len(alerts) == 0 {
+			continue
+		}
+		g.Alerts = alerts
+		res.Total++
+		p.add(groupPageKey(q.SortBy, g, am.groupKey(g)), g)
+	}
+
+	items, next, err := p.results()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, item := range items {
+		res.Groups = append(res.Groups, am.toAlertGroup(item.(*dispatch.AlertGroup), allReceivers, now))
+	}
+	res.NextCursor = next
+	return res, nil
+}
+
+func parseAlertQuery(q AlertQuery) ([]*labels.Matcher, *regexp.Regexp, *page, error) {
+	switch q.SortBy {
+	case SortByFingerprint, SortByStartsAt, SortBySeverity, SortByReceiver:
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown sort %q", q.SortBy)
+	}
+	if q.Limit < 0 {
+		return nil, nil, nil, fmt.Errorf("limit must not be negative")
+	}
+	matchers, err := parseFilter(q.Filter)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	receiverFilter, err := parseReceivers(q.Receivers)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	p := &page{sortBy: q.SortBy, desc: q.Descending, limit: q.Limit}
+	if q.Cursor != "" {
+		if p.after, err = p.decodeCursor(q.Cursor); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return matchers, receiverFilter, p, nil
+}
+
+func alertPageKey(sortBy AlertSortBy, a *types.Alert, receivers []string) pageKey {
+	k := pageKey{ID: a.Fingerprint().String()}
+	switch sortBy {
+	case SortByStartsAt:
+		k.N = a.StartsAt.UnixNano()
+	case SortBySeverity:
+		k.N, k.S = severityKey(a.Labels[SeverityLabel])
+	case SortByReceiver:
+		k.S = strings.Join(receivers, ",")
+	}
+	return k
+}
+
+func groupPageKey(sortBy AlertSortBy, g *dispatch.AlertGroup, groupKey string) pageKey {
+	k := pageKey{ID: groupKey}
+	switch sortBy {
+	case SortByStartsAt:
+		for i, a := range g.Alerts {
+			if n := a.StartsAt.UnixNano(); i == 0 || n < k.N {
+				k.N = n
+			}
+		}
+	case SortBySeverity:
+		for i, a := range g.Alerts {
+			n, s := severityKey(a.Labels[SeverityLabel])
+			if i == 0 || n < k.N || (n == k.N && s < k.S) {
+				k.N, k.S = n, s
+			}
+		}
+	case SortByReceiver:
+		k.S = g.Receiver
+	}
+	return k
+}
+
+func severityKey(v model.LabelValue) (int64, string) {
+	if v == "" {
+		return int64(len(severityRanks)) + 1, ""
+	}
+	s := strings.ToLower(string(v))
+	if r, ok := severityRanks[s]; ok {
+		return r, s
+	}
+	return int64(len(severityRanks)), s
+}
+
+// pageKey orders the results of a query, by N, then S, then ID, which is unique.
+type pageKey struct {
+	N  int64  `json:"n,omitempty"`
+	S  string `json:"s,omitempty"`
+	ID string `json:"id"`
+}
+
+func (k pageKey) compare(o pageKey) int {
+	switch {
+	case k.N != o.N:
+		if k.N < o.N {
+			return -1
+		}
+		return 1
+	case k.S != o.S:
+		return strings.Compare(k.S, o.S)
+	default:
+		return strings.Compare(k.ID, o.ID)
+	}
+}
+
+// pageCursor is the position of the last result of a page, in the order of the query.
+type pageCursor struct {
+	SortBy     AlertSortBy `json:"sortBy,omitempty"`
+	Descending bool        `json:"desc,omitempty"`
+	Key        pageKey     `json:"key"`
+}
+
+type pageItem struct {
+	key   pageKey
+	value interface{}
+}
+
+// page keeps the first limit+1 results after the cursor, the extra one telling whether there is a next page. Its items
+// are a heap whose root is the last of them, so that the results are never all kept at once.
+type page struct {
+	sortBy AlertSortBy
+	desc   bool
+	limit  int
+	after  *pageKey
+	items  []pageItem
+}
+
+func (p *page) before(a, b pageKey) bool {
+	if p.desc {
+		return a.compare(b) > 0
+	}
+	return a.compare(b) < 0
+}
+
+func (p *page) Len() int           { return len(p.items) }
+func (p *page) Less(i, j int) bool { return p.before(p.items[j].key, p.items[i].key) }
+func (p *page) Swap(i, j int)      { p.items[i], p.items[j] = p.items[j], p.items[i] }
+func (p *page) Push(x interface{}) { p.items = append(p.items, x.(pageItem)) }
+func (p *page) Pop() interface{} {
+	last := p.items[len(p.items)-1]
+	p.items = p.items[:len(p.items)-1]
+	return last
+}
+
+func (p *page) add(key pageKey, value interface{}) {
+	if p.after != nil && !p.before(*p.after, key) {
+		return
+	}
+	if p.limit > 0 && len(p.items) > p.limit {
+		if !p.before(key, p.items[0].key) {
+			return
+		}
+		p.items[0] = pageItem{key: key, value: value}
+		heap.Fix(p, 0)
+		return
+	}
+	heap.Push(p, pageItem{key: key, value: value})
+}
+
+// results returns the values of the page in order, and the cursor of the next page, if any.
+func (p *page) results() ([]interface{}, string, error) {
+	sort.Slice(p.items, func(i, j int) bool {
+		return p.before(p.items[i].key, p.items[j].key)
+	})
+	var next string
+	items := p.items
+	if p.limit > 0 && len(items) > p.limit {
+		items = items[:p.limit]
+		var err error
+		if next, err = p.encodeCursor(items[len(items)-1].key); err != nil {
+			return nil, "", err
+		}
+	}
+	res := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		res = append(res, item.value)
+	}
+	return res, next, nil
+}
+
+func (p *page) encodeCursor(k pageKey) (string, error) {
+	b, err := json.Marshal(pageCursor{SortBy: p.sortBy, Descending: p.desc, Key: k})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode the cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (p *page) decodeCursor(s string) (*pageKey, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	var c pageCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if c.SortBy != p.sortBy || c.Descending != p.desc {
+		return nil, fmt.Errorf("the cursor is of another sort")
+	}
+	return &c.Key, nil
+}
@@ -0,0 +1,171 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func setupPaginationTest(t *testing.T) *GrafanaAlertmanager {
+	t.Helper()
+	matcher, err := labels.NewMatcher(labels.MatchEqual, "alertname", "c")
+	require.NoError(t, err)
+
+	am := setupAMTest(t)
+	n := &fakeNotifier{}
+	cfg := newFakeConfig(t, &Route{
+		Receiver: "recv",
+		GroupBy:  []model.LabelName{"alertname"},
+		Routes:   []*Route{{Receiver: "db", Matchers: config.Matchers{matcher}}},
+	}, map[string][]*Integration{
+		"recv": {NewIntegration(n, n, "webhook", 0)},
+		"db":   {NewIntegration(n, n, "webhook", 0)},
+	})
+	require.NoError(t, am.ApplyConfig(cfg))
+
+	now := time.Now()
+	alert := func(name, severity string, startsAt time.Time) *amv2.PostableAlert {
+		ls := amv2.LabelSet{"alertname": name, "instance": severity}
+		if severity != "" {
+			ls["severity"] = severity
+		}
+		return &amv2.PostableAlert{Alert: amv2.Alert{Labels: ls}, StartsAt: strfmt.DateTime(startsAt)}
+	}
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{
+		alert("a", "info", now.Add(-time.Minute)),
+		alert("a", "Critical", now.Add(-2*time.Minute)),
+		alert("b", "", now.Add(-3*time.Minute)),
+		alert("b", "custom", now.Add(-4*time.Minute)),
+		alert("c", "warning", now.Add(-5*time.Minute)),
+	}))
+	require.Eventually(t, func() bool {
+		groups, err := am.GetAlertGroups(true, true, true, nil, "")
+		return err == nil && len(groups) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	return am
+}
+
+func alertNames(alerts GettableAlerts) []string {
+	res := make([]string, 0, len(alerts))
+	for _, a := range alerts {
+		res = append(res, a.Labels["alertname"]+"/"+a.Labels["severity"])
+	}
+	return res
+}
+
+func TestQueryAlerts(t *testing.T) {
+	am := setupPaginationTest(t)
+
+	all, err := am.GetAlerts(true, true, true, nil, "")
+	require.NoError(t, err)
+	require.Len(t, all, 5)
+
+	// The pages follow each other in the order of GetAlerts.
+	q := AlertQuery{Active: true, Silenced: true, Inhibited: true, Limit: 2}
+	var paged GettableAlerts
+	for i := 0; ; i++ {
+		page, err := am.QueryAlerts(q)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page.Alerts), 2)
+		require.Equal(t, 5, page.Summary.Total)
+		paged = append(paged, page.Alerts...)
+		if page.NextCursor == "" {
+			require.Equal(t, 2, i)
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	require.Equal(t, alertNames(all), alertNames(paged))
+
+	page, err := am.QueryAlerts(AlertQuery{Active: true, SortBy: SortBySeverity})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a/Critical", "c/warning", "a/info", "b/custom", "b/"}, alertNames(page.Alerts))
+	require.Empty(t, page.NextCursor)
+
+	page, err = am.QueryAlerts(AlertQuery{Active: true, SortBy: SortByStartsAt, Descending: true, Limit: 3})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a/info", "a/Critical", "b/"}, alertNames(page.Alerts))
+	page, err = am.QueryAlerts(AlertQuery{Active: true, SortBy: SortByStartsAt, Descending: true, Limit: 3, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	require.Equal(t, []string{"b/custom", "c/warning"}, alertNames(page.Alerts))
+	require.Empty(t, page.NextCursor)
+
+	// The summary counts the alerts whatever their state.
+	startsAt, endsAt := strfmt.DateTime(time.Now()), strfmt.DateTime(time.Now().Add(time.Hour))
+	comment, createdBy, name, value, isRegex := "", "test", "alertname", "a", false
+	_, err = am.CreateSilence(&PostableSilence{Silence: amv2.Silence{
+		Comment:   &comment,
+		CreatedBy: &createdBy,
+		StartsAt:  &startsAt,
+		EndsAt:    &endsAt,
+		Matchers:  amv2.Matchers{{Name: &name, Value: &value, IsRegex: &isRegex}},
+	}})
+	require.NoError(t, err)
+	page, err = am.QueryAlerts(AlertQuery{Active: true, Filter: []string{`severity!="custom"`}, SortBy: SortByReceiver})
+	require.NoError(t, err)
+	require.Equal(t, []string{"c/warning", "b/"}, alertNames(page.Alerts))
+	require.Equal(t, AlertsSummary{Total: 4, Active: 2, Suppressed: 2, Silenced: 2}, page.Summary)
+
+	_, err = am.QueryAlerts(AlertQuery{SortBy: SortBySeverity, Cursor: q.Cursor})
+	require.ErrorIs(t, err, ErrGetAlertsBadPayload)
+	require.ErrorContains(t, err, "the cursor is of another sort")
+	_, err = am.QueryAlerts(AlertQuery{Cursor: "not a cursor"})
+	require.ErrorContains(t, err, "invalid cursor")
+	_, err = am.QueryAlerts(AlertQuery{Limit: -1})
+	require.ErrorContains(t, err, "limit must not be negative")
+	_, err = am.QueryAlerts(AlertQuery{SortBy: "labels"})
+	require.ErrorContains(t, err, `unknown sort "labels"`)
+}
+
+func TestQueryAlertGroups(t *testing.T) {
+	am := setupPaginationTest(t)
+
+	groupNames := func(groups AlertGroupsWithState) []string {
+		res := make([]string, 0, len(groups))
+		for _, g := range groups {
+			res = append(res, g.Labels["alertname"])
+		}
+		return res
+	}
+
+	q := AlertQuery{Active: true, Limit: 2}
+	page, err := am.QueryAlertGroups(q)
+	require.NoError(t, err)
+	// The groups are sorted by group key, the child route first.
+	require.Equal(t, []string{"c", "a"}, groupNames(page.Groups))
+	require.Equal(t, 3, page.Total)
+	require.Equal(t, AlertsSummary{Total: 5, Active: 5}, page.Summary)
+	require.Equal(t, `{}:{alertname="a"}`, page.Groups[1].GroupKey)
+	require.Len(t, page.Groups[1].Alerts, 2)
+
+	q.Cursor = page.NextCursor
+	page, err = am.QueryAlertGroups(q)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, groupNames(page.Groups))
+	require.Empty(t, page.NextCursor)
+
+	page, err = am.QueryAlertGroups(AlertQuery{Active: true, SortBy: SortByReceiver, Descending: true, Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, "recv", *page.Groups[0].Receiver.Name)
+
+	// Groups are sorted by their most severe alert, and by their first alert.
+	page, err = am.QueryAlertGroups(AlertQuery{Active: true, SortBy: SortBySeverity})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "c", "b"}, groupNames(page.Groups))
+	page, err = am.QueryAlertGroups(AlertQuery{Active: true, SortBy: SortByStartsAt})
+	require.NoError(t, err)
+	require.Equal(t, []string{"c", "b", "a"}, groupNames(page.Groups))
+
+	// Groups without alerts that match the filter are left out.
+	page, err = am.QueryAlertGroups(AlertQuery{Active: true, Filter: []string{"severity=~warning|info"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"c", "a"}, groupNames(page.Groups))
+	require.Len(t, page.Groups[1].Alerts, 1)
+	require.Equal(t, 2, page.Total)
+}
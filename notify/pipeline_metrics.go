@@ -0,0 +1,285 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/alertmanager/dispatch"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/grafana/alerting/tracing"
+)
+
+// Reasons for which alerts are removed from the notifications of a receiver.
+const (
+	suppressedBySilence         = "silence"
+	suppressedByInhibition      = "inhibition"
+	suppressedByMuteTime        = "mute_time"
+	suppressedByAcknowledgement = "acknowledgement"
+)
+
+// instrumentedNotifier observes the duration of the attempts of an integration, and the latency of the alerts it
+// delivers.
+type instrumentedNotifier struct {
+	integration *notify.Integration
+	// key identifies the integration in the receipts.
+	key      string
+	receipts *alertReceipts
+	duration prometheus.Observer
+	latency  prometheus.Observer
+}
+
+// Notify implements the Notifier interface.
+func (n *instrumentedNotifier) Notify(ctx context.Context, alerts ...*types.Alert) (bool, error) {
+	ctx, span := tracing.Start(ctx, "integration.notify", attribute.String("integration", n.integration.String()))
+	start := time.Now()
+	retry, err := n.integration.Notify(ctx, alerts...)
+	now := time.Now()
+	tracing.End(span, err)
+	n.duration.Observe(now.Sub(start).Seconds())
+	if err == nil {
+		for _, latency := range n.receipts.notified(n.key, alerts, now) {
+			n.latency.Observe(latency.Seconds())
+		}
+	}
+	return retry, err
+}
+
+// instrumentIntegrations returns the integrations of the receivers wrapped to observe their requests.
+func (am *GrafanaAlertmanager) instrumentIntegrations(integrationsMap map[string][]*notify.Integration) map[string][]*notify.Integration {
+	res := make(map[string][]*notify.Integration, len(integrationsMap))
+	for name, integrations := range integrationsMap {
+		for _, i := range integrations {
+			n := &instrumentedNotifier{
+				integration: i,
+				key:         name + "/" + i.String(),
+				receipts:    am.receipts,
+				duration:    am.Metrics.IntegrationRequestDuration.WithLabelValues(name, i.String()),
+				latency:     am.Metrics.NotificationLatency.WithLabelValues(name, i.String()),
+			}
+			res[name] = append(res[name], notify.NewIntegration(n, i, i.Name(), i.Index()))
+		}
+	}
+	return res
+}
+
+// alertReceipts records when the alerts were received in their current state, firing or resolved, for the latency
+// of their first notification in that state by each integration.
+type alertReceipts struct {
+	mtx      sync.Mutex
+	receipts map[model.Fingerprint]*alertReceipt
+}
+
+type alertReceipt struct {
+	at       time.Time
+	resolved bool
+	// notified are the integrations that notified the alert in its current state.
+	notified map[string]struct{}
+}
+
+func newAlertReceipts() *alertReceipts {
+	return &alertReceipts{receipts: make(map[model.Fingerprint]*alertReceipt)}
+}
+
+// stored records the time the alert is received, if it is new or changed state.
+func (r *alertReceipts) stored(a *types.Alert) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	fp := a.Fingerprint()
+	resolved := a.Resolved()
+	if rc, ok := r.receipts[fp]; ok && rc.resolved == resolved {
+		return
+	}
+	r.receipts[fp] = &alertReceipt{at: a.UpdatedAt, resolved: resolved, notified: map[string]struct{}{}}
+}
+
+// deleted forgets the alert, once it is deleted from the store.
+func (r *alertReceipts) deleted(a *types.Alert) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	delete(r.receipts, a.Fingerprint())
+}
+
+// notified returns the latencies of the alerts notified by the integration for the first time in their state.
+func (r *alertReceipts) notified(integration string, alerts []*types.Alert, now time.Time) []time.Duration {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	var res []time.Duration
+	for _, a := range alerts {
+		rc, ok := r.receipts[a.Fingerprint()]
+		if !ok {
+			continue
+		}
+		if resolved := a.Resolved(); resolved != rc.resolved {
+			if !resolved {
+				continue
+			}
+			// The alert resolved at its end, without being received resolved.
+			rc = &alertReceipt{at: a.EndsAt, resolved: true, notified: map[string]struct{}{}}
+			r.receipts[a.Fingerprint()] = rc
+		}
+		if _, ok := rc.notified[integration]; ok {
+			continue
+		}
+		rc.notified[integration] = struct{}{}
+		res = append(res, now.Sub(rc.at))
+	}
+	return res
+}
+
+// outcomeStage counts the notifications of its inner stage that are sent and failed, and their alerts.
+type outcomeStage struct {
+	next          notify.Stage
+	notifications *prometheus.CounterVec
+	alerts        *prometheus.CounterVec
+	receiver      string
+	integration   string
+}
+
+// Exec implements the Stage interface.
+func (s *outcomeStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	ctx, res, err := s.next.Exec(ctx, l, alerts...)
+	status := "sent"
+	if err != nil {
+		status = "failed"
+	}
+	s.notifications.WithLabelValues(s.receiver, s.integration, status).Inc()
+	s.alerts.WithLabelValues(s.receiver, s.integration, status).Add(float64(len(alerts)))
+	return ctx, res, err
+}
+
+// suppressionStage counts the alerts its inner stage removes from the notifications of a receiver, and the
+// notifications it suppresses entirely.
+type suppressionStage struct {
+	next          notify.Stage
+	notifications prometheus.Counter
+	alerts        prometheus.Counter
+}
+
+func (am *GrafanaAlertmanager) newSuppressionStage(next notify.Stage, receiver, reason string) notify.Stage {
+	return &suppressionStage{
+		next:          next,
+		notifications: am.Metrics.SuppressedNotifications.WithLabelValues(receiver, reason),
+		alerts:        am.Metrics.SuppressedAlerts.WithLabelValues(receiver, reason),
+	}
+}
+
+// Exec implements the Stage interface.
+func (s *suppressionStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	ctx, res, err := s.next.Exec(ctx, l, alerts...)
+	if err != nil {
+		return ctx, res, err
+	}
+	if removed := len(alerts) - len(res); removed > 0 {
+		s.alerts.Add(float64(removed))
+		if len(res) == 0 {
+			s.notifications.Inc()
+		}
+	}
+	return ctx, res, err
+}
+
+var aggrGroupsDesc = prometheus.NewDesc(
+	"alertmanager_route_aggregation_groups",
+	"The number of aggregation groups of a route.",
+	[]string{"route"}, nil,
+)
+
+// aggrGroupsRefreshInterval is how long the numbers of aggregation groups are cached, as counting them walks the
+// alerts of the dispatcher.
+const aggrGroupsRefreshInterval = 30 * time.Second
+
+// aggrGroupsCollector collects the number of aggregation groups of each route of the current configuration. The
+// numbers are cached for aggrGroupsRefreshInterval, so that frequent scrapes of many tenants do not walk the alerts
+// of all their dispatchers.
+type aggrGroupsCollector struct {
+	am  *GrafanaAlertmanager
+	now func() time.Time
+
+	mtx         sync.Mutex
+	counts      map[string]int
+	refreshedAt time.Time
+}
+
+func newAggrGroupsCollector(am *GrafanaAlertmanager) *aggrGroupsCollector {
+	return &aggrGroupsCollector{am: am, now: time.Now}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *aggrGroupsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- aggrGroupsDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *aggrGroupsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if now := c.now(); c.counts == nil || now.Sub(c.refreshedAt) >= aggrGroupsRefreshInterval {
+		c.counts = c.am.countAggrGroups()
+		c.refreshedAt = now
+	}
+	for key, n := range c.counts {
+		ch <- prometheus.MustNewConstMetric(aggrGroupsDesc, prometheus.GaugeValue, float64(n), key)
+	}
+}
+
+// countAggrGroups returns the number of aggregation groups of each route of the current configuration, by key. The
+// configuration lock is only held to read the dispatcher and the routes, so that counting does not block ApplyConfig.
+func (am *GrafanaAlertmanager) countAggrGroups() map[string]int {
+	am.reloadConfigMtx.RLock()
+	dispatcher, route := am.dispatcher, am.route
+	am.reloadConfigMtx.RUnlock()
+	if dispatcher == nil {
+		return nil
+	}
+
+	counts := map[string]int{}
+	route.Walk(func(r *dispatch.Route) {
+		counts[r.Key()] = 0
+	})
+	groups, _ := dispatcher.Groups(
+		func(*dispatch.Route) bool { return true },
+		func(*types.Alert, time.Time) bool { return true },
+	)
+	for _, g := range groups {
+		if r := routeOfGroup(route, g); r != nil {
+			counts[r.Key()]++
+		}
+	}
+	return counts
+}
+
+// routeOfGroup returns the route of the aggregation group, nil if no route of the tree matches it anymore.
+func routeOfGroup(root *dispatch.Route, g *dispatch.AlertGroup) *dispatch.Route {
+	if len(g.Alerts) == 0 {
+		return nil
+	}
+	labels := g.Alerts[0].Labels
+	for _, r := range root.Match(labels) {
+		if r.RouteOpts.Receiver == g.Receiver && routeGroupLabels(r, labels).Equal(g.Labels) {
+			return r
+		}
+	}
+	return nil
+}
+
+// routeGroupLabels returns the labels by which the route groups an alert with the given labels.
+func routeGroupLabels(r *dispatch.Route, labels model.LabelSet) model.LabelSet {
+	res := model.LabelSet{}
+	for name, value := range labels {
+		if _, ok := r.RouteOpts.GroupBy[name]; ok || r.RouteOpts.GroupByAll {
+			res[name] = value
+		}
+	}
+	return res
+}
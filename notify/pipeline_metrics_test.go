@@ -0,0 +1,215 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuppressionStage(t *testing.T) {
+	m := NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry())
+	am := &GrafanaAlertmanager{Metrics: m}
+	alerts := []*types.Alert{
+		{Alert: model.Alert{Labels: model.LabelSet{"alertname": "a"}}},
+		{Alert: model.Alert{Labels: model.LabelSet{"alertname": "b"}}},
+	}
+
+	keep := 1
+	s := am.newSuppressionStage(notify.StageFunc(func(ctx context.Context, _ log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+		return ctx, alerts[:keep], nil
+	}), "recv", suppressedBySilence)
+
+	_, res, err := s.Exec(context.Background(), log.NewNopLogger(), alerts...)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	require.Equal(t, 1.0, testutil.ToFloat64(m.SuppressedAlerts.WithLabelValues("recv", suppressedBySilence)))
+	require.Equal(t, 0.0, testutil.ToFloat64(m.SuppressedNotifications.WithLabelValues("recv", suppressedBySilence)))
+
+	keep = 0
+	_, res, err = s.Exec(context.Background(), log.NewNopLogger(), alerts...)
+	require.NoError(t, err)
+	require.Empty(t, res)
+	require.Equal(t, 3.0, testutil.ToFloat64(m.SuppressedAlerts.WithLabelValues("recv", suppressedBySilence)))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.SuppressedNotifications.WithLabelValues("recv", suppressedBySilence)))
+}
+
+func TestOutcomeStage(t *testing.T) {
+	m := NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry())
+	alerts := []*types.Alert{
+		{Alert: model.Alert{Labels: model.LabelSet{"alertname": "a"}}},
+		{Alert: model.Alert{Labels: model.LabelSet{"alertname": "b"}}},
+	}
+
+	var err error
+	s := &outcomeStage{
+		next: notify.StageFunc(func(ctx context.Context, _ log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+			return ctx, alerts, err
+		}),
+		notifications: m.ReceiverNotifications,
+		alerts:        m.ReceiverAlerts,
+		receiver:      "recv",
+		integration:   "webhook[0]",
+	}
+	_, _, _ = s.Exec(context.Background(), log.NewNopLogger(), alerts...)
+	err = errors.New("unavailable")
+	_, _, _ = s.Exec(context.Background(), log.NewNopLogger(), alerts[:1]...)
+
+	require.Equal(t, 1.0, testutil.ToFloat64(m.ReceiverNotifications.WithLabelValues("recv", "webhook[0]", "sent")))
+	require.Equal(t, 2.0, testutil.ToFloat64(m.ReceiverAlerts.WithLabelValues("recv", "webhook[0]", "sent")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.ReceiverNotifications.WithLabelValues("recv", "webhook[0]", "failed")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.ReceiverAlerts.WithLabelValues("recv", "webhook[0]", "failed")))
+}
+
+func TestSharedMetrics(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	m := NewSharedGrafanaAlertmanagerMetrics(reg)
+
+	var ams []*GrafanaAlertmanager
+	for _, tenantID := range []int64{1, 2} {
+		am, err := NewGrafanaAlertmanager("org", tenantID, &GrafanaAlertmanagerConfig{
+			Silences: newFakeMaintanenceOptions(t),
+			Nflog:    newFakeMaintanenceOptions(t),
+		}, &NilPeer{}, log.NewNopLogger(), m)
+		require.NoError(t, err)
+		ams = append(ams, am)
+
+		n := &fakeNotifier{}
+		groupWait := model.Duration(time.Millisecond)
+		cfg := newFakeConfig(t, &Route{
+			Receiver:  "recv",
+			GroupWait: &groupWait,
+			GroupBy:   []model.LabelName{model.AlertNameLabel},
+		}, map[string][]*Integration{
+			"recv": {NewIntegration(n, n, "webhook", 0)},
+		})
+		require.NoError(t, am.ApplyConfig(cfg))
+
+		require.NoError(t, am.PutAlerts(amv2.PostableAlerts{{
+			Alert:    amv2.Alert{Labels: amv2.LabelSet{"alertname": "test"}},
+			StartsAt: strfmt.DateTime(time.Now()),
+		}}))
+		require.Eventually(t, func() bool {
+			return len(n.notifications()) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	require.Eventually(t, func() bool {
+		err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP alertmanager_receiver_notifications_total The total number of notifications of a receiver, by status: sent or failed.
+# TYPE alertmanager_receiver_notifications_total counter
+alertmanager_receiver_notifications_total{integration="webhook[0]",receiver="recv",status="sent",tenant="1"} 1
+alertmanager_receiver_notifications_total{integration="webhook[0]",receiver="recv",status="sent",tenant="2"} 1
+# HELP alertmanager_route_aggregation_groups The number of aggregation groups of a route.
+# TYPE alertmanager_route_aggregation_groups gauge
+alertmanager_route_aggregation_groups{route="{}",tenant="1"} 1
+alertmanager_route_aggregation_groups{route="{}",tenant="2"} 1
+`), "alertmanager_receiver_notifications_total", "alertmanager_route_aggregation_groups")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	count, err := testutil.GatherAndCount(reg, "alertmanager_integration_request_duration_seconds", "alertmanager_notification_e2e_latency_seconds")
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+
+	// The metrics of a tenant are unregistered when its Alertmanager stops, so that it can be created again.
+	ams[0].StopAndWait()
+	count, err = testutil.GatherAndCount(reg, "alertmanager_route_aggregation_groups")
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	am, err := NewGrafanaAlertmanager("org", 1, &GrafanaAlertmanagerConfig{
+		Silences: newFakeMaintanenceOptions(t),
+		Nflog:    newFakeMaintanenceOptions(t),
+	}, &NilPeer{}, log.NewNopLogger(), m)
+	require.NoError(t, err)
+	am.StopAndWait()
+	ams[1].StopAndWait()
+}
+
+func TestAggrGroupsCollector(t *testing.T) {
+	am := setupAMTest(t)
+	t.Cleanup(am.StopAndWait)
+	n := &fakeNotifier{}
+	cfg := newFakeConfig(t, &Route{Receiver: "recv", GroupBy: []model.LabelName{model.AlertNameLabel}}, map[string][]*Integration{
+		"recv": {NewIntegration(n, n, "webhook", 0)},
+	})
+	require.NoError(t, am.ApplyConfig(cfg))
+
+	now := time.Now()
+	c := newAggrGroupsCollector(am)
+	c.now = func() time.Time { return now }
+	put := func(name string) {
+		require.NoError(t, am.PutAlerts(amv2.PostableAlerts{{
+			Alert:    amv2.Alert{Labels: amv2.LabelSet{"alertname": name}},
+			StartsAt: strfmt.DateTime(time.Now()),
+		}}))
+	}
+	expGroups := func(n int) string {
+		return fmt.Sprintf(`
+# HELP alertmanager_route_aggregation_groups The number of aggregation groups of a route.
+# TYPE alertmanager_route_aggregation_groups gauge
+alertmanager_route_aggregation_groups{route="{}"} %d
+`, n)
+	}
+
+	put("a")
+	require.Eventually(t, func() bool {
+		// Until the group exists, the scrape refreshes the counts as time passes.
+		now = now.Add(aggrGroupsRefreshInterval)
+		return testutil.CollectAndCompare(c, strings.NewReader(expGroups(1))) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The counts are cached until the refresh interval passes.
+	put("b")
+	require.Eventually(t, func() bool {
+		return am.countAggrGroups()["{}"] == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expGroups(1))))
+	now = now.Add(aggrGroupsRefreshInterval)
+	require.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expGroups(2))))
+}
+
+func TestAlertReceipts(t *testing.T) {
+	r := newAlertReceipts()
+	now := time.Now()
+	firing := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "test"}, StartsAt: now.Add(-time.Hour)}, UpdatedAt: now.Add(-time.Minute)}
+	unknown := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "unknown"}}}
+
+	// The latency is from the receipt of the alert, once per integration.
+	r.stored(firing)
+	require.Equal(t, []time.Duration{time.Minute}, r.notified("a", []*types.Alert{firing, unknown}, now))
+	require.Empty(t, r.notified("a", []*types.Alert{firing}, now))
+	require.Equal(t, []time.Duration{time.Minute}, r.notified("b", []*types.Alert{firing}, now))
+
+	// Updates of a firing alert keep its receipt.
+	updated := *firing
+	updated.UpdatedAt = now
+	r.stored(&updated)
+	require.Equal(t, []time.Duration{2 * time.Minute}, r.notified("c", []*types.Alert{firing}, now.Add(time.Minute)))
+
+	// An alert that resolved at its end is received at its end.
+	resolved := *firing
+	resolved.EndsAt = now.Add(-30 * time.Second)
+	require.Equal(t, []time.Duration{30 * time.Second}, r.notified("a", []*types.Alert{&resolved}, now))
+
+	// An alert received resolved is received at its update.
+	resolved.UpdatedAt = now.Add(-10 * time.Second)
+	r.stored(firing)
+	r.stored(&resolved)
+	require.Equal(t, []time.Duration{10 * time.Second}, r.notified("a", []*types.Alert{&resolved}, now))
+
+	r.deleted(&resolved)
+	require.Empty(t, r.receipts)
+}
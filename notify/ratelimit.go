@@ -0,0 +1,396 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// SuppressedNotificationsAlertName is the alertname of the summary sent once a rate limit lets notifications
+	// through again.
+	SuppressedNotificationsAlertName = "NotificationsSuppressed"
+
+	rateLimitSummaryTimeout = time.Minute
+)
+
+// RateLimit configures the rate limits of the notifications of a receiver. Notifications over the limit are not
+// sent, but are recorded in the notification log as if they were, and a summary with the number of suppressed
+// notifications is sent once the limit allows it. The limits carry over the configurations that do not change them.
+type RateLimit struct {
+	// Receiver limits the notifications of the receiver. A group notification takes a single token for all the
+	// integrations of the receiver, and they are all either sent or suppressed by this limit.
+	Receiver *TokenBucket `yaml:"receiver,omitempty" json:"receiver,omitempty"`
+	// Integration limits the notifications of each integration of the receiver.
+	Integration *TokenBucket `yaml:"integration,omitempty" json:"integration,omitempty"`
+}
+
+// TokenBucket allows Limit notifications per Interval, with bursts of up to Burst notifications.
+type TokenBucket struct {
+	Limit    int            `yaml:"limit" json:"limit"`
+	Interval model.Duration `yaml:"interval" json:"interval"`
+	// Burst defaults to Limit.
+	Burst int `yaml:"burst,omitempty" json:"burst,omitempty"`
+}
+
+func (l RateLimit) Validate() error {
+	if l.Receiver != nil {
+		if err := l.Receiver.Validate(); err != nil {
+			return fmt.Errorf("receiver: %w", err)
+		}
+	}
+	if l.Integration != nil {
+		if err := l.Integration.Validate(); err != nil {
+			return fmt.Errorf("integration: %w", err)
+		}
+	}
+	return nil
+}
+
+func (b TokenBucket) Validate() error {
+	if b.Limit <= 0 {
+		return errors.New("limit must be greater than zero")
+	}
+	if b.Interval <= 0 {
+		return errors.New("interval must be greater than zero")
+	}
+	if b.Burst < 0 {
+		return errors.New("burst must not be negative")
+	}
+	return nil
+}
+
+// tokenBucket is a token bucket that holds up to burst tokens and refills at rate tokens per second.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mtx    sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(cfg TokenBucket, now time.Time) *tokenBucket {
+	burst := cfg.Burst
+	if burst == 0 {
+		burst = cfg.Limit
+	}
+	return &tokenBucket{
+		rate:   float64(cfg.Limit) / time.Duration(cfg.Interval).Seconds(),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// refill must be called with the lock held.
+func (b *tokenBucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+// take takes a token if one is available.
+func (b *tokenBucket) take(now time.Time) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// refund gives back a token taken by take.
+func (b *tokenBucket) refund() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.tokens++
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// wait returns how long until a token is available.
+func (b *tokenBucket) wait(now time.Time) time.Duration {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// rateLimitKey is the key of the rate limiter of an integration, or of the bucket of a receiver if integration is
+// empty. The limiters and buckets of a rate limit that does not change are kept across configurations, so that
+// applying a configuration neither refills them nor drops the suppressed notifications.
+type rateLimitKey struct {
+	receiver    string
+	integration string
+	config      [32]byte
+}
+
+func rateLimiterKey(receiver string, integration *notify.Integration, l RateLimit) rateLimitKey {
+	return rateLimitKey{receiver: receiver, integration: integration.String(), config: digest(l)}
+}
+
+func receiverBucketKey(receiver string, l RateLimit) rateLimitKey {
+	return rateLimitKey{receiver: receiver, config: digest(l.Receiver)}
+}
+
+// receiverToken is the token of the receiver bucket for a group notification. The first integration that sends the
+// notification takes it and the other integrations of the receiver share it, so that the notification counts once
+// towards the limit of the receiver and its integrations are all either allowed or suppressed by it.
+type receiverToken struct {
+	once  sync.Once
+	taken bool
+}
+
+func (t *receiverToken) take(b *tokenBucket, now time.Time) bool {
+	t.once.Do(func() {
+		t.taken = b.take(now)
+	})
+	return t.taken
+}
+
+type receiverTokenKey struct{}
+
+// receiverRateLimitStage gives each group notification of a receiver with a receiver rate limit the token that its
+// integrations share.
+type receiverRateLimitStage struct {
+	next notify.Stage
+}
+
+// Exec implements the Stage interface.
+func (s *receiverRateLimitStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	return s.next.Exec(context.WithValue(ctx, receiverTokenKey{}, &receiverToken{}), l, alerts...)
+}
+
+// rateLimiter limits the notifications of an integration and sends the summary of the suppressed notifications.
+type rateLimiter struct {
+	groupName   string
+	integration string
+	// bucket is the bucket of the integration and receiver the bucket of its receiver, if they are configured.
+	bucket   *tokenBucket
+	receiver *tokenBucket
+	metric   prometheus.Counter
+	logger   log.Logger
+	now      func() time.Time
+
+	mtx sync.Mutex
+	// next sends the summary to the integration of the current configuration.
+	next       notify.Stage
+	suppressed int
+	timer      *time.Timer
+	stopped    bool
+}
+
+func newRateLimiter(groupName, integration string, bucket, receiver *tokenBucket, metric prometheus.Counter, l log.Logger) *rateLimiter {
+	return &rateLimiter{
+		groupName:   groupName,
+		integration: integration,
+		bucket:      bucket,
+		receiver:    receiver,
+		metric:      metric,
+		logger:      log.With(l, "receiver", groupName, "integration", integration),
+		now:         time.Now,
+	}
+}
+
+// use sends the summaries through the stage, which sends to the integration of the current configuration.
+func (r *rateLimiter) use(next notify.Stage) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.next = next
+}
+
+// allow takes a token from the bucket of the integration and one from the bucket of the receiver, or none if either
+// is empty. The token of the receiver is the one of the group notification of the context, if it has one.
+func (r *rateLimiter) allow(ctx context.Context) bool {
+	now := r.now()
+	if r.bucket != nil && !r.bucket.take(now) {
+		return false
+	}
+	if r.receiver != nil {
+		var taken bool
+		if t, ok := ctx.Value(receiverTokenKey{}).(*receiverToken); ok {
+			taken = t.take(r.receiver, now)
+		} else {
+			taken = r.receiver.take(now)
+		}
+		if !taken {
+			if r.bucket != nil {
+				r.bucket.refund()
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// wait returns how long until both buckets have a token.
+func (r *rateLimiter) wait() time.Duration {
+	now := r.now()
+	var d time.Duration
+	for _, b := range []*tokenBucket{r.bucket, r.receiver} {
+		if b == nil {
+			continue
+		}
+		if w := b.wait(now); w > d {
+			d = w
+		}
+	}
+	return d
+}
+
+// suppress counts a suppressed notification and schedules the summary if it is not already.
+func (r *rateLimiter) suppress() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.metric.Inc()
+	r.suppressed++
+	if r.timer == nil && !r.stopped {
+		r.timer = time.AfterFunc(r.wait(), r.flush)
+	}
+}
+
+// flush sends the summary of the suppressed notifications, or schedules it again if the rate limit does not allow it
+// yet.
+func (r *rateLimiter) flush() {
+	r.mtx.Lock()
+	if r.stopped {
+		r.mtx.Unlock()
+		return
+	}
+	// The summary is a notification of its own, it takes a token of the receiver.
+	if !r.allow(context.Background()) {
+		r.timer = time.AfterFunc(r.wait(), r.flush)
+		r.mtx.Unlock()
+		return
+	}
+	n, next := r.suppressed, r.next
+	r.suppressed = 0
+	r.timer = nil
+	r.mtx.Unlock()
+
+	if err := r.sendSummary(next, n); err != nil {
+		level.Warn(r.logger).Log("msg", "Failed to send the summary of suppressed notifications", "suppressed", n, "err", err)
+	}
+}
+
+func (r *rateLimiter) sendSummary(next notify.Stage, n int) error {
+	labels := model.LabelSet{
+		model.AlertNameLabel: SuppressedNotificationsAlertName,
+		"receiver":           model.LabelValue(r.groupName),
+		"integration":        model.LabelValue(r.integration),
+	}
+	now := r.now()
+	alert := &types.Alert{
+		Alert: model.Alert{
+			Labels: labels,
+			Annotations: model.LabelSet{
+				"summary": model.LabelValue(fmt.Sprintf("%d more notifications suppressed", n)),
+				"description": model.LabelValue(fmt.Sprintf("%d notifications of receiver %s were not sent to %s because they exceeded its rate limit.",
+					n, r.groupName, r.integration)),
+			},
+			StartsAt: now,
+		},
+		UpdatedAt: now,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rateLimitSummaryTimeout)
+	defer cancel()
+	ctx = notify.WithGroupKey(ctx, fmt.Sprintf("ratelimit:%s/%s", r.groupName, r.integration))
+	ctx = notify.WithGroupLabels(ctx, labels)
+	ctx = notify.WithReceiverName(ctx, r.groupName)
+	ctx = notify.WithRepeatInterval(ctx, 0)
+	ctx = notify.WithNow(ctx, now)
+	ctx = notify.WithFiringAlerts(ctx, []uint64{uint64(alert.Fingerprint())})
+	ctx = notify.WithResolvedAlerts(ctx, nil)
+
+	_, _, err := next.Exec(ctx, r.logger, alert)
+	return err
+}
+
+// stop stops the limiter and sends the summary of the suppressed notifications right away, whatever the rate limit,
+// as they were recorded as sent in the notification log.
+func (r *rateLimiter) stop() {
+	r.mtx.Lock()
+	if r.stopped {
+		r.mtx.Unlock()
+		return
+	}
+	r.stopped = true
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	n, next := r.suppressed, r.next
+	r.suppressed = 0
+	r.mtx.Unlock()
+
+	if n == 0 {
+		return
+	}
+	if err := r.sendSummary(next, n); err != nil {
+		level.Warn(r.logger).Log("msg", "Failed to send the summary of suppressed notifications", "suppressed", n, "err", err)
+	}
+}
+
+// stopRateLimiters stops the limiters, sending their pending summaries concurrently.
+func stopRateLimiters(limiters []*rateLimiter) {
+	var wg sync.WaitGroup
+	for _, l := range limiters {
+		wg.Add(1)
+		go func(l *rateLimiter) {
+			defer wg.Done()
+			l.stop()
+		}(l)
+	}
+	wg.Wait()
+}
+
+// rateLimitStage sends notifications to the next stage as long as the rate limit of its limiter allows it.
+// Suppressed notifications are reported as sent so that the notification log records them and deduplication stays
+// consistent.
+type rateLimitStage struct {
+	limiter     *rateLimiter
+	integration *notify.Integration
+	next        notify.Stage
+}
+
+// Exec implements the Stage interface.
+func (s *rateLimitStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	// Resolved alerts that are not sent do not count towards the limit.
+	if !s.integration.SendResolved() {
+		if firing, ok := notify.FiringAlerts(ctx); ok && len(firing) == 0 {
+			return s.next.Exec(ctx, l, alerts...)
+		}
+	}
+	if s.limiter.allow(ctx) {
+		return s.next.Exec(ctx, l, alerts...)
+	}
+	s.limiter.suppress()
+	level.Debug(l).Log("msg", "Notification suppressed by the rate limit", "receiver", s.limiter.groupName, "integration", s.limiter.integration)
+	return ctx, alerts, nil
+}
@@ -0,0 +1,219 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit_Validate(t *testing.T) {
+	cases := []struct {
+		name   string
+		limit  RateLimit
+		expErr string
+	}{
+		{
+			name:  "empty rate limit is valid",
+			limit: RateLimit{},
+		}, {
+			name: "complete rate limit is valid",
+			limit: RateLimit{
+				Receiver:    &TokenBucket{Limit: 10, Interval: model.Duration(time.Minute), Burst: 20},
+				Integration: &TokenBucket{Limit: 5, Interval: model.Duration(time.Minute)},
+			},
+		}, {
+			name:   "no limit",
+			limit:  RateLimit{Receiver: &TokenBucket{Interval: model.Duration(time.Minute)}},
+			expErr: "receiver: limit must be greater than zero",
+		}, {
+			name:   "no interval",
+			limit:  RateLimit{Integration: &TokenBucket{Limit: 1}},
+			expErr: "integration: interval must be greater than zero",
+		}, {
+			name:   "negative burst",
+			limit:  RateLimit{Integration: &TokenBucket{Limit: 1, Interval: model.Duration(time.Minute), Burst: -1}},
+			expErr: "integration: burst must not be negative",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.limit.Validate()
+			if c.expErr != "" {
+				require.EqualError(t, err, c.expErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(TokenBucket{Limit: 2, Interval: model.Duration(time.Minute)}, now)
+
+	require.True(t, b.take(now))
+	require.True(t, b.take(now))
+	require.False(t, b.take(now))
+	require.Equal(t, 30*time.Second, b.wait(now))
+
+	require.False(t, b.take(now.Add(20*time.Second)))
+	require.Equal(t, 10*time.Second, b.wait(now.Add(20*time.Second)))
+	require.True(t, b.take(now.Add(30*time.Second)))
+
+	// The bucket never holds more than the burst.
+	require.True(t, b.take(now.Add(time.Hour)))
+	require.True(t, b.take(now.Add(time.Hour)))
+	require.False(t, b.take(now.Add(time.Hour)))
+}
+
+func TestRateLimitStage(t *testing.T) {
+	m := NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry())
+	alerts := []*types.Alert{{Alert: model.Alert{Labels: model.LabelSet{"alertname": "test"}}}}
+	ctx := notify.WithFiringAlerts(context.Background(), []uint64{1})
+
+	// The limiters send through the rest of the pipeline, here straight to the notifiers.
+	next := func(n *fakeNotifier) notify.Stage {
+		return notify.StageFunc(func(ctx context.Context, _ log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+			_, err := n.Notify(ctx, alerts...)
+			return ctx, alerts, err
+		})
+	}
+
+	// Both integrations share the bucket of the receiver, which allows a single group notification.
+	receiverBucket := newTokenBucket(TokenBucket{Limit: 1, Interval: model.Duration(50 * time.Millisecond)}, time.Now())
+	slack := &fakeNotifier{}
+	slackLimiter := newRateLimiter("recv", "slack[0]", newTokenBucket(TokenBucket{Limit: 10, Interval: model.Duration(time.Second)}, time.Now()),
+		receiverBucket, m.RateLimitedNotifications.WithLabelValues("recv", "slack[0]"), log.NewNopLogger())
+	slackLimiter.use(next(slack))
+	t.Cleanup(slackLimiter.stop)
+	email := &fakeNotifier{}
+	emailLimiter := newRateLimiter("recv", "email[0]", nil, receiverBucket, m.RateLimitedNotifications.WithLabelValues("recv", "email[0]"), log.NewNopLogger())
+	emailLimiter.use(next(email))
+	t.Cleanup(emailLimiter.stop)
+	stage := &receiverRateLimitStage{next: notify.FanoutStage{
+		&rateLimitStage{limiter: slackLimiter, integration: NewIntegration(slack, slack, "slack", 0), next: next(slack)},
+		&rateLimitStage{limiter: emailLimiter, integration: NewIntegration(email, email, "email", 0), next: next(email)},
+	}}
+
+	// The group notification takes a single token of the receiver for both integrations.
+	_, res, err := stage.Exec(ctx, log.NewNopLogger(), alerts...)
+	require.NoError(t, err)
+	require.Equal(t, alerts, res)
+	require.Len(t, slack.notifications(), 1)
+	require.Len(t, email.notifications(), 1)
+
+	// Suppressed notifications are reported as sent so that the notification log records them.
+	for i := 0; i < 3; i++ {
+		_, res, err = stage.Exec(ctx, log.NewNopLogger(), alerts...)
+		require.NoError(t, err)
+		require.Equal(t, alerts, res)
+	}
+	require.Len(t, slack.notifications(), 1)
+	require.Len(t, email.notifications(), 1)
+	require.Equal(t, 3.0, testutil.ToFloat64(m.RateLimitedNotifications.WithLabelValues("recv", "slack[0]")))
+	require.Equal(t, 3.0, testutil.ToFloat64(m.RateLimitedNotifications.WithLabelValues("recv", "email[0]")))
+
+	// Once tokens refill, each integration sends a single summary of its suppressed notifications.
+	summaries := func() []*types.Alert {
+		var res []*types.Alert
+		for _, n := range [][][]*types.Alert{slack.notifications(), email.notifications()} {
+			for _, notification := range n {
+				for _, a := range notification {
+					if a.Labels[model.AlertNameLabel] == SuppressedNotificationsAlertName {
+						res = append(res, a)
+					}
+				}
+			}
+		}
+		return res
+	}
+	require.Eventually(t, func() bool {
+		return len(summaries()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	bySummary := map[model.LabelValue]model.LabelSet{}
+	for _, a := range summaries() {
+		require.Equal(t, model.LabelValue(SuppressedNotificationsAlertName), a.Labels[model.AlertNameLabel])
+		bySummary[a.Annotations["summary"]] = a.Labels
+	}
+	require.Len(t, bySummary, 1)
+	require.Equal(t, model.LabelValue("recv"), bySummary["3 more notifications suppressed"]["receiver"])
+
+	time.Sleep(100 * time.Millisecond)
+	require.Len(t, summaries(), 2)
+}
+
+func TestApplyConfigRateLimits(t *testing.T) {
+	am := setupAMTest(t)
+
+	n := &fakeNotifier{}
+	cfg := newFakeConfig(t, &Route{Receiver: "recv"}, map[string][]*Integration{
+		"recv":  {NewIntegration(n, n, "webhook", 0), NewIntegration(n, n, "email", 0)},
+		"other": {NewIntegration(n, n, "webhook", 0)},
+	})
+	cfg.rateLimits = map[string]RateLimit{"recv": {Receiver: &TokenBucket{Limit: 1, Interval: model.Duration(time.Minute)}}}
+	require.NoError(t, am.ApplyConfig(cfg))
+	require.Len(t, am.rateLimiters, 2)
+	require.Len(t, am.receiverBuckets, 1)
+
+	cfg.rateLimits = map[string]RateLimit{"recv": {Receiver: &TokenBucket{Limit: 1}}}
+	require.EqualError(t, am.ApplyConfig(cfg), `invalid rate limit for receiver "recv": receiver: interval must be greater than zero`)
+}
+
+func TestApplyConfigKeepsRateLimits(t *testing.T) {
+	am := setupAMTest(t)
+
+	n := &fakeNotifier{}
+	groupWait, groupInterval := model.Duration(time.Millisecond), model.Duration(10*time.Millisecond)
+	cfg := newFakeConfig(t, &Route{Receiver: "recv", GroupWait: &groupWait, GroupInterval: &groupInterval}, map[string][]*Integration{
+		"recv": {NewIntegration(n, n, "webhook", 0)},
+	})
+	cfg.rateLimits = map[string]RateLimit{"recv": {
+		Receiver:    &TokenBucket{Limit: 1, Interval: model.Duration(time.Hour)},
+		Integration: &TokenBucket{Limit: 1, Interval: model.Duration(time.Hour)},
+	}}
+	require.NoError(t, am.ApplyConfig(cfg))
+
+	suppressed := func() float64 {
+		return testutil.ToFloat64(am.Metrics.RateLimitedNotifications.WithLabelValues("recv", "webhook[0]"))
+	}
+	put := func(name string) {
+		require.NoError(t, am.PutAlerts(amv2.PostableAlerts{{
+			Alert:    amv2.Alert{Labels: amv2.LabelSet{"alertname": name}},
+			StartsAt: strfmt.DateTime(time.Now()),
+		}}))
+	}
+	put("a")
+	require.Eventually(t, func() bool { return len(n.notifications()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	put("b")
+	require.Eventually(t, func() bool { return suppressed() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// Applying the configuration neither refills the buckets nor drops the suppressed notifications.
+	limiters := am.rateLimiters
+	require.NoError(t, am.ApplyConfig(cfg))
+	put("c")
+	require.Eventually(t, func() bool { return suppressed() == 2 }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, am.ApplyConfig(cfg))
+	require.Equal(t, limiters, am.rateLimiters)
+	put("d")
+	require.Eventually(t, func() bool { return suppressed() == 3 }, 5*time.Second, 10*time.Millisecond)
+	require.Len(t, n.notifications(), 1)
+
+	// The suppressed notifications are summarized when the Alertmanager stops.
+	am.StopAndWait()
+	notifications := n.notifications()
+	require.Len(t, notifications, 2)
+	require.Equal(t, model.LabelValue(SuppressedNotificationsAlertName), notifications[1][0].Labels[model.AlertNameLabel])
+	require.Equal(t, model.LabelValue("3 more notifications suppressed"), notifications[1][0].Annotations["summary"])
+}
@@ -2,6 +2,7 @@ package notify
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/url"
@@ -13,6 +14,9 @@ import (
 	"github.com/prometheus/alertmanager/types"
 	"github.com/prometheus/common/model"
 	"golang.org/x/sync/errgroup"
+
+	"github.com/grafana/alerting/models"
+	"github.com/grafana/alerting/receivers"
 )
 
 const (
@@ -20,11 +24,14 @@ const (
 )
 
 var (
-	ErrNoReceivers = errors.New("no receivers")
+	ErrNoReceivers      = errors.New("no receivers")
+	ErrInvalidTestAlert = errors.New("invalid test alert")
 )
 
 type TestReceiversResult struct {
+	// Alert is the first alert of the test notification.
 	Alert     types.Alert
+	Alerts    []types.Alert
 	Receivers []TestReceiverResult
 	NotifedAt time.Time
 }
@@ -39,6 +46,9 @@ type TestReceiverConfigResult struct {
 	UID    string
 	Status string
 	Error  error
+	// Webhooks and Emails are what the integration would have sent, for a dry run.
+	Webhooks []receivers.SendWebhookSettings
+	Emails   []receivers.SendEmailSettings
 }
 
 type InvalidReceiverError struct {
@@ -67,13 +77,27 @@ type GrafanaReceivers struct {
 }
 
 type TestReceiversConfigBodyParams struct {
-	Alert     *TestReceiversConfigAlertParams `yaml:"alert,omitempty" json:"alert,omitempty"`
-	Receivers []*APIReceiver                  `yaml:"receivers,omitempty" json:"receivers,omitempty"`
+	Alert *TestReceiversConfigAlertParams `yaml:"alert,omitempty" json:"alert,omitempty"`
+	// Alerts are the alerts of the test notification. If empty, it has a single alert built from Alert.
+	Alerts []*TestReceiversConfigAlertParams `yaml:"alerts,omitempty" json:"alerts,omitempty"`
+	// GroupLabels are the labels of the group of the test notification.
+	GroupLabels model.LabelSet `yaml:"groupLabels,omitempty" json:"groupLabels,omitempty"`
+	// DryRun captures the webhooks and emails the integrations would send instead of sending them.
+	DryRun    bool           `yaml:"dryRun,omitempty" json:"dryRun,omitempty"`
+	Receivers []*APIReceiver `yaml:"receivers,omitempty" json:"receivers,omitempty"`
 }
 
 type TestReceiversConfigAlertParams struct {
 	Annotations model.LabelSet `yaml:"annotations,omitempty" json:"annotations,omitempty"`
 	Labels      model.LabelSet `yaml:"labels,omitempty" json:"labels,omitempty"`
+	// Status is either firing, the default, or resolved.
+	Status model.AlertStatus `yaml:"status,omitempty" json:"status,omitempty"`
+	// StartsAt defaults to the start of the test, or to EndsAt for resolved alerts that end before it.
+	StartsAt time.Time `yaml:"startsAt,omitempty" json:"startsAt,omitempty"`
+	// EndsAt defaults to the start of the test for resolved alerts.
+	EndsAt     time.Time          `yaml:"endsAt,omitempty" json:"endsAt,omitempty"`
+	Values     map[string]float64 `yaml:"values,omitempty" json:"values,omitempty"`
+	ImageToken string             `yaml:"imageToken,omitempty" json:"imageToken,omitempty"`
 }
 
 func (e InvalidReceiverError) Error() string {
@@ -89,13 +113,34 @@ func (e ReceiverTimeoutError) Error() string {
 	return fmt.Sprintf("the receiver timed out: %s", e.Err)
 }
 
+// TestReceivers sends a test notification with each of the receivers. The test is audited with the actor of the context.
 func (am *GrafanaAlertmanager) TestReceivers(ctx context.Context, c TestReceiversConfigBodyParams) (*TestReceiversResult, error) {
+	res, err := am.testReceivers(ctx, c)
+	names := make([]string, 0, len(c.Receivers))
+	for _, r := range c.Receivers {
+		names = append(names, r.Name)
+	}
+	am.audit(ctx, AuditEvent{Action: AuditTestReceivers, Receivers: names, DryRun: c.DryRun}, err)
+	return res, err
+}
+
+func (am *GrafanaAlertmanager) testReceivers(ctx context.Context, c TestReceiversConfigBodyParams) (*TestReceiversResult, error) {
 	// now represents the start time of the test
 	now := time.Now()
-	testAlert := newTestAlert(c, now, now)
+	testAlerts, err := newTestAlerts(c, now)
+	if err != nil {
+		return nil, err
+	}
+	alerts := make([]*types.Alert, 0, len(testAlerts))
+	for i := range testAlerts {
+		alerts = append(alerts, &testAlerts[i])
+	}
 
 	// we must set a group key that is unique per test as some receivers use this key to deduplicate alerts
-	ctx = notify.WithGroupKey(ctx, testAlert.Labels.String()+now.String())
+	ctx = notify.WithGroupKey(ctx, testAlerts[0].Labels.String()+now.String())
+	if len(c.GroupLabels) > 0 {
+		ctx = notify.WithGroupLabels(ctx, c.GroupLabels)
+	}
 
 	tmpl, err := am.getTemplate()
 	if err != nil {
@@ -114,9 +159,10 @@ func (am *GrafanaAlertmanager) TestReceivers(ctx context.Context, c TestReceiver
 		Config       *GrafanaReceiver
 		ReceiverName string
 		Error        error
+		Captured     *receivers.CapturingSender
 	}
 
-	newTestReceiversResult := func(alert types.Alert, results []result, notifiedAt time.Time) *TestReceiversResult {
+	newTestReceiversResult := func(alerts []types.Alert, results []result, notifiedAt time.Time) *TestReceiversResult {
 		m := make(map[string]TestReceiverResult)
 		for _, receiver := range c.Receivers {
 			// set up the result for this receiver
@@ -132,16 +178,22 @@ func (am *GrafanaAlertmanager) TestReceivers(ctx context.Context, c TestReceiver
 			if next.Error != nil {
 				status = "failed"
 			}
-			tmp.Configs = append(tmp.Configs, TestReceiverConfigResult{
+			configResult := TestReceiverConfigResult{
 				Name:   next.Config.Name,
 				UID:    next.Config.UID,
 				Status: status,
 				Error:  ProcessNotifierError(next.Config, next.Error),
-			})
+			}
+			if next.Captured != nil {
+				configResult.Webhooks = next.Captured.Webhooks()
+				configResult.Emails = next.Captured.Emails()
+			}
+			tmp.Configs = append(tmp.Configs, configResult)
 			m[next.ReceiverName] = tmp
 		}
 		v := new(TestReceiversResult)
-		v.Alert = alert
+		v.Alert = alerts[0]
+		v.Alerts = alerts
 		v.Receivers = make([]TestReceiverResult, 0, len(c.Receivers))
 		v.NotifedAt = notifiedAt
 		for _, next := range m {
@@ -185,7 +237,7 @@ func (am *GrafanaAlertmanager) TestReceivers(ctx context.Context, c TestReceiver
 	}
 
 	if len(jobs) == 0 {
-		return newTestReceiversResult(testAlert, invalid, now), nil
+		return newTestReceiversResult(testAlerts, invalid, now), nil
 	}
 
 	numWorkers := maxTestReceiversWorkers
@@ -208,7 +260,12 @@ func (am *GrafanaAlertmanager) TestReceivers(ctx context.Context, c TestReceiver
 					Config:       next.Config,
 					ReceiverName: next.ReceiverName,
 				}
-				if _, err := next.Notifier.Notify(ctx, &testAlert); err != nil {
+				notifyCtx := ctx
+				if c.DryRun {
+					v.Captured = &receivers.CapturingSender{}
+					notifyCtx = receivers.WithNotificationSender(ctx, v.Captured)
+				}
+				if _, err := next.Notifier.Notify(notifyCtx, alerts...); err != nil {
 					v.Error = err
 				}
 				resultCh <- v
@@ -228,7 +285,62 @@ func (am *GrafanaAlertmanager) TestReceivers(ctx context.Context, c TestReceiver
 		results = append(results, next)
 	}
 
-	return newTestReceiversResult(testAlert, append(invalid, results...), now), nil
+	return newTestReceiversResult(testAlerts, append(invalid, results...), now), nil
+}
+
+// newTestAlerts returns the alerts of a test notification.
+func newTestAlerts(c TestReceiversConfigBodyParams, now time.Time) ([]types.Alert, error) {
+	if len(c.Alerts) == 0 {
+		return []types.Alert{newTestAlert(c, now, now)}, nil
+	}
+
+	alerts := make([]types.Alert, 0, len(c.Alerts))
+	for i, params := range c.Alerts {
+		if params == nil {
+			return nil, fmt.Errorf("%w: alert %d is empty", ErrInvalidTestAlert, i)
+		}
+		alert := newTestAlert(TestReceiversConfigBodyParams{Alert: params}, now, now)
+		if !params.StartsAt.IsZero() {
+			alert.StartsAt = params.StartsAt
+		}
+		alert.EndsAt = params.EndsAt
+
+		switch params.Status {
+		case model.AlertResolved:
+			if alert.EndsAt.IsZero() {
+				alert.EndsAt = now
+			}
+			if alert.EndsAt.After(now) {
+				return nil, fmt.Errorf("%w: resolved alert %d must not end in the future", ErrInvalidTestAlert, i)
+			}
+			// A resolved alert without a start starts when it ends, as in PutAlerts.
+			if params.StartsAt.IsZero() && alert.EndsAt.Before(alert.StartsAt) {
+				alert.StartsAt = alert.EndsAt
+			}
+		case model.AlertFiring, "":
+			if !alert.EndsAt.IsZero() && !alert.EndsAt.After(now) {
+				return nil, fmt.Errorf("%w: firing alert %d must end in the future", ErrInvalidTestAlert, i)
+			}
+		default:
+			return nil, fmt.Errorf("%w: alert %d has an unknown status %q", ErrInvalidTestAlert, i, params.Status)
+		}
+		if !alert.EndsAt.IsZero() && alert.EndsAt.Before(alert.StartsAt) {
+			return nil, fmt.Errorf("%w: alert %d ends before it starts", ErrInvalidTestAlert, i)
+		}
+
+		if len(params.Values) > 0 {
+			b, err := json.Marshal(params.Values)
+			if err != nil {
+				return nil, fmt.Errorf("%w: alert %d has invalid values: %s", ErrInvalidTestAlert, i, err)
+			}
+			alert.Annotations[models.ValuesAnnotation] = model.LabelValue(b)
+		}
+		if params.ImageToken != "" {
+			alert.Annotations[models.ImageTokenAnnotation] = model.LabelValue(params.ImageToken)
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
 }
 
 func newTestAlert(c TestReceiversConfigBodyParams, startsAt, updatedAt time.Time) types.Alert {
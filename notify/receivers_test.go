@@ -2,11 +2,20 @@ package notify
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/alerting/images"
+	"github.com/grafana/alerting/logging"
+	"github.com/grafana/alerting/models"
+	"github.com/grafana/alerting/receivers"
 )
 
 func TestInvalidReceiverError_Error(t *testing.T) {
@@ -78,3 +87,205 @@ func TestProcessNotifierError(t *testing.T) {
 		require.Equal(t, err, ProcessNotifierError(r, err))
 	})
 }
+
+func TestNewTestAlerts(t *testing.T) {
+	now := time.Now()
+
+	t.Run("defaults to a single firing alert", func(t *testing.T) {
+		alerts, err := newTestAlerts(TestReceiversConfigBodyParams{}, now)
+		require.NoError(t, err)
+		require.Len(t, alerts, 1)
+		require.Equal(t, newTestAlert(TestReceiversConfigBodyParams{}, now, now), alerts[0])
+	})
+
+	t.Run("builds the given alerts", func(t *testing.T) {
+		alerts, err := newTestAlerts(TestReceiversConfigBodyParams{Alerts: []*TestReceiversConfigAlertParams{
+			{
+				Labels:     model.LabelSet{"alertname": "HighCPU"},
+				StartsAt:   now.Add(-time.Hour),
+				Values:     map[string]float64{"B": 95},
+				ImageToken: "token",
+			}, {
+				Labels: model.LabelSet{"alertname": "HighMemory"},
+				Status: model.AlertResolved,
+			}, {
+				Labels: model.LabelSet{"alertname": "HighDisk"},
+				Status: model.AlertResolved,
+				EndsAt: now.Add(-time.Hour),
+			},
+		}}, now)
+		require.NoError(t, err)
+		require.Len(t, alerts, 3)
+
+		require.Equal(t, model.LabelValue("HighCPU"), alerts[0].Labels["alertname"])
+		require.Equal(t, model.LabelValue("Grafana"), alerts[0].Labels["instance"])
+		require.Equal(t, now.Add(-time.Hour), alerts[0].StartsAt)
+		require.Equal(t, model.AlertFiring, alerts[0].Status())
+		require.Equal(t, model.LabelValue(`{"B":95}`), alerts[0].Annotations[models.ValuesAnnotation])
+		require.Equal(t, model.LabelValue("token"), alerts[0].Annotations[models.ImageTokenAnnotation])
+
+		require.Equal(t, model.LabelValue("HighMemory"), alerts[1].Labels["alertname"])
+		require.Equal(t, now, alerts[1].EndsAt)
+		require.Equal(t, model.AlertResolved, alerts[1].Status())
+
+		// A resolved alert that ended before the test starts when it ends.
+		require.Equal(t, now.Add(-time.Hour), alerts[2].StartsAt)
+		require.Equal(t, now.Add(-time.Hour), alerts[2].EndsAt)
+	})
+
+	cases := []struct {
+		name   string
+		alert  *TestReceiversConfigAlertParams
+		expErr string
+	}{
+		{
+			name:   "resolved alert ending in the future",
+			alert:  &TestReceiversConfigAlertParams{Status: model.AlertResolved, EndsAt: now.Add(time.Hour)},
+			expErr: "invalid test alert: resolved alert 0 must not end in the future",
+		}, {
+			name:   "firing alert that ended",
+			alert:  &TestReceiversConfigAlertParams{Status: model.AlertFiring, EndsAt: now.Add(-time.Hour)},
+			expErr: "invalid test alert: firing alert 0 must end in the future",
+		}, {
+			name:   "alert ending before it starts",
+			alert:  &TestReceiversConfigAlertParams{Status: model.AlertResolved, StartsAt: now, EndsAt: now.Add(-time.Hour)},
+			expErr: "invalid test alert: alert 0 ends before it starts",
+		}, {
+			name:   "unknown status",
+			alert:  &TestReceiversConfigAlertParams{Status: "pending"},
+			expErr: `invalid test alert: alert 0 has an unknown status "pending"`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := newTestAlerts(TestReceiversConfigBodyParams{Alerts: []*TestReceiversConfigAlertParams{c.alert}}, now)
+			require.ErrorIs(t, err, ErrInvalidTestAlert)
+			require.EqualError(t, err, c.expErr)
+		})
+	}
+}
+
+// failingSender fails the test if a notification is actually sent.
+type failingSender struct {
+	t *testing.T
+}
+
+func (s failingSender) SendWebhook(context.Context, *receivers.SendWebhookSettings) error {
+	s.t.Error("the webhook should not be sent")
+	return nil
+}
+
+func (s failingSender) SendEmail(context.Context, *receivers.SendEmailSettings) error {
+	s.t.Error("the email should not be sent")
+	return nil
+}
+
+func TestTestReceivers_DryRun(t *testing.T) {
+	am := setupAMTest(t)
+	require.NoError(t, am.ApplyConfig(newFakeConfig(t, &Route{Receiver: "recv"}, nil)))
+	am.buildReceiverIntegrationFunc = func(next *GrafanaReceiver, tmpl *Template) (Notifier, error) {
+		settings, err := json.Marshal(next.Settings)
+		require.NoError(t, err)
+		fc, err := receivers.NewFactoryConfig(&receivers.NotificationChannelConfig{
+			UID:      next.UID,
+			Name:     next.Name,
+			Type:     next.Type,
+			Settings: settings,
+		}, failingSender{t}, func(_ context.Context, _ map[string][]byte, _ string, fallback string) string {
+			return fallback
+		}, tmpl, &images.UnavailableImageStore{}, func(...interface{}) logging.Logger { return &logging.FakeLogger{} }, "")
+		require.NoError(t, err)
+		factory, ok := Factory(next.Type)
+		require.True(t, ok)
+		return factory(fc)
+	}
+
+	res, err := am.TestReceivers(context.Background(), TestReceiversConfigBodyParams{
+		Alerts: []*TestReceiversConfigAlertParams{
+			{Labels: model.LabelSet{"alertname": "HighCPU"}},
+			{Labels: model.LabelSet{"alertname": "HighMemory"}, Status: model.AlertResolved},
+		},
+		GroupLabels: model.LabelSet{"team": "a"},
+		DryRun:      true,
+		Receivers: []*APIReceiver{{
+			ConfigReceiver: ConfigReceiver{Name: "recv"},
+			GrafanaReceivers: GrafanaReceivers{Receivers: []*GrafanaReceiver{{
+				UID:      "uid",
+				Name:     "webhook",
+				Type:     "webhook",
+				Settings: map[string]interface{}{"url": "http://localhost/hook"},
+			}}},
+		}},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Alerts, 2)
+	require.Equal(t, res.Alerts[0], res.Alert)
+	require.Len(t, res.Receivers, 1)
+
+	cfg := res.Receivers[0].Configs[0]
+	require.Equal(t, "ok", cfg.Status)
+	require.Empty(t, cfg.Emails)
+	require.Len(t, cfg.Webhooks, 1)
+	require.Equal(t, "http://localhost/hook", cfg.Webhooks[0].URL)
+
+	var body struct {
+		Status      string            `json:"status"`
+		GroupLabels map[string]string `json:"groupLabels"`
+		Alerts      []struct {
+			Status string `json:"status"`
+		} `json:"alerts"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(cfg.Webhooks[0].Body), &body))
+	require.Equal(t, "firing", body.Status)
+	require.Equal(t, map[string]string{"team": "a"}, body.GroupLabels)
+	require.Len(t, body.Alerts, 2)
+	require.Equal(t, "resolved", body.Alerts[1].Status)
+}
+
+func TestTestReceivers_DryRunWithoutFactoryConfig(t *testing.T) {
+	am := setupAMTest(t)
+	require.NoError(t, am.ApplyConfig(newFakeConfig(t, &Route{Receiver: "recv"}, nil)))
+	// The host builds the factory config itself, so the sender is not wrapped by receivers.NewFactoryConfig.
+	am.buildReceiverIntegrationFunc = func(next *GrafanaReceiver, tmpl *Template) (Notifier, error) {
+		settings, err := json.Marshal(next.Settings)
+		require.NoError(t, err)
+		factory, ok := Factory(next.Type)
+		require.True(t, ok)
+		return factory(receivers.FactoryConfig{
+			Config: &receivers.NotificationChannelConfig{
+				UID:            next.UID,
+				Name:           next.Name,
+				Type:           next.Type,
+				Settings:       settings,
+				SecureSettings: map[string][]byte{},
+			},
+			NotificationService: failingSender{t},
+			DecryptFunc: func(_ context.Context, _ map[string][]byte, _ string, fallback string) string {
+				return fallback
+			},
+			ImageStore: &images.UnavailableImageStore{},
+			Template:   tmpl,
+			Logger:     &logging.FakeLogger{},
+		})
+	}
+
+	// The WeCom app fetches an access token with its own HTTP client outside of dry runs.
+	res, err := am.TestReceivers(context.Background(), TestReceiversConfigBodyParams{
+		DryRun: true,
+		Receivers: []*APIReceiver{{
+			ConfigReceiver: ConfigReceiver{Name: "recv"},
+			GrafanaReceivers: GrafanaReceivers{Receivers: []*GrafanaReceiver{{
+				UID:      "uid",
+				Name:     "wecom",
+				Type:     "wecom",
+				Settings: map[string]interface{}{"secret": "secret", "corp_id": "corp", "agent_id": "agent", "endpointUrl": "http://localhost:1"},
+			}}},
+		}},
+	})
+	require.NoError(t, err)
+	cfg := res.Receivers[0].Configs[0]
+	require.Equal(t, "ok", cfg.Status)
+	require.Len(t, cfg.Webhooks, 2)
+	require.True(t, strings.HasPrefix(cfg.Webhooks[0].URL, "http://localhost:1/cgi-bin/gettoken"), cfg.Webhooks[0].URL)
+	require.True(t, strings.HasPrefix(cfg.Webhooks[1].URL, "http://localhost:1/cgi-bin/message/send"), cfg.Webhooks[1].URL)
+}
@@ -0,0 +1,497 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/alertmanager/cluster"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedisKeyPrefix         = "alertmanager"
+	defaultRedisHeartbeatInterval = 5 * time.Second
+	defaultRedisFullSyncInterval  = cluster.DefaultPushPullInterval
+	defaultRedisSettleTimeout     = 5 * time.Second
+
+	// redisSendQueueSize bounds the broadcasts waiting to be published, further ones are dropped and recovered by
+	// the next full sync.
+	redisSendQueueSize = 1024
+
+	redisStateChannel = "state"
+	redisSyncChannel  = "sync"
+	redisMembersKey   = "members"
+
+	redisMessageUpdate    = "update"
+	redisMessageFullState = "full_state"
+)
+
+// RedisPeerConfig configures a peer of a cluster whose members replicate their state through Redis. Durations
+// default to those below when zero.
+type RedisPeerConfig struct {
+	// Address is the host:port of the Redis server.
+	Address  string
+	Username string
+	Password string
+	DB       int
+	// TLS secures the connection to Redis, if present.
+	TLS *tls.Config
+
+	// Name identifies the peer in the cluster and must be unique among its members. Defaults to the host name.
+	Name string
+	// KeyPrefix namespaces the keys and channels of the cluster, "alertmanager" by default. Clusters sharing a Redis
+	// server must use different prefixes.
+	KeyPrefix string
+
+	// HeartbeatInterval is how often the peer renews its membership, 5s by default.
+	HeartbeatInterval time.Duration
+	// HeartbeatTimeout is how long a member stays in the cluster after its last heartbeat. Defaults to three times
+	// HeartbeatInterval.
+	HeartbeatTimeout time.Duration
+	// FullSyncInterval is how often the peer publishes its full state, 1m by default. Broadcasts lost while a peer
+	// was disconnected are recovered by the next full sync.
+	FullSyncInterval time.Duration
+	// SettleTimeout is how long WaitReady waits for the other members to send their state after joining, 5s by
+	// default.
+	SettleTimeout time.Duration
+}
+
+func (c *RedisPeerConfig) applyDefaults() error {
+	if c.Name == "" {
+		name, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("failed to default the name of the peer to the host name: %w", err)
+		}
+		c.Name = name
+	}
+	if c.KeyPrefix == "" {
+		c.KeyPrefix = defaultRedisKeyPrefix
+	}
+	if c.HeartbeatInterval == 0 {
+		c.HeartbeatInterval = defaultRedisHeartbeatInterval
+	}
+	if c.HeartbeatTimeout == 0 {
+		c.HeartbeatTimeout = 3 * c.HeartbeatInterval
+	}
+	if c.FullSyncInterval == 0 {
+		c.FullSyncInterval = defaultRedisFullSyncInterval
+	}
+	if c.SettleTimeout == 0 {
+		c.SettleTimeout = defaultRedisSettleTimeout
+	}
+	return nil
+}
+
+// redisMessage is published on the channels of the cluster. Data is a broadcast or the full state of a state key
+// on state channels, and the state key whose full state is requested, or empty for all of them, on the sync channel.
+type redisMessage struct {
+	Peer string `json:"peer"`
+	Data []byte `json:"data,omitempty"`
+}
+
+type redisPeerMetrics struct {
+	members          prometheus.GaugeFunc
+	position         prometheus.GaugeFunc
+	messagesReceived *prometheus.CounterVec
+	messagesSent     *prometheus.CounterVec
+	messagesFailed   *prometheus.CounterVec
+	heartbeatsFailed prometheus.Counter
+}
+
+func newRedisPeerMetrics(p *RedisPeer, r prometheus.Registerer) *redisPeerMetrics {
+	m := &redisPeerMetrics{
+		members: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "alertmanager",
+			Subsystem: "redis_cluster",
+			Name:      "members",
+			Help:      "The number of members of the Redis cluster, as of the last heartbeat.",
+		}, func() float64 { return float64(p.ClusterSize()) }),
+		position: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "alertmanager",
+			Subsystem: "redis_cluster",
+			Name:      "position",
+			Help:      "The position of the peer in the Redis cluster.",
+		}, func() float64 { return float64(p.Position()) }),
+		messagesReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "alertmanager",
+			Subsystem: "redis_cluster",
+			Name:      "messages_received_total",
+			Help:      "The total number of messages received from the other members, by type: update or full_state.",
+		}, []string{"key", "type"}),
+		messagesSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "alertmanager",
+			Subsystem: "redis_cluster",
+			Name:      "messages_published_total",
+			Help:      "The total number of messages published to the other members, by type: update or full_state.",
+		}, []string{"key", "type"}),
+		messagesFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "alertmanager",
+			Subsystem: "redis_cluster",
+			Name:      "messages_publish_failures_total",
+			Help:      "The total number of messages that failed to be published, by type: update or full_state.",
+		}, []string{"key", "type"}),
+		heartbeatsFailed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "alertmanager",
+			Subsystem: "redis_cluster",
+			Name:      "heartbeat_failures_total",
+			Help:      "The total number of heartbeats that failed to renew the membership of the peer.",
+		}),
+	}
+	if r != nil {
+		r.MustRegister(m.members, m.position, m.messagesReceived, m.messagesSent, m.messagesFailed, m.heartbeatsFailed)
+	}
+	return m
+}
+
+// RedisPeer is a ClusterPeer whose state is replicated to the other peers through Redis, for environments where the
+// peers cannot reach each other. Broadcasts are published on a channel per state key, the full state is published
+// periodically and on request of joining peers, and the members heartbeat into a sorted set of Redis.
+type RedisPeer struct {
+	cfg     RedisPeerConfig
+	logger  log.Logger
+	client  *redis.Client
+	pubsub  *redis.PubSub
+	metrics *redisPeerMetrics
+
+	mtx      sync.RWMutex
+	states   map[string]cluster.State
+	members  []string
+	position int
+
+	sendc  chan redisBroadcast
+	readyc chan struct{}
+	stopc  chan struct{}
+	wg     sync.WaitGroup
+
+	stopOnce sync.Once
+	stopErr  error
+}
+
+// NewRedisPeer creates a peer, joins the cluster and requests the state of the other members. It fails if Redis is
+// unreachable. Its position in the cluster is its rank among the names of the members.
+func NewRedisPeer(cfg RedisPeerConfig, logger log.Logger, reg prometheus.Registerer) (*RedisPeer, error) {
+	if err := cfg.applyDefaults(); err != nil {
+		return nil, err
+	}
+	p := &RedisPeer{
+		cfg:    cfg,
+		logger: log.With(logger, "component", "cluster", "peer", cfg.Name),
+		client: redis.NewClient(&redis.Options{
+			Addr:      cfg.Address,
+			Username:  cfg.Username,
+			Password:  cfg.Password,
+			DB:        cfg.DB,
+			TLSConfig: cfg.TLS,
+		}),
+		states: map[string]cluster.State{},
+		sendc:  make(chan redisBroadcast, redisSendQueueSize),
+		readyc: make(chan struct{}),
+		stopc:  make(chan struct{}),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.SettleTimeout)
+	defer cancel()
+	if err := p.heartbeat(ctx); err != nil {
+		_ = p.client.Close()
+		return nil, fmt.Errorf("unable to join the Redis cluster: %w", err)
+	}
+
+	// The subscription is confirmed before requesting the state of the other members, so that their answers are not
+	// missed.
+	p.pubsub = p.client.PSubscribe(ctx, p.channel("*"))
+	if _, err := p.pubsub.Receive(ctx); err != nil {
+		_ = p.pubsub.Close()
+		_ = p.client.Close()
+		return nil, fmt.Errorf("unable to subscribe to the Redis cluster: %w", err)
+	}
+	p.metrics = newRedisPeerMetrics(p, reg)
+	if err := p.requestSync(ctx, ""); err != nil {
+		level.Warn(p.logger).Log("msg", "failed to request the state of the other members", "err", err)
+	}
+
+	p.wg.Add(4)
+	go p.receiveLoop()
+	go p.sendLoop()
+	go p.heartbeatLoop()
+	go p.fullSyncLoop()
+	go p.settle()
+
+	return p, nil
+}
+
+// channel returns the name of the channel or key of the cluster with the given elements.
+func (p *RedisPeer) channel(elems ...string) string {
+	return strings.Join(append([]string{p.cfg.KeyPrefix}, elems...), ":")
+}
+
+// AddState adds a state to replicate under the key and returns the channel on which to broadcast its updates. The
+// full state of the key is requested from the other members.
+func (p *RedisPeer) AddState(key string, s cluster.State, _ prometheus.Registerer) cluster.ClusterChannel {
+	p.mtx.Lock()
+	p.states[key] = s
+	p.mtx.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.HeartbeatInterval)
+	defer cancel()
+	if err := p.requestSync(ctx, key); err != nil {
+		level.Warn(p.logger).Log("msg", "failed to request the state of the other members", "key", key, "err", err)
+	}
+	return &redisChannel{peer: p, key: key}
+}
+
+// Position returns the rank of the peer among the names of the members, as of the last heartbeat.
+func (p *RedisPeer) Position() int {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	return p.position
+}
+
+// ClusterSize returns the number of members, as of the last heartbeat.
+func (p *RedisPeer) ClusterSize() int {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	return len(p.members)
+}
+
+// WaitReady waits until the other members had time to send their state after the peer joined.
+func (p *RedisPeer) WaitReady(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.readyc:
+		return nil
+	}
+}
+
+// Stop leaves the cluster and closes the connections to Redis. Stopping the peer again returns the same error.
+func (p *RedisPeer) Stop() error {
+	p.stopOnce.Do(func() {
+		p.stopErr = p.stop()
+	})
+	return p.stopErr
+}
+
+func (p *RedisPeer) stop() error {
+	close(p.stopc)
+	p.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.HeartbeatInterval)
+	defer cancel()
+	var errs []error
+	if err := p.client.ZRem(ctx, p.channel(redisMembersKey), p.cfg.Name).Err(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to leave the Redis cluster: %w", err))
+	}
+	if err := p.pubsub.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := p.client.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+func (p *RedisPeer) settle() {
+	select {
+	case <-time.After(p.cfg.SettleTimeout):
+	case <-p.stopc:
+	}
+	close(p.readyc)
+}
+
+// heartbeat renews the membership of the peer, expires the members which stopped heartbeating and updates the
+// position of the peer.
+func (p *RedisPeer) heartbeat(ctx context.Context) error {
+	now := time.Now()
+	key := p.channel(redisMembersKey)
+	var members *redis.StringSliceCmd
+	_, err := p.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.UnixMilli()), Member: p.cfg.Name})
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(now.Add(-p.cfg.HeartbeatTimeout).UnixMilli(), 10))
+		members = pipe.ZRange(ctx, key, 0, -1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	names := members.Val()
+	sort.Strings(names)
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.members = names
+	p.position = sort.SearchStrings(names, p.cfg.Name)
+	return nil
+}
+
+func (p *RedisPeer) heartbeatLoop() {
+	defer p.wg.Done()
+	t := time.NewTicker(p.cfg.HeartbeatInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.stopc:
+			return
+		case <-t.C:
+			ctx, cancel := context.WithTimeout(context.Background(), p.cfg.HeartbeatInterval)
+			if err := p.heartbeat(ctx); err != nil {
+				p.metrics.heartbeatsFailed.Inc()
+				level.Warn(p.logger).Log("msg", "failed to heartbeat into the Redis cluster", "err", err)
+			}
+			cancel()
+		}
+	}
+}
+
+func (p *RedisPeer) fullSyncLoop() {
+	defer p.wg.Done()
+	t := time.NewTicker(p.cfg.FullSyncInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.stopc:
+			return
+		case <-t.C:
+			p.publishFullStates("")
+		}
+	}
+}
+
+func (p *RedisPeer) sendLoop() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.stopc:
+			return
+		case b := <-p.sendc:
+			ctx, cancel := context.WithTimeout(context.Background(), p.cfg.HeartbeatInterval)
+			p.publishState(ctx, b.key, redisMessageUpdate, b.data)
+			cancel()
+		}
+	}
+}
+
+func (p *RedisPeer) receiveLoop() {
+	defer p.wg.Done()
+	msgc := p.pubsub.Channel()
+	for {
+		select {
+		case <-p.stopc:
+			return
+		case msg := <-msgc:
+			p.handle(msg)
+		}
+	}
+}
+
+func (p *RedisPeer) handle(msg *redis.Message) {
+	var m redisMessage
+	if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+		level.Warn(p.logger).Log("msg", "failed to decode message", "channel", msg.Channel, "err", err)
+		return
+	}
+	if m.Peer == p.cfg.Name {
+		return
+	}
+
+	if msg.Channel == p.channel(redisSyncChannel) {
+		p.publishFullStates(string(m.Data))
+		return
+	}
+
+	// State channels are named <prefix>:state:<type>:<key>.
+	rest := strings.TrimPrefix(msg.Channel, p.channel(redisStateChannel)+":")
+	typ, key, ok := strings.Cut(rest, ":")
+	if !ok || rest == msg.Channel {
+		return
+	}
+	p.mtx.RLock()
+	s, ok := p.states[key]
+	p.mtx.RUnlock()
+	if !ok {
+		return
+	}
+	p.metrics.messagesReceived.WithLabelValues(key, typ).Inc()
+	if err := s.Merge(m.Data); err != nil {
+		level.Warn(p.logger).Log("msg", "failed to merge state", "key", key, "type", typ, "from", m.Peer, "err", err)
+	}
+}
+
+func (p *RedisPeer) publish(ctx context.Context, channel string, data []byte) error {
+	b, err := json.Marshal(redisMessage{Peer: p.cfg.Name, Data: data})
+	if err != nil {
+		return err
+	}
+	return p.client.Publish(ctx, channel, b).Err()
+}
+
+func (p *RedisPeer) publishState(ctx context.Context, key, typ string, data []byte) {
+	if err := p.publish(ctx, p.channel(redisStateChannel, typ, key), data); err != nil {
+		p.metrics.messagesFailed.WithLabelValues(key, typ).Inc()
+		level.Warn(p.logger).Log("msg", "failed to publish state", "key", key, "type", typ, "err", err)
+		return
+	}
+	p.metrics.messagesSent.WithLabelValues(key, typ).Inc()
+}
+
+// publishFullStates publishes the full state of the key, or of all of them if the key is empty.
+func (p *RedisPeer) publishFullStates(key string) {
+	p.mtx.RLock()
+	states := make(map[string]cluster.State, len(p.states))
+	for k, s := range p.states {
+		if key == "" || k == key {
+			states[k] = s
+		}
+	}
+	p.mtx.RUnlock()
+
+	for k, s := range states {
+		b, err := s.MarshalBinary()
+		if err != nil {
+			level.Warn(p.logger).Log("msg", "failed to encode state", "key", k, "err", err)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), p.cfg.HeartbeatInterval)
+		p.publishState(ctx, k, redisMessageFullState, b)
+		cancel()
+	}
+}
+
+// requestSync asks the other members to publish the full state of the key, or of all of them if the key is empty.
+func (p *RedisPeer) requestSync(ctx context.Context, key string) error {
+	return p.publish(ctx, p.channel(redisSyncChannel), []byte(key))
+}
+
+type redisBroadcast struct {
+	key  string
+	data []byte
+}
+
+// redisChannel broadcasts the updates of a state key to the other members.
+type redisChannel struct {
+	peer *RedisPeer
+	key  string
+}
+
+// Broadcast implements the cluster.ClusterChannel interface. The update is published asynchronously, as the states
+// broadcast while holding their locks.
+func (c *redisChannel) Broadcast(b []byte) {
+	select {
+	case c.peer.sendc <- redisBroadcast{key: c.key, data: b}:
+	default:
+		c.peer.metrics.messagesFailed.WithLabelValues(c.key, redisMessageUpdate).Inc()
+		level.Warn(c.peer.logger).Log("msg", "dropping broadcast, the send queue is full", "key", c.key)
+	}
+}
@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-kit/log"
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/nflog"
+	"github.com/prometheus/alertmanager/nflog/nflogpb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedisPeer(t *testing.T, addr, name string) *RedisPeer {
+	t.Helper()
+	p, err := NewRedisPeer(RedisPeerConfig{
+		Address:           addr,
+		Name:              name,
+		HeartbeatInterval: 10 * time.Millisecond,
+		FullSyncInterval:  50 * time.Millisecond,
+		SettleTimeout:     100 * time.Millisecond,
+	}, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+	return p
+}
+
+func TestRedisPeer(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	var peers []*RedisPeer
+	for _, name := range []string{"c", "a", "b"} {
+		p := newTestRedisPeer(t, mr.Addr(), name)
+		if name != "a" {
+			t.Cleanup(func() { _ = p.Stop() })
+		}
+		peers = append(peers, p)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, p := range peers {
+		require.NoError(t, p.WaitReady(ctx))
+	}
+	require.Eventually(t, func() bool {
+		for _, p := range peers {
+			if p.ClusterSize() != 3 {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	// The position is the rank of the name of the peer.
+	require.Equal(t, 2, peers[0].Position())
+	require.Equal(t, 0, peers[1].Position())
+	require.Equal(t, 1, peers[2].Position())
+
+	// A peer which stops is removed from the cluster.
+	require.NoError(t, peers[1].Stop())
+	require.NoError(t, peers[1].Stop())
+	peers = append(peers[:1], peers[2:]...)
+	require.Eventually(t, func() bool {
+		return peers[0].ClusterSize() == 2 && peers[0].Position() == 1 && peers[1].Position() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The state of the Alertmanagers of the same tenant is replicated through their peers.
+	var ams []*GrafanaAlertmanager
+	var notifiers []*fakeNotifier
+	for _, p := range peers {
+		am, err := NewGrafanaAlertmanager("org", 1, &GrafanaAlertmanagerConfig{
+			Silences: newFakeMaintanenceOptions(t),
+			Nflog:    newFakeMaintanenceOptions(t),
+		}, p, log.NewNopLogger(), NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry()))
+		require.NoError(t, err)
+		t.Cleanup(am.StopAndWait)
+
+		n := &fakeNotifier{}
+		groupWait := model.Duration(time.Millisecond)
+		require.NoError(t, am.ApplyConfig(newFakeConfig(t, &Route{Receiver: "recv", GroupWait: &groupWait}, map[string][]*Integration{
+			"recv": {NewIntegration(n, n, "webhook", 0)},
+		})))
+		ams = append(ams, am)
+		notifiers = append(notifiers, n)
+	}
+
+	startsAt, endsAt := strfmt.DateTime(time.Now()), strfmt.DateTime(time.Now().Add(time.Hour))
+	comment, createdBy := "maintenance", "admin"
+	matcherName, matcherValue, isRegex := "alertname", "silenced", false
+	silenceID, err := ams[0].CreateSilence(&PostableSilence{Silence: amv2.Silence{
+		Comment:   &comment,
+		CreatedBy: &createdBy,
+		StartsAt:  &startsAt,
+		EndsAt:    &endsAt,
+		Matchers:  amv2.Matchers{{Name: &matcherName, Value: &matcherValue, IsRegex: &isRegex}},
+	}})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, err := ams[1].GetSilence(silenceID)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, ams[0].PutAlerts(amv2.PostableAlerts{{
+		Alert:    amv2.Alert{Labels: amv2.LabelSet{"alertname": "test"}},
+		StartsAt: strfmt.DateTime(time.Now()),
+	}}))
+	require.Eventually(t, func() bool {
+		return len(notifiers[0].notifications()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		entries, err := ams[1].notificationLog.Query(nflog.QReceiver(&nflogpb.Receiver{GroupName: "recv", Integration: "webhook"}), nflog.QGroupKey("{}:{}"))
+		return err == nil && len(entries) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A peer which joins later receives the full state of the others.
+	late := newTestRedisPeer(t, mr.Addr(), "d")
+	t.Cleanup(func() { _ = late.Stop() })
+	am, err := NewGrafanaAlertmanager("org", 1, &GrafanaAlertmanagerConfig{
+		Silences: newFakeMaintanenceOptions(t),
+		Nflog:    newFakeMaintanenceOptions(t),
+	}, late, log.NewNopLogger(), NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry()))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, err := am.GetSilence(silenceID)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,284 @@
+package notify
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/alerting/models"
+)
+
+// RelabelAction is the action of a relabel config.
+type RelabelAction string
+
+const (
+	RelabelReplace   RelabelAction = "replace"
+	RelabelKeep      RelabelAction = "keep"
+	RelabelDrop      RelabelAction = "drop"
+	RelabelKeepEqual RelabelAction = "keepequal"
+	RelabelDropEqual RelabelAction = "dropequal"
+	RelabelHashMod   RelabelAction = "hashmod"
+	RelabelLabelMap  RelabelAction = "labelmap"
+	RelabelLabelDrop RelabelAction = "labeldrop"
+	RelabelLabelKeep RelabelAction = "labelkeep"
+	RelabelLowercase RelabelAction = "lowercase"
+	RelabelUppercase RelabelAction = "uppercase"
+)
+
+// AnnotationLabelPrefix is the prefix of the labels that expose the annotations of an alert to the relabel configs,
+// for example __annotation_summary. These labels are removed once the alert is relabeled, and changing them does not
+// change the annotations.
+const AnnotationLabelPrefix = "__annotation_"
+
+const (
+	defaultRelabelSeparator   = ";"
+	defaultRelabelRegex       = "(.*)"
+	defaultRelabelReplacement = "$1"
+)
+
+var relabelTargetRe = regexp.MustCompile(`^(?:(?:[a-zA-Z_]|\$(?:\{\w+\}|\w+))+\w*)+$`)
+
+// RelabelConfig relabels the alerts received by PutAlerts, with the semantics of the relabel configs of Prometheus.
+// Alerts are dropped by the keep, drop, keepequal and dropequal actions.
+type RelabelConfig struct {
+	SourceLabels model.LabelNames `yaml:"source_labels,flow,omitempty" json:"source_labels,omitempty"`
+	// Separator joins the values of the source labels, it defaults to ";".
+	Separator string `yaml:"separator,omitempty" json:"separator,omitempty"`
+	// Regex is matched against the joined values of the source labels, or the label names for labelmap, labeldrop
+	// and labelkeep. It is anchored at both ends and defaults to "(.*)".
+	Regex       string `yaml:"regex,omitempty" json:"regex,omitempty"`
+	Modulus     uint64 `yaml:"modulus,omitempty" json:"modulus,omitempty"`
+	TargetLabel string `yaml:"target_label,omitempty" json:"target_label,omitempty"`
+	// Replacement is the value written to the target label by replace, it defaults to "$1".
+	Replacement *string `yaml:"replacement,omitempty" json:"replacement,omitempty"`
+	// Action defaults to replace.
+	Action RelabelAction `yaml:"action,omitempty" json:"action,omitempty"`
+}
+
+type relabelRule struct {
+	RelabelConfig
+	regex       *regexp.Regexp
+	separator   string
+	replacement string
+}
+
+func newRelabelRule(c RelabelConfig) (*relabelRule, error) {
+	r := &relabelRule{RelabelConfig: c, separator: c.Separator, replacement: defaultRelabelReplacement}
+	if r.Action == "" {
+		r.Action = RelabelReplace
+	}
+	if r.separator == "" {
+		r.separator = defaultRelabelSeparator
+	}
+	if c.Replacement != nil {
+		r.replacement = *c.Replacement
+	}
+	regex := c.Regex
+	if regex == "" {
+		regex = defaultRelabelRegex
+	}
+	var err error
+	if r.regex, err = regexp.Compile("^(?:" + regex + ")$"); err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %w", c.Regex, err)
+	}
+
+	switch r.Action {
+	case RelabelReplace:
+		if c.TargetLabel == "" {
+			return nil, fmt.Errorf("target_label is required for %s", r.Action)
+		}
+		if !relabelTargetRe.MatchString(c.TargetLabel) {
+			return nil, fmt.Errorf("%q is an invalid target_label for %s", c.TargetLabel, r.Action)
+		}
+	case RelabelKeepEqual, RelabelDropEqual, RelabelHashMod, RelabelLowercase, RelabelUppercase:
+		if !model.LabelName(c.TargetLabel).IsValid() {
+			return nil, fmt.Errorf("%q is an invalid target_label for %s", c.TargetLabel, r.Action)
+		}
+		if r.Action == RelabelHashMod && c.Modulus == 0 {
+			return nil, errors.New("modulus is required for hashmod")
+		}
+		if (r.Action == RelabelKeepEqual || r.Action == RelabelDropEqual) && (c.Regex != "" || c.Modulus != 0 || c.Replacement != nil) {
+			return nil, fmt.Errorf("regex, modulus and replacement must not be set for %s", r.Action)
+		}
+	case RelabelLabelMap:
+		if !relabelTargetRe.MatchString(r.replacement) {
+			return nil, fmt.Errorf("%q is an invalid replacement for %s", r.replacement, r.Action)
+		}
+	case RelabelLabelDrop, RelabelLabelKeep:
+		if len(c.SourceLabels) > 0 || c.TargetLabel != "" || c.Separator != "" || c.Modulus != 0 || c.Replacement != nil {
+			return nil, fmt.Errorf("only regex must be set for %s", r.Action)
+		}
+	case RelabelKeep, RelabelDrop:
+	default:
+		return nil, fmt.Errorf("unknown action %q", r.Action)
+	}
+	return r, nil
+}
+
+// Validate checks the relabel config.
+func (c RelabelConfig) Validate() error {
+	_, err := newRelabelRule(c)
+	return err
+}
+
+func newRelabelRules(configs []RelabelConfig) ([]*relabelRule, error) {
+	rules := make([]*relabelRule, 0, len(configs))
+	for i, c := range configs {
+		r, err := newRelabelRule(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid relabel config %d: %w", i, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// apply relabels ls in place and returns false if the alert is dropped.
+func (r *relabelRule) apply(ls model.LabelSet) bool {
+	values := make([]string, 0, len(r.SourceLabels))
+	for _, n := range r.SourceLabels {
+		values = append(values, string(ls[n]))
+	}
+	val := strings.Join(values, r.separator)
+
+	switch r.Action {
+	case RelabelKeep:
+		return r.regex.MatchString(val)
+	case RelabelDrop:
+		return !r.regex.MatchString(val)
+	case RelabelKeepEqual:
+		return string(ls[model.LabelName(r.TargetLabel)]) == val
+	case RelabelDropEqual:
+		return string(ls[model.LabelName(r.TargetLabel)]) != val
+	case RelabelReplace:
+		indexes := r.regex.FindStringSubmatchIndex(val)
+		if indexes == nil {
+			break
+		}
+		target := model.LabelName(r.regex.ExpandString(nil, r.TargetLabel, val, indexes))
+		if !target.IsValid() {
+			break
+		}
+		res := r.regex.ExpandString(nil, r.replacement, val, indexes)
+		if len(res) == 0 {
+			delete(ls, target)
+			break
+		}
+		ls[target] = model.LabelValue(res)
+	case RelabelLowercase:
+		ls[model.LabelName(r.TargetLabel)] = model.LabelValue(strings.ToLower(val))
+	case RelabelUppercase:
+		ls[model.LabelName(r.TargetLabel)] = model.LabelValue(strings.ToUpper(val))
+	case RelabelHashMod:
+		ls[model.LabelName(r.TargetLabel)] = model.LabelValue(fmt.Sprintf("%d", sum64(md5.Sum([]byte(val)))%r.Modulus))
+	case RelabelLabelMap:
+		mapped := model.LabelSet{}
+		for n, v := range ls {
+			if r.regex.MatchString(string(n)) {
+				mapped[model.LabelName(r.regex.ReplaceAllString(string(n), r.replacement))] = v
+			}
+		}
+		for n, v := range mapped {
+			ls[n] = v
+		}
+	case RelabelLabelDrop, RelabelLabelKeep:
+		for n := range ls {
+			if r.regex.MatchString(string(n)) == (r.Action == RelabelLabelDrop) {
+				delete(ls, n)
+			}
+		}
+	}
+	return true
+}
+
+// sum64 sums the md5 hash to an uint64, as Prometheus does for hashmod.
+func sum64(hash [md5.Size]byte) uint64 {
+	var s uint64
+	for i, b := range hash {
+		shift := uint64((md5.Size - 1 - i) * 8)
+		s |= uint64(b) << shift
+	}
+	return s
+}
+
+// relabel returns the labels of the alert relabeled by the rules, or the index of the rule that dropped the alert.
+// The labels and annotations are not modified.
+func relabel(rules []*relabelRule, labels, annotations model.LabelSet) (model.LabelSet, int) {
+	ls := make(model.LabelSet, len(labels)+len(annotations))
+	for n, v := range labels {
+		ls[n] = v
+	}
+	for n, v := range annotations {
+		ls[AnnotationLabelPrefix+n] = v
+	}
+	for i, r := range rules {
+		if !r.apply(ls) {
+			return nil, i
+		}
+	}
+	for n := range ls {
+		if strings.HasPrefix(string(n), AnnotationLabelPrefix) {
+			delete(ls, n)
+		}
+	}
+	return ls, -1
+}
+
+// TestRelabelingResult shows the labels of an alert before and after relabeling.
+type TestRelabelingResult struct {
+	Labels model.LabelSet
+	// RelabeledLabels is nil if the alert is dropped.
+	RelabeledLabels model.LabelSet
+	Dropped         bool
+	// DroppedBy is the index of the relabel config that dropped the alert.
+	DroppedBy int
+}
+
+// TestRelabeling relabels the alert with the configs without saving them, or with the relabel configs of the current
+// configuration if configs is nil.
+func (am *GrafanaAlertmanager) TestRelabeling(configs []RelabelConfig, alert *amv2.PostableAlert) (*TestRelabelingResult, error) {
+	var rules []*relabelRule
+	if configs == nil {
+		am.reloadConfigMtx.RLock()
+		rules = am.relabelRules
+		am.reloadConfigMtx.RUnlock()
+	} else {
+		var err error
+		if rules, err = newRelabelRules(configs); err != nil {
+			return nil, err
+		}
+	}
+
+	labels, annotations := postableAlertLabels(alert)
+	relabeled, droppedBy := relabel(rules, labels, annotations)
+	res := &TestRelabelingResult{Labels: labels, RelabeledLabels: relabeled}
+	if relabeled == nil {
+		res.Dropped = true
+		res.DroppedBy = droppedBy
+	}
+	return res, nil
+}
+
+// postableAlertLabels returns the labels and annotations of the alert, without the empty ones and the namespace UID
+// label.
+func postableAlertLabels(a *amv2.PostableAlert) (model.LabelSet, model.LabelSet) {
+	labels, annotations := model.LabelSet{}, model.LabelSet{}
+	for k, v := range a.Labels {
+		if len(v) == 0 || k == models.NamespaceUIDLabel { // Skip empty and namespace UID labels.
+			continue
+		}
+		labels[model.LabelName(k)] = model.LabelValue(v)
+	}
+	for k, v := range a.Annotations {
+		if len(v) == 0 { // Skip empty annotation.
+			continue
+		}
+		annotations[model.LabelName(k)] = model.LabelValue(v)
+	}
+	return labels, annotations
+}
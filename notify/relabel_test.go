@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelabelConfigValidate(t *testing.T) {
+	empty := ""
+	cases := []struct {
+		name   string
+		config RelabelConfig
+		expErr string
+	}{
+		{name: "replace without target", config: RelabelConfig{SourceLabels: model.LabelNames{"a"}}, expErr: "target_label is required for replace"},
+		{name: "invalid target", config: RelabelConfig{TargetLabel: "1a"}, expErr: `"1a" is an invalid target_label for replace`},
+		{name: "invalid regex", config: RelabelConfig{Regex: "(", TargetLabel: "a"}, expErr: `invalid regex "("`},
+		{name: "unknown action", config: RelabelConfig{Action: "rename"}, expErr: `unknown action "rename"`},
+		{name: "hashmod without modulus", config: RelabelConfig{Action: RelabelHashMod, TargetLabel: "shard"}, expErr: "modulus is required for hashmod"},
+		{name: "lowercase with template target", config: RelabelConfig{Action: RelabelLowercase, TargetLabel: "${1}"}, expErr: `"${1}" is an invalid target_label for lowercase`},
+		{name: "keepequal with regex", config: RelabelConfig{Action: RelabelKeepEqual, TargetLabel: "a", Regex: "b"}, expErr: "regex, modulus and replacement must not be set for keepequal"},
+		{name: "labeldrop with target", config: RelabelConfig{Action: RelabelLabelDrop, Regex: "a", TargetLabel: "b"}, expErr: "only regex must be set for labeldrop"},
+		{name: "labelmap with invalid replacement", config: RelabelConfig{Action: RelabelLabelMap, Replacement: &empty}, expErr: `"" is an invalid replacement for labelmap`},
+		{name: "replace", config: RelabelConfig{SourceLabels: model.LabelNames{"a"}, TargetLabel: "${1}_b", Replacement: &empty}},
+		{name: "drop", config: RelabelConfig{SourceLabels: model.LabelNames{"a"}, Regex: "b", Action: RelabelDrop}},
+		{name: "labelmap", config: RelabelConfig{Action: RelabelLabelMap, Regex: "team_(.+)"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.config.Validate()
+			if c.expErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, c.expErr)
+		})
+	}
+}
+
+func TestRelabel(t *testing.T) {
+	ptr := func(s string) *string { return &s }
+	cases := []struct {
+		name         string
+		configs      []RelabelConfig
+		labels       model.LabelSet
+		annotations  model.LabelSet
+		expLabels    model.LabelSet
+		expDroppedBy int
+	}{{
+		name: "normalise severity",
+		configs: []RelabelConfig{
+			{SourceLabels: model.LabelNames{"severity"}, Action: RelabelLowercase, TargetLabel: "severity"},
+			{SourceLabels: model.LabelNames{"severity"}, Regex: "crit|p1", TargetLabel: "severity", Replacement: ptr("critical")},
+		},
+		labels:    model.LabelSet{"alertname": "a", "severity": "CRIT"},
+		expLabels: model.LabelSet{"alertname": "a", "severity": "critical"},
+	}, {
+		name:      "drop noisy labels",
+		configs:   []RelabelConfig{{Action: RelabelLabelDrop, Regex: "pod|instance"}},
+		labels:    model.LabelSet{"alertname": "a", "pod": "p-1", "instance": "i"},
+		expLabels: model.LabelSet{"alertname": "a"},
+	}, {
+		name:        "copy annotation into label",
+		configs:     []RelabelConfig{{SourceLabels: model.LabelNames{AnnotationLabelPrefix + "runbook"}, Regex: ".*/(.+)", TargetLabel: "runbook"}},
+		labels:      model.LabelSet{"alertname": "a"},
+		annotations: model.LabelSet{"runbook": "http://localhost/runbooks/disk"},
+		expLabels:   model.LabelSet{"alertname": "a", "runbook": "disk"},
+	}, {
+		name:      "empty replacement deletes the label",
+		configs:   []RelabelConfig{{TargetLabel: "team", Replacement: ptr("")}},
+		labels:    model.LabelSet{"alertname": "a", "team": "x"},
+		expLabels: model.LabelSet{"alertname": "a"},
+	}, {
+		name: "join source labels and expand target",
+		configs: []RelabelConfig{
+			{SourceLabels: model.LabelNames{"cluster", "namespace"}, Separator: "/", TargetLabel: "scope"},
+			{SourceLabels: model.LabelNames{"env"}, TargetLabel: "${1}_owner", Replacement: ptr("team")},
+		},
+		labels:    model.LabelSet{"alertname": "a", "cluster": "eu", "namespace": "db", "env": "prod"},
+		expLabels: model.LabelSet{"alertname": "a", "cluster": "eu", "namespace": "db", "env": "prod", "scope": "eu/db", "prod_owner": "team"},
+	}, {
+		name:      "labelmap",
+		configs:   []RelabelConfig{{Action: RelabelLabelMap, Regex: "team_(.+)"}, {Action: RelabelLabelKeep, Regex: "alertname|owner|oncall"}},
+		labels:    model.LabelSet{"alertname": "a", "team_owner": "x", "team_oncall": "y", "other": "z"},
+		expLabels: model.LabelSet{"alertname": "a", "owner": "x", "oncall": "y"},
+	}, {
+		name:      "hashmod",
+		configs:   []RelabelConfig{{SourceLabels: model.LabelNames{"alertname"}, Action: RelabelHashMod, Modulus: 1, TargetLabel: "shard"}},
+		labels:    model.LabelSet{"alertname": "a"},
+		expLabels: model.LabelSet{"alertname": "a", "shard": "0"},
+	}, {
+		name: "drop",
+		configs: []RelabelConfig{
+			{SourceLabels: model.LabelNames{"severity"}, Action: RelabelLowercase, TargetLabel: "severity"},
+			{SourceLabels: model.LabelNames{"severity"}, Regex: "info", Action: RelabelDrop},
+		},
+		labels:       model.LabelSet{"alertname": "a", "severity": "Info"},
+		expDroppedBy: 1,
+	}, {
+		name:         "keep",
+		configs:      []RelabelConfig{{SourceLabels: model.LabelNames{"env"}, Regex: "prod", Action: RelabelKeep}},
+		labels:       model.LabelSet{"alertname": "a", "env": "dev"},
+		expDroppedBy: 0,
+	}, {
+		name:         "dropequal",
+		configs:      []RelabelConfig{{SourceLabels: model.LabelNames{"a"}, Action: RelabelDropEqual, TargetLabel: "b"}},
+		labels:       model.LabelSet{"alertname": "a", "a": "x", "b": "x"},
+		expDroppedBy: 0,
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rules, err := newRelabelRules(c.configs)
+			require.NoError(t, err)
+			labels, droppedBy := relabel(rules, c.labels, c.annotations)
+			if c.expLabels == nil {
+				require.Nil(t, labels)
+				require.Equal(t, c.expDroppedBy, droppedBy)
+				return
+			}
+			require.Equal(t, -1, droppedBy)
+			require.Equal(t, c.expLabels, labels)
+		})
+	}
+}
+
+func TestPutAlertsRelabeling(t *testing.T) {
+	am := setupAMTest(t)
+	n := &fakeNotifier{}
+	cfg := newFakeConfig(t, &Route{Receiver: "recv"}, map[string][]*Integration{
+		"recv": {NewIntegration(n, n, "webhook", 0)},
+	})
+
+	cfg.relabelConfigs = []RelabelConfig{{Action: "rename"}}
+	require.EqualError(t, am.ApplyConfig(cfg), `invalid relabel config 0: unknown action "rename"`)
+
+	cfg.relabelConfigs = []RelabelConfig{
+		{SourceLabels: model.LabelNames{"severity"}, Regex: "info", Action: RelabelDrop},
+		{Action: RelabelLabelDrop, Regex: "pod"},
+		// Alerts left without labels fail validation.
+		{Action: RelabelLabelDrop, Regex: "drop_me"},
+	}
+	require.NoError(t, am.ApplyConfig(cfg))
+
+	now := time.Now()
+	err := am.PutAlerts(amv2.PostableAlerts{
+		{Alert: amv2.Alert{Labels: amv2.LabelSet{"alertname": "a", "pod": "p-1"}}, StartsAt: strfmt.DateTime(now)},
+		{Alert: amv2.Alert{Labels: amv2.LabelSet{"alertname": "b", "severity": "info"}}, StartsAt: strfmt.DateTime(now)},
+		{Alert: amv2.Alert{Labels: amv2.LabelSet{"drop_me": "x"}}, StartsAt: strfmt.DateTime(now)},
+	})
+	var validationErr *AlertValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Len(t, validationErr.Errors, 1)
+	require.EqualError(t, validationErr.Errors[0], "at least one label pair required")
+	require.Equal(t, 1.0, testutil.ToFloat64(am.Metrics.RelabelDroppedAlerts))
+
+	alerts, err := am.GetAlerts(true, true, true, nil, "")
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	require.Equal(t, amv2.LabelSet{"alertname": "a"}, alerts[0].Labels)
+
+	// The dry run uses the current relabel configs by default.
+	res, err := am.TestRelabeling(nil, &amv2.PostableAlert{Alert: amv2.Alert{Labels: amv2.LabelSet{"alertname": "b", "severity": "info"}}})
+	require.NoError(t, err)
+	require.Equal(t, &TestRelabelingResult{Labels: model.LabelSet{"alertname": "b", "severity": "info"}, Dropped: true, DroppedBy: 0}, res)
+
+	res, err = am.TestRelabeling([]RelabelConfig{{SourceLabels: model.LabelNames{AnnotationLabelPrefix + "team"}, TargetLabel: "team"}}, &amv2.PostableAlert{
+		Alert:       amv2.Alert{Labels: amv2.LabelSet{"alertname": "b"}},
+		Annotations: amv2.LabelSet{"team": "db"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &TestRelabelingResult{Labels: model.LabelSet{"alertname": "b"}, RelabeledLabels: model.LabelSet{"alertname": "b", "team": "db"}}, res)
+
+	_, err = am.TestRelabeling([]RelabelConfig{{Action: RelabelHashMod, TargetLabel: "shard"}}, &amv2.PostableAlert{})
+	require.EqualError(t, err, "invalid relabel config 0: modulus is required for hashmod")
+}
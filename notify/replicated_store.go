@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/cluster"
+)
+
+// replicatedEntry is an entry of a replicatedStore.
+type replicatedEntry interface {
+	// storeKey is the key of the entry in the store.
+	storeKey() string
+	// lastUpdate is when the entry was last updated, the most recent entry of a key wins.
+	lastUpdate() time.Time
+}
+
+// replicatedStore stores entries by key and replicates them to the other peers of the cluster as JSON, the most
+// recently updated entry of a key winning. It implements the cluster.State interface.
+type replicatedStore[T replicatedEntry] struct {
+	mtx       sync.RWMutex
+	entries   map[string]T
+	broadcast func([]byte)
+}
+
+// newReplicatedStore creates a store with the entries of the snapshot file, if it exists. The name of the entries
+// describes the errors.
+func newReplicatedStore[T replicatedEntry](name, snapshotFile string) (*replicatedStore[T], error) {
+	s := &replicatedStore[T]{
+		entries:   make(map[string]T),
+		broadcast: func([]byte) {},
+	}
+	if snapshotFile == "" {
+		return s, nil
+	}
+
+	b, err := os.ReadFile(filepath.Clean(snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.merge(b); err != nil {
+		return nil, fmt.Errorf("failed to decode the %s snapshot: %w", name, err)
+	}
+	return s, nil
+}
+
+func (s *replicatedStore[T]) setBroadcast(f func([]byte)) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.broadcast = f
+}
+
+// MarshalBinary implements the cluster.State interface.
+func (s *replicatedStore[T]) MarshalBinary() ([]byte, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	res := make([]T, 0, len(s.entries))
+	for _, e := range s.entries {
+		res = append(res, e)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].storeKey() < res[j].storeKey()
+	})
+	return json.Marshal(res)
+}
+
+// Merge implements the cluster.State interface. The entries which are new to the peer are broadcast again, so that
+// they reach all the peers.
+func (s *replicatedStore[T]) Merge(b []byte) error {
+	merged, err := s.merge(b)
+	if err != nil {
+		return err
+	}
+	if merged && !cluster.OversizedMessage(b) {
+		s.mtx.RLock()
+		broadcast := s.broadcast
+		s.mtx.RUnlock()
+		broadcast(b)
+	}
+	return nil
+}
+
+func (s *replicatedStore[T]) merge(b []byte) (bool, error) {
+	var entries []T
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return false, err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	merged := false
+	for _, e := range entries {
+		if prev, ok := s.entries[e.storeKey()]; !ok || prev.lastUpdate().Before(e.lastUpdate()) {
+			s.entries[e.storeKey()] = e
+			merged = true
+		}
+	}
+	return merged, nil
+}
+
+// set stores the entry and broadcasts it.
+func (s *replicatedStore[T]) set(e T) {
+	b, _ := json.Marshal([]T{e})
+
+	s.mtx.Lock()
+	s.entries[e.storeKey()] = e
+	broadcast := s.broadcast
+	s.mtx.Unlock()
+
+	broadcast(b)
+}
+
+func (s *replicatedStore[T]) get(key string) (T, bool) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	e, ok := s.entries[key]
+	return e, ok
+}
+
+// deleteIf removes the entries for which expired returns true and returns how many were removed.
+func (s *replicatedStore[T]) deleteIf(expired func(T) bool) int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	n := 0
+	for k, e := range s.entries {
+		if expired(e) {
+			delete(s.entries, k)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicatedStoreSnapshot(t *testing.T) {
+	now := time.Now().UTC()
+	s, err := newReplicatedStore[*escalation]("escalations", "")
+	require.NoError(t, err)
+	s.set(&escalation{GroupKey: "b", Policy: "policy", UpdatedAt: now})
+	s.set(&escalation{GroupKey: "a", Policy: "policy", UpdatedAt: now})
+
+	b, err := s.MarshalBinary()
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "escalations")
+	require.NoError(t, os.WriteFile(file, b, 0600))
+	loaded, err := newReplicatedStore[*escalation]("escalations", file)
+	require.NoError(t, err)
+	require.Equal(t, s.entries, loaded.entries)
+
+	// A missing snapshot is an empty store, an invalid one is an error.
+	loaded, err = newReplicatedStore[*escalation]("escalations", filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	require.Empty(t, loaded.entries)
+	require.NoError(t, os.WriteFile(file, []byte("invalid"), 0600))
+	_, err = newReplicatedStore[*escalation]("escalations", file)
+	require.ErrorContains(t, err, "failed to decode the escalations snapshot")
+
+	require.Equal(t, 1, s.deleteIf(func(e *escalation) bool { return e.GroupKey == "a" }))
+	_, ok := s.get("a")
+	require.False(t, ok)
+}
@@ -0,0 +1,354 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	defaultRetryInitialBackoff = 500 * time.Millisecond
+	defaultRetryMaxBackoff     = time.Minute
+)
+
+var (
+	// ErrCircuitOpen is returned when a notification is not attempted because the circuit breaker of its
+	// integration is open.
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+)
+
+// RetryPolicy configures how the notifications of a receiver are retried. The notifications of a receiver with a
+// policy are reported by the metrics of the Alertmanager, such as alertmanager_receiver_notifications_total and
+// alertmanager_notification_retries_total, and not by the alertmanager_notifications_total family of upstream.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts per notification. Zero means the notification is retried
+	// until the group interval expires.
+	MaxAttempts int `yaml:"max_attempts,omitempty" json:"max_attempts,omitempty"`
+	// InitialBackoff is the delay before the first retry. Defaults to 500ms.
+	InitialBackoff model.Duration `yaml:"initial_backoff,omitempty" json:"initial_backoff,omitempty"`
+	// MaxBackoff caps the exponentially growing delay between retries. Defaults to 1m.
+	MaxBackoff model.Duration `yaml:"max_backoff,omitempty" json:"max_backoff,omitempty"`
+	// RetryableStatusCodes are the HTTP status codes that are retried. If empty, or if the error does not carry a
+	// status code, the integration decides whether the error is retryable.
+	RetryableStatusCodes []int `yaml:"retryable_status_codes,omitempty" json:"retryable_status_codes,omitempty"`
+	// CircuitBreaker stops sending notifications to an integration that keeps failing. It is disabled if nil.
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker,omitempty" json:"circuit_breaker,omitempty"`
+}
+
+// CircuitBreakerConfig configures the circuit breaker of the integrations of a receiver.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed notifications after which the circuit opens.
+	FailureThreshold int `yaml:"failure_threshold" json:"failure_threshold"`
+	// Cooldown is for how long the circuit stays open before a single notification is let through to probe the
+	// integration (half-open).
+	Cooldown model.Duration `yaml:"cooldown" json:"cooldown"`
+}
+
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 {
+		return errors.New("max_attempts must not be negative")
+	}
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		return errors.New("backoff must not be negative")
+	}
+	if p.MaxBackoff != 0 && p.MaxBackoff < p.InitialBackoff {
+		return errors.New("max_backoff must be greater than or equal to initial_backoff")
+	}
+	for _, code := range p.RetryableStatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid retryable status code %d", code)
+		}
+	}
+	if p.CircuitBreaker != nil {
+		if p.CircuitBreaker.FailureThreshold <= 0 {
+			return errors.New("circuit breaker failure_threshold must be greater than zero")
+		}
+		if p.CircuitBreaker.Cooldown <= 0 {
+			return errors.New("circuit breaker cooldown must be greater than zero")
+		}
+	}
+	return nil
+}
+
+func (p RetryPolicy) backoff() backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = defaultRetryInitialBackoff
+	if p.InitialBackoff > 0 {
+		b.InitialInterval = time.Duration(p.InitialBackoff)
+	}
+	b.MaxInterval = defaultRetryMaxBackoff
+	if p.MaxBackoff > 0 {
+		b.MaxInterval = time.Duration(p.MaxBackoff)
+	}
+	if b.MaxInterval < b.InitialInterval {
+		b.MaxInterval = b.InitialInterval
+	}
+	b.MaxElapsedTime = 0 // The context bounds the retries.
+	b.Reset()
+	return b
+}
+
+// retryable returns whether a failed notification should be retried.
+func (p RetryPolicy) retryable(retry bool, err error) bool {
+	if len(p.RetryableStatusCodes) == 0 {
+		return retry
+	}
+	var sc interface{ StatusCode() int }
+	if !errors.As(err, &sc) {
+		return retry
+	}
+	for _, code := range p.RetryableStatusCodes {
+		if code == sc.StatusCode() {
+			return true
+		}
+	}
+	return false
+}
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// CircuitBreakerStatus is a snapshot of the state of a circuit breaker.
+type CircuitBreakerStatus struct {
+	State               CircuitState
+	ConsecutiveFailures int
+	// OpenedAt is the last time the circuit opened. It is zero if it never did.
+	OpenedAt time.Time
+}
+
+type circuitBreaker struct {
+	cfg   CircuitBreakerConfig
+	gauge prometheus.Gauge
+
+	mtx                 sync.Mutex
+	state               CircuitState
+	consecutiveFailures int
+	openedAt            time.Time
+	probing             bool
+}
+
+func newCircuitBreaker(cfg CircuitBreakerConfig, gauge prometheus.Gauge) *circuitBreaker {
+	cb := &circuitBreaker{cfg: cfg, gauge: gauge}
+	cb.setState(CircuitClosed)
+	return cb
+}
+
+// allow returns whether a notification may be attempted. Once the cooldown has passed an open circuit becomes
+// half-open and lets a single notification through at a time.
+func (cb *circuitBreaker) allow(now time.Time) bool {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if now.Before(cb.openedAt.Add(time.Duration(cb.cfg.Cooldown))) {
+			return false
+		}
+		cb.setState(CircuitHalfOpen)
+		cb.probing = true
+		return true
+	case CircuitHalfOpen:
+		if cb.probing {
+			return false
+		}
+		cb.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (cb *circuitBreaker) success() {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	cb.consecutiveFailures = 0
+	cb.probing = false
+	cb.setState(CircuitClosed)
+}
+
+func (cb *circuitBreaker) failure(now time.Time) {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	cb.consecutiveFailures++
+	cb.probing = false
+	if cb.state == CircuitHalfOpen || cb.consecutiveFailures >= cb.cfg.FailureThreshold {
+		cb.openedAt = now
+		cb.setState(CircuitOpen)
+	}
+}
+
+// release gives up a half-open probe that ended without the integration being reached.
+func (cb *circuitBreaker) release() {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	cb.probing = false
+}
+
+func (cb *circuitBreaker) status() CircuitBreakerStatus {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	return CircuitBreakerStatus{
+		State:               cb.state,
+		ConsecutiveFailures: cb.consecutiveFailures,
+		OpenedAt:            cb.openedAt,
+	}
+}
+
+// setState must be called with the lock held.
+func (cb *circuitBreaker) setState(s CircuitState) {
+	cb.state = s
+	switch s {
+	case CircuitOpen:
+		cb.gauge.Set(2)
+	case CircuitHalfOpen:
+		cb.gauge.Set(1)
+	default:
+		cb.gauge.Set(0)
+	}
+}
+
+// circuitBreakerKey identifies the circuit breaker of an integration across configurations. The breaker, and its
+// state, is kept as long as the configuration of the receiver and of the breaker do not change.
+type circuitBreakerKey struct {
+	receiver    string
+	integration string
+	config      [32]byte
+}
+
+// retryStage notifies via the integration and retries according to the receiver's RetryPolicy.
+// It is used instead of notify.RetryStage for receivers that have a policy, and its notifications are only reported
+// by the metrics of GrafanaAlertmanagerMetrics.
+type retryStage struct {
+	integration *notify.Integration
+	groupName   string
+	policy      RetryPolicy
+	breaker     *circuitBreaker
+	metrics     *GrafanaAlertmanagerMetrics
+	now         func() time.Time
+}
+
+func newRetryStage(i *notify.Integration, groupName string, policy RetryPolicy, breaker *circuitBreaker, m *GrafanaAlertmanagerMetrics) *retryStage {
+	return &retryStage{
+		integration: i,
+		groupName:   groupName,
+		policy:      policy,
+		breaker:     breaker,
+		metrics:     m,
+		now:         time.Now,
+	}
+}
+
+// Exec implements the Stage interface.
+func (r *retryStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	var sent []*types.Alert
+
+	// If we shouldn't send notifications for resolved alerts, but there are only
+	// resolved alerts, report them all as successfully notified (we still want the
+	// notification log to log them for the next run of DedupStage).
+	if !r.integration.SendResolved() {
+		firing, ok := notify.FiringAlerts(ctx)
+		if !ok {
+			return ctx, nil, errors.New("firing alerts missing")
+		}
+		if len(firing) == 0 {
+			return ctx, alerts, nil
+		}
+		for _, a := range alerts {
+			if a.Status() != model.AlertResolved {
+				sent = append(sent, a)
+			}
+		}
+	} else {
+		sent = alerts
+	}
+
+	l = log.With(l, "receiver", r.groupName, "integration", r.integration.String())
+
+	if r.breaker != nil && !r.breaker.allow(r.now()) {
+		r.failed("circuit_open")
+		level.Debug(l).Log("msg", "Notification not sent, circuit breaker is open")
+		return ctx, nil, fmt.Errorf("%s/%s: %w", r.groupName, r.integration.String(), ErrCircuitOpen)
+	}
+
+	err := r.notify(ctx, l, sent)
+	if r.breaker != nil {
+		switch {
+		case err == nil:
+			r.breaker.success()
+		case ctx.Err() != nil:
+			// The group interval expired, this says nothing about the health of the integration.
+			r.breaker.release()
+		default:
+			r.breaker.failure(r.now())
+		}
+	}
+	if err != nil {
+		return ctx, nil, err
+	}
+	return ctx, alerts, nil
+}
+
+func (r *retryStage) notify(ctx context.Context, l log.Logger, alerts []*types.Alert) error {
+	b := r.policy.backoff()
+	var iErr error
+	for i := 1; ; i++ {
+		if i > 1 {
+			r.metrics.NotificationRetries.WithLabelValues(r.groupName, r.integration.String()).Inc()
+		}
+
+		start := r.now()
+		retry, err := r.integration.Notify(ctx, alerts...)
+		duration := r.now().Sub(start)
+		r.integration.Report(start, model.Duration(duration), err)
+		if err == nil {
+			lvl := level.Debug(l)
+			if i > 1 {
+				lvl = level.Info(l)
+			}
+			lvl.Log("msg", "Notify success", "attempts", i)
+			return nil
+		}
+		iErr = err
+
+		if !r.policy.retryable(retry, err) {
+			r.failed("not_retryable")
+			return fmt.Errorf("%s/%s: notify retry canceled due to unrecoverable error after %d attempts: %w", r.groupName, r.integration.String(), i, err)
+		}
+		if r.policy.MaxAttempts > 0 && i >= r.policy.MaxAttempts {
+			r.failed("max_attempts")
+			return fmt.Errorf("%s/%s: notify retry canceled after reaching the maximum of %d attempts: %w", r.groupName, r.integration.String(), i, err)
+		}
+		level.Warn(l).Log("msg", "Notify attempt failed, will retry later", "attempts", i, "err", err)
+
+		select {
+		case <-time.After(b.NextBackOff()):
+		case <-ctx.Done():
+			r.failed("canceled")
+			return fmt.Errorf("%s/%s: notify retry canceled after %d attempts: %w", r.groupName, r.integration.String(), i, iErr)
+		}
+	}
+}
+
+func (r *retryStage) failed(reason string) {
+	r.metrics.FailedNotifications.WithLabelValues(r.groupName, r.integration.String(), reason).Inc()
+}
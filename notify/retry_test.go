@@ -0,0 +1,304 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/alerting/logging"
+	"github.com/grafana/alerting/receivers"
+	receiversTesting "github.com/grafana/alerting/receivers/testing"
+	"github.com/grafana/alerting/templates"
+)
+
+func TestRetryPolicy_Validate(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy RetryPolicy
+		expErr string
+	}{
+		{
+			name:   "empty policy is valid",
+			policy: RetryPolicy{},
+		}, {
+			name: "complete policy is valid",
+			policy: RetryPolicy{
+				MaxAttempts:          5,
+				InitialBackoff:       model.Duration(time.Second),
+				MaxBackoff:           model.Duration(time.Minute),
+				RetryableStatusCodes: []int{429, 503},
+				CircuitBreaker:       &CircuitBreakerConfig{FailureThreshold: 3, Cooldown: model.Duration(time.Minute)},
+			},
+		}, {
+			name:   "negative max attempts",
+			policy: RetryPolicy{MaxAttempts: -1},
+			expErr: "max_attempts must not be negative",
+		}, {
+			name:   "max backoff lower than initial backoff",
+			policy: RetryPolicy{InitialBackoff: model.Duration(time.Minute), MaxBackoff: model.Duration(time.Second)},
+			expErr: "max_backoff must be greater than or equal to initial_backoff",
+		}, {
+			name:   "invalid status code",
+			policy: RetryPolicy{RetryableStatusCodes: []int{1000}},
+			expErr: "invalid retryable status code 1000",
+		}, {
+			name:   "circuit breaker without threshold",
+			policy: RetryPolicy{CircuitBreaker: &CircuitBreakerConfig{Cooldown: model.Duration(time.Minute)}},
+			expErr: "circuit breaker failure_threshold must be greater than zero",
+		}, {
+			name:   "circuit breaker without cooldown",
+			policy: RetryPolicy{CircuitBreaker: &CircuitBreakerConfig{FailureThreshold: 1}},
+			expErr: "circuit breaker cooldown must be greater than zero",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.policy.Validate()
+			if c.expErr != "" {
+				require.EqualError(t, err, c.expErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRetryPolicy_Retryable(t *testing.T) {
+	p := RetryPolicy{RetryableStatusCodes: []int{429, 503}}
+	require.True(t, p.retryable(false, fmt.Errorf("failed: %w", receivers.HTTPStatusError{Code: 503})))
+	require.False(t, p.retryable(true, receivers.HTTPStatusError{Code: 400}))
+	// Errors without a status code are left to the integration.
+	require.True(t, p.retryable(true, errors.New("connection refused")))
+	require.False(t, p.retryable(false, errors.New("invalid payload")))
+	// Without status codes, the integration decides.
+	require.False(t, RetryPolicy{}.retryable(false, receivers.HTTPStatusError{Code: 503}))
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test"})
+	cb := newCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, Cooldown: model.Duration(time.Minute)}, gauge)
+	now := time.Now()
+
+	require.True(t, cb.allow(now))
+	cb.failure(now)
+	require.Equal(t, CircuitClosed, cb.status().State)
+	require.True(t, cb.allow(now))
+	cb.failure(now)
+	require.Equal(t, CircuitBreakerStatus{State: CircuitOpen, ConsecutiveFailures: 2, OpenedAt: now}, cb.status())
+	require.Equal(t, 2.0, testutil.ToFloat64(gauge))
+
+	// The circuit stays open during the cooldown.
+	require.False(t, cb.allow(now.Add(30*time.Second)))
+
+	// Then, a single probe is let through.
+	require.True(t, cb.allow(now.Add(time.Minute)))
+	require.Equal(t, CircuitHalfOpen, cb.status().State)
+	require.Equal(t, 1.0, testutil.ToFloat64(gauge))
+	require.False(t, cb.allow(now.Add(time.Minute)))
+
+	// A failed probe opens the circuit again.
+	cb.failure(now.Add(time.Minute))
+	require.Equal(t, CircuitOpen, cb.status().State)
+	require.False(t, cb.allow(now.Add(90*time.Second)))
+
+	// A successful probe closes it.
+	require.True(t, cb.allow(now.Add(2*time.Minute)))
+	cb.success()
+	require.Equal(t, CircuitBreakerStatus{State: CircuitClosed, OpenedAt: now.Add(time.Minute)}, cb.status())
+	require.Equal(t, 0.0, testutil.ToFloat64(gauge))
+}
+
+func TestRetryStage(t *testing.T) {
+	alerts := []*types.Alert{{Alert: model.Alert{Labels: model.LabelSet{"alertname": "test"}}}}
+	backoff := model.Duration(time.Millisecond)
+
+	t.Run("gives up after the maximum number of attempts", func(t *testing.T) {
+		m := NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry())
+		n := &fakeNotifier{retry: true, err: errors.New("unavailable")}
+		i := NewIntegration(n, n, "webhook", 0)
+		s := newRetryStage(i, "recv", RetryPolicy{MaxAttempts: 3, InitialBackoff: backoff, MaxBackoff: backoff}, nil, m)
+
+		_, res, err := s.Exec(context.Background(), log.NewNopLogger(), alerts...)
+		require.EqualError(t, err, "recv/webhook[0]: notify retry canceled after reaching the maximum of 3 attempts: unavailable")
+		require.Nil(t, res)
+		require.Len(t, n.notifications(), 3)
+		require.Equal(t, 2.0, testutil.ToFloat64(m.NotificationRetries.WithLabelValues("recv", "webhook[0]")))
+		require.Equal(t, 1.0, testutil.ToFloat64(m.FailedNotifications.WithLabelValues("recv", "webhook[0]", "max_attempts")))
+
+		_, _, lastErr := i.GetReport()
+		require.EqualError(t, lastErr, "unavailable")
+	})
+
+	t.Run("does not retry status codes that are not retryable", func(t *testing.T) {
+		m := NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry())
+		n := &fakeNotifier{retry: true, err: receivers.HTTPStatusError{Code: 400}}
+		s := newRetryStage(NewIntegration(n, n, "webhook", 0), "recv", RetryPolicy{RetryableStatusCodes: []int{503}}, nil, m)
+
+		_, _, err := s.Exec(context.Background(), log.NewNopLogger(), alerts...)
+		require.ErrorIs(t, err, receivers.HTTPStatusError{Code: 400})
+		require.Len(t, n.notifications(), 1)
+		require.Equal(t, 1.0, testutil.ToFloat64(m.FailedNotifications.WithLabelValues("recv", "webhook[0]", "not_retryable")))
+	})
+
+	t.Run("retries the status codes of webhook-based notifiers", func(t *testing.T) {
+		for _, tc := range []struct {
+			code     int
+			attempts int
+			reason   string
+		}{
+			{code: 503, attempts: 2, reason: "max_attempts"},
+			{code: 400, attempts: 1, reason: "not_retryable"},
+		} {
+			m := NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry())
+			sender := &statusSender{code: tc.code}
+			factory, ok := Factory("webhook")
+			require.True(t, ok)
+			tmpl := templates.ForTests(t)
+			tmpl.ExternalURL = receiversTesting.ParseURLUnsafe("http://localhost")
+			fc, err := receivers.NewFactoryConfig(&receivers.NotificationChannelConfig{
+				Type:     "webhook",
+				Settings: json.RawMessage(`{"url": "http://localhost"}`),
+			}, sender, receiversTesting.DecryptForTesting, tmpl, nil, func(...interface{}) logging.Logger {
+				return &logging.FakeLogger{}
+			}, "")
+			require.NoError(t, err)
+			n, err := factory(fc)
+			require.NoError(t, err)
+			s := newRetryStage(NewIntegration(n, n, "webhook", 0), "recv",
+				RetryPolicy{MaxAttempts: 2, InitialBackoff: backoff, MaxBackoff: backoff, RetryableStatusCodes: []int{503}}, nil, m)
+
+			ctx := notify.WithGroupKey(context.Background(), "group")
+			ctx = notify.WithFiringAlerts(ctx, []uint64{1})
+			_, _, err = s.Exec(ctx, log.NewNopLogger(), alerts...)
+			require.ErrorIs(t, err, receivers.HTTPStatusError{Code: tc.code})
+			require.Len(t, sender.Webhooks(), tc.attempts)
+			require.Equal(t, 1.0, testutil.ToFloat64(m.FailedNotifications.WithLabelValues("recv", "webhook[0]", tc.reason)))
+		}
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		m := NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry())
+		n := &fakeNotifier{retry: true, err: errors.New("unavailable")}
+		s := newRetryStage(NewIntegration(n, n, "webhook", 0), "recv", RetryPolicy{InitialBackoff: model.Duration(time.Hour)}, nil, m)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, _, err := s.Exec(ctx, log.NewNopLogger(), alerts...)
+		require.EqualError(t, err, "recv/webhook[0]: notify retry canceled after 1 attempts: unavailable")
+		require.Equal(t, 1.0, testutil.ToFloat64(m.FailedNotifications.WithLabelValues("recv", "webhook[0]", "canceled")))
+	})
+
+	t.Run("circuit breaker skips notifications while open", func(t *testing.T) {
+		m := NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry())
+		n := &fakeNotifier{err: errors.New("invalid")}
+		cb := newCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, Cooldown: model.Duration(time.Minute)}, m.CircuitBreakerState.WithLabelValues("recv", "webhook[0]"))
+		s := newRetryStage(NewIntegration(n, n, "webhook", 0), "recv", RetryPolicy{CircuitBreaker: &cb.cfg}, cb, m)
+		now := time.Now()
+		s.now = func() time.Time { return now }
+
+		_, _, err := s.Exec(context.Background(), log.NewNopLogger(), alerts...)
+		require.EqualError(t, err, "recv/webhook[0]: notify retry canceled due to unrecoverable error after 1 attempts: invalid")
+		require.Equal(t, CircuitOpen, cb.status().State)
+
+		_, _, err = s.Exec(context.Background(), log.NewNopLogger(), alerts...)
+		require.ErrorIs(t, err, ErrCircuitOpen)
+		require.Len(t, n.notifications(), 1)
+		require.Equal(t, 1.0, testutil.ToFloat64(m.FailedNotifications.WithLabelValues("recv", "webhook[0]", "circuit_open")))
+
+		// Once the cooldown has passed and the integration recovered, the circuit closes.
+		now = now.Add(time.Minute)
+		n.err = nil
+		_, res, err := s.Exec(context.Background(), log.NewNopLogger(), alerts...)
+		require.NoError(t, err)
+		require.Equal(t, alerts, res)
+		require.Equal(t, CircuitClosed, cb.status().State)
+	})
+}
+
+func TestGetReceiversStatus(t *testing.T) {
+	am := setupAMTest(t)
+
+	n := &fakeNotifier{}
+	cfg := newFakeConfig(t, &Route{Receiver: "with-policy"}, map[string][]*Integration{
+		"with-policy":    {NewIntegration(n, n, "webhook", 0)},
+		"without-policy": {NewIntegration(n, n, "email", 0)},
+	})
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		CircuitBreaker: &CircuitBreakerConfig{FailureThreshold: 5, Cooldown: model.Duration(time.Minute)},
+	}
+	cfg.retryPolicies = map[string]RetryPolicy{"with-policy": policy}
+	require.NoError(t, am.ApplyConfig(cfg))
+
+	status := am.GetReceiversStatus()
+	require.Len(t, status, 2)
+	byName := map[string]ReceiverStatus{}
+	for _, s := range status {
+		byName[s.Name] = s
+	}
+
+	require.True(t, byName["with-policy"].Active)
+	require.Equal(t, &policy, byName["with-policy"].RetryPolicy)
+	require.Equal(t, &CircuitBreakerStatus{State: CircuitClosed}, byName["with-policy"].Integrations[0].CircuitBreaker)
+
+	require.False(t, byName["without-policy"].Active)
+	require.Nil(t, byName["without-policy"].RetryPolicy)
+	require.Nil(t, byName["without-policy"].Integrations[0].CircuitBreaker)
+
+	// The state of the circuit breakers of unchanged integrations is kept across configurations.
+	breakerState := func() CircuitState {
+		for _, s := range am.GetReceiversStatus() {
+			if s.Name == "with-policy" {
+				return s.Integrations[0].CircuitBreaker.State
+			}
+		}
+		return ""
+	}
+	for _, cb := range am.circuitBreakers {
+		for i := 0; i < 5; i++ {
+			cb.failure(time.Now())
+		}
+	}
+	cfg.integrations["with-policy"] = []*Integration{NewIntegration(n, n, "webhook", 0)}
+	require.NoError(t, am.ApplyConfig(cfg))
+	require.Equal(t, CircuitOpen, breakerState())
+
+	cfg.receivers = []*APIReceiver{{ConfigReceiver: ConfigReceiver{Name: "with-policy"}}}
+	require.NoError(t, am.ApplyConfig(cfg))
+	require.Equal(t, CircuitClosed, breakerState())
+	require.Len(t, am.circuitBreakers, 1)
+
+	cfg.retryPolicies = map[string]RetryPolicy{"with-policy": {MaxAttempts: -1}}
+	require.EqualError(t, am.ApplyConfig(cfg), `invalid retry policy for receiver "with-policy": max_attempts must not be negative`)
+}
+
+// statusSender answers the webhooks with a status code, and validates them as the sender of Grafana does.
+type statusSender struct {
+	receivers.CapturingSender
+	code int
+}
+
+func (s *statusSender) SendWebhook(ctx context.Context, cmd *receivers.SendWebhookSettings) error {
+	_ = s.CapturingSender.SendWebhook(ctx, cmd)
+	if cmd.Validation != nil {
+		if err := cmd.Validation(nil, s.code); err != nil {
+			return fmt.Errorf("webhook failed validation: %w", err)
+		}
+	}
+	if s.code/100 != 2 {
+		return fmt.Errorf("webhook response status %d", s.code)
+	}
+	return nil
+}
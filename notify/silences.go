@@ -1,6 +1,7 @@
 package notify
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -82,6 +83,15 @@ func (am *GrafanaAlertmanager) GetSilence(silenceID string) (GettableSilence, er
 
 // CreateSilence persists the provided silence and returns the silence ID if successful.
 func (am *GrafanaAlertmanager) CreateSilence(ps *PostableSilence) (string, error) {
+	return am.CreateSilenceWithContext(context.Background(), ps)
+}
+
+// CreateSilenceWithContext is like CreateSilence, and the silence is audited with the actor of the context.
+func (am *GrafanaAlertmanager) CreateSilenceWithContext(ctx context.Context, ps *PostableSilence) (silenceID string, err error) {
+	defer func() {
+		am.audit(ctx, AuditEvent{Action: AuditCreateSilence, SilenceID: silenceID, Silence: ps}, err)
+	}()
+
 	sil, err := v2.PostableSilenceToProto(ps)
 	if err != nil {
 		level.Error(am.logger).Log("msg", "marshaling to protobuf failed", "err", err)
@@ -101,7 +111,7 @@ func (am *GrafanaAlertmanager) CreateSilence(ps *PostableSilence) (string, error
 		return "", fmt.Errorf("%s: %w", msg, ErrCreateSilenceBadPayload)
 	}
 
-	silenceID, err := am.silences.Set(sil)
+	silenceID, err = am.silences.Set(sil)
 	if err != nil {
 		level.Error(am.logger).Log("msg", "unable to save silence", "err", err)
 		if errors.Is(err, silence.ErrNotFound) {
@@ -115,6 +125,15 @@ func (am *GrafanaAlertmanager) CreateSilence(ps *PostableSilence) (string, error
 
 // DeleteSilence looks for and expires the silence by the provided silenceID. It returns ErrSilenceNotFound if the silence is not present.
 func (am *GrafanaAlertmanager) DeleteSilence(silenceID string) error {
+	return am.DeleteSilenceWithContext(context.Background(), silenceID)
+}
+
+// DeleteSilenceWithContext is like DeleteSilence, and the deletion is audited with the actor of the context.
+func (am *GrafanaAlertmanager) DeleteSilenceWithContext(ctx context.Context, silenceID string) (err error) {
+	defer func() {
+		am.audit(ctx, AuditEvent{Action: AuditDeleteSilence, SilenceID: silenceID}, err)
+	}()
+
 	if err := am.silences.Expire(silenceID); err != nil {
 		if errors.Is(err, silence.ErrNotFound) {
 			return ErrSilenceNotFound
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// StageHook identifies the point of the notification pipeline at which a custom stage is executed.
+type StageHook string
+
+const (
+	// StageHookPreRoute executes once per flush of an aggregation group, before gossip settling, silencing,
+	// time muting and inhibition.
+	StageHookPreRoute StageHook = "pre_route"
+	// StageHookPreIntegration executes for every integration of a receiver once the notification has passed
+	// deduplication, right before it is sent.
+	StageHookPreIntegration StageHook = "pre_integration"
+	// StageHookPostNotify executes for every integration of a receiver once the notification has been sent and
+	// recorded in the notification log.
+	StageHookPostNotify StageHook = "post_notify"
+)
+
+type Stage = notify.Stage
+type StageFunc = notify.StageFunc
+
+// CustomStage is a host-provided Stage that is injected into the notification pipeline at the given hook.
+type CustomStage struct {
+	// Name identifies the stage in logs and metrics.
+	Name  string
+	Hook  StageHook
+	Stage Stage
+}
+
+func (s CustomStage) Validate() error {
+	if s.Name == "" {
+		return errors.New("custom stage name must be present")
+	}
+	if s.Stage == nil {
+		return fmt.Errorf("custom stage %q must have a stage implementation", s.Name)
+	}
+	switch s.Hook {
+	case StageHookPreRoute, StageHookPreIntegration, StageHookPostNotify:
+	default:
+		return fmt.Errorf("custom stage %q has an unknown hook %q", s.Name, s.Hook)
+	}
+	return nil
+}
+
+// customStages holds the custom stages of every hook in the order they were configured.
+type customStages map[StageHook]notify.MultiStage
+
+func newCustomStages(stages []CustomStage, m *GrafanaAlertmanagerMetrics) customStages {
+	res := make(customStages, len(stages))
+	for _, s := range stages {
+		res[s.Hook] = append(res[s.Hook], &instrumentedStage{
+			name:   s.Name,
+			hook:   s.Hook,
+			stage:  s.Stage,
+			errors: m.CustomStageErrors.WithLabelValues(string(s.Hook), s.Name),
+		})
+	}
+	return res
+}
+
+// instrumentedStage executes a custom stage and reports its failures. A failing custom stage does not stop the
+// notification: its error is logged and counted, and the pipeline continues with the alerts it was given.
+type instrumentedStage struct {
+	name   string
+	hook   StageHook
+	stage  notify.Stage
+	errors prometheus.Counter
+}
+
+// Exec implements the Stage interface.
+func (s *instrumentedStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	newCtx, res, err := s.stage.Exec(ctx, l, alerts...)
+	if err != nil {
+		s.errors.Inc()
+		level.Warn(l).Log("msg", "custom stage failed, continuing with the unmodified alerts", "stage", s.name, "hook", s.hook, "err", err)
+		return ctx, alerts, nil
+	}
+	return newCtx, res, nil
+}
@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustomStage_Validate(t *testing.T) {
+	noop := StageFunc(func(ctx context.Context, _ log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+		return ctx, alerts, nil
+	})
+
+	require.NoError(t, CustomStage{Name: "audit", Hook: StageHookPostNotify, Stage: noop}.Validate())
+	require.EqualError(t, CustomStage{Hook: StageHookPostNotify, Stage: noop}.Validate(), "custom stage name must be present")
+	require.EqualError(t, CustomStage{Name: "audit", Hook: StageHookPostNotify}.Validate(), `custom stage "audit" must have a stage implementation`)
+	require.EqualError(t, CustomStage{Name: "audit", Hook: "unknown", Stage: noop}.Validate(), `custom stage "audit" has an unknown hook "unknown"`)
+}
+
+func TestInstrumentedStage(t *testing.T) {
+	m := NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry())
+	stages := newCustomStages([]CustomStage{{
+		Name: "failing",
+		Hook: StageHookPreRoute,
+		Stage: StageFunc(func(ctx context.Context, _ log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+			return ctx, nil, errors.New("lookup failed")
+		}),
+	}}, m)
+
+	alerts := []*types.Alert{{Alert: model.Alert{Labels: model.LabelSet{"alertname": "test"}}}}
+	_, res, err := stages[StageHookPreRoute].Exec(context.Background(), log.NewNopLogger(), alerts...)
+	require.NoError(t, err)
+	require.Equal(t, alerts, res)
+	require.Equal(t, 1.0, testutil.ToFloat64(m.CustomStageErrors.WithLabelValues(string(StageHookPreRoute), "failing")))
+}
+
+func TestCustomStagesInPipeline(t *testing.T) {
+	var (
+		mtx   sync.Mutex
+		calls []StageHook
+	)
+	record := func(hook StageHook) Stage {
+		return StageFunc(func(ctx context.Context, _ log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			calls = append(calls, hook)
+			return ctx, alerts, nil
+		})
+	}
+
+	// The pre-route stage enriches every alert with an annotation.
+	enrich := StageFunc(func(ctx context.Context, _ log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+		res := make([]*types.Alert, 0, len(alerts))
+		for _, a := range alerts {
+			enriched := *a
+			enriched.Annotations = a.Annotations.Clone()
+			enriched.Annotations["runbook"] = "http://runbook"
+			res = append(res, &enriched)
+		}
+		return ctx, res, nil
+	})
+
+	m := NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry())
+	am, err := NewGrafanaAlertmanager("org", 1, &GrafanaAlertmanagerConfig{
+		Silences: newFakeMaintanenceOptions(t),
+		Nflog:    newFakeMaintanenceOptions(t),
+		Stages: []CustomStage{
+			{Name: "post", Hook: StageHookPostNotify, Stage: record(StageHookPostNotify)},
+			{Name: "pre-integration", Hook: StageHookPreIntegration, Stage: record(StageHookPreIntegration)},
+			{Name: "pre-route", Hook: StageHookPreRoute, Stage: record(StageHookPreRoute)},
+			{Name: "enrich", Hook: StageHookPreRoute, Stage: enrich},
+		},
+	}, &NilPeer{}, log.NewNopLogger(), m)
+	require.NoError(t, err)
+	t.Cleanup(am.StopAndWait)
+
+	n := &fakeNotifier{}
+	groupWait := model.Duration(time.Millisecond)
+	cfg := newFakeConfig(t, &Route{Receiver: "recv", GroupWait: &groupWait}, map[string][]*Integration{
+		"recv": {NewIntegration(n, n, "fake", 0)},
+	})
+	require.NoError(t, am.ApplyConfig(cfg))
+
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{{
+		Alert:    amv2.Alert{Labels: amv2.LabelSet{"alertname": "test"}},
+		StartsAt: strfmt.DateTime(time.Now()),
+	}}))
+
+	require.Eventually(t, func() bool {
+		return len(n.notifications()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	notified := n.notifications()[0]
+	require.Len(t, notified, 1)
+	require.Equal(t, model.LabelValue("http://runbook"), notified[0].Annotations["runbook"])
+
+	require.Eventually(t, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(calls) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []StageHook{StageHookPreRoute, StageHookPreIntegration, StageHookPostNotify}, calls)
+}
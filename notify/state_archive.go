@@ -0,0 +1,334 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/matttproud/golang_protobuf_extensions/pbutil"
+	"github.com/prometheus/alertmanager/nflog"
+	"github.com/prometheus/alertmanager/nflog/nflogpb"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/silence/silencepb"
+	"github.com/prometheus/alertmanager/store"
+	"github.com/prometheus/alertmanager/types"
+)
+
+// StateArchiveVersion is the version of the state archives written by ExportState.
+const StateArchiveVersion = 1
+
+var ErrUnsupportedStateArchiveVersion = errors.New("unsupported state archive version")
+
+// StateArchive is a snapshot of the state of an Alertmanager, to move a tenant between instances.
+//
+// Silences and NotificationLog have the format of the snapshot files of the silences and the notification log of
+// the Alertmanager, and of the state passed to MaintenanceFunc. The snapshot files of an upstream Alertmanager,
+// "silences" and "nflog" in its storage directory, can thus be imported as is.
+type StateArchive struct {
+	Version   int       `json:"version"`
+	TenantID  int64     `json:"tenantId"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	Silences        []byte `json:"silences,omitempty"`
+	NotificationLog []byte `json:"notificationLog,omitempty"`
+	// Alerts are the active alerts, if exported.
+	Alerts []*types.Alert `json:"alerts,omitempty"`
+}
+
+// WriteTo writes the archive as JSON.
+func (a *StateArchive) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// ReadStateArchive reads an archive written by WriteTo. It fails if the version of the archive is not supported.
+func ReadStateArchive(r io.Reader) (*StateArchive, error) {
+	var a StateArchive
+	if err := json.NewDecoder(r).Decode(&a); err != nil {
+		return nil, fmt.Errorf("failed to decode state archive: %w", err)
+	}
+	if a.Version < 1 || a.Version > StateArchiveVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedStateArchiveVersion, a.Version)
+	}
+	return &a, nil
+}
+
+// ExportStateOptions configures what ExportState bundles, besides the silences and the notification log.
+type ExportStateOptions struct {
+	IncludeAlerts bool
+}
+
+// ExportState returns a snapshot of the silences, the notification log and, optionally, the active alerts.
+func (am *GrafanaAlertmanager) ExportState(opts ExportStateOptions) (*StateArchive, error) {
+	a := &StateArchive{
+		Version:   StateArchiveVersion,
+		TenantID:  am.tenantID,
+		CreatedAt: time.Now(),
+	}
+
+	var err error
+	if a.Silences, err = am.silences.MarshalBinary(); err != nil {
+		return nil, fmt.Errorf("failed to export silences: %w", err)
+	}
+	if a.NotificationLog, err = am.notificationLog.MarshalBinary(); err != nil {
+		return nil, fmt.Errorf("failed to export notification log: %w", err)
+	}
+
+	if opts.IncludeAlerts {
+		alerts := am.alerts.GetPending()
+		defer alerts.Close()
+		for alert := range alerts.Next() {
+			if err := alerts.Err(); err != nil {
+				return nil, fmt.Errorf("failed to export alerts: %w", err)
+			}
+			if !alert.Resolved() {
+				a.Alerts = append(a.Alerts, alert)
+			}
+		}
+	}
+	return a, nil
+}
+
+// StateKind is a kind of state of a state archive.
+type StateKind string
+
+const (
+	StateKindSilence         StateKind = "silence"
+	StateKindNotificationLog StateKind = "notification_log"
+	StateKindAlert           StateKind = "alert"
+)
+
+// StateImportCounts counts what happened to the entries of a kind of state on import.
+type StateImportCounts struct {
+	// Added entries did not exist.
+	Added int `json:"added"`
+	// Updated entries existed and were replaced by the imported ones, which were more recent.
+	Updated int `json:"updated"`
+	// Kept entries existed, were more recent than the imported ones and were kept.
+	Kept int `json:"kept"`
+	// Unchanged entries existed and were identical.
+	Unchanged int `json:"unchanged"`
+	// Expired entries were not imported as they were already past their retention.
+	Expired int `json:"expired"`
+}
+
+// StateImportConflict is an entry that existed with a different content than the imported one. The most recently
+// updated of the two is kept, as when merging the state of the peers of a cluster.
+type StateImportConflict struct {
+	Kind StateKind `json:"kind"`
+	// ID is the ID of a silence, the receiver and group key of a notification log entry, or the fingerprint of an
+	// alert.
+	ID                string    `json:"id"`
+	ExistingUpdatedAt time.Time `json:"existingUpdatedAt"`
+	ImportedUpdatedAt time.Time `json:"importedUpdatedAt"`
+	// Imported is whether the imported entry replaced the existing one.
+	Imported bool `json:"imported"`
+}
+
+// StateImportReport describes the outcome of ImportState.
+type StateImportReport struct {
+	Silences        StateImportCounts     `json:"silences"`
+	NotificationLog StateImportCounts     `json:"notificationLog"`
+	Alerts          StateImportCounts     `json:"alerts"`
+	Conflicts       []StateImportConflict `json:"conflicts,omitempty"`
+}
+
+func (r *StateImportReport) record(kind StateKind, counts *StateImportCounts, id string, existing, imported time.Time, equal bool) {
+	if equal {
+		counts.Unchanged++
+		return
+	}
+	c := StateImportConflict{
+		Kind:              kind,
+		ID:                id,
+		ExistingUpdatedAt: existing,
+		ImportedUpdatedAt: imported,
+		Imported:          existing.Before(imported),
+	}
+	if c.Imported {
+		counts.Updated++
+	} else {
+		counts.Kept++
+	}
+	r.Conflicts = append(r.Conflicts, c)
+}
+
+// ImportState merges the state of the archive into the state of the Alertmanager: entries which do not exist are
+// added and, of those which exist on both sides, the most recently updated is kept. Nothing is imported if a part
+// of the archive cannot be decoded. The imported silences and notification log entries are replicated to the other
+// peers of the cluster.
+func (am *GrafanaAlertmanager) ImportState(ctx context.Context, a *StateArchive) (_ *StateImportReport, err error) {
+	defer func() {
+		am.audit(ctx, AuditEvent{Action: AuditImportState}, err)
+	}()
+
+	if a.Version < 1 || a.Version > StateArchiveVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedStateArchiveVersion, a.Version)
+	}
+	sils, err := decodeSilences(a.Silences)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode silences: %w", err)
+	}
+	entries, err := decodeNotificationLog(a.NotificationLog)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode notification log: %w", err)
+	}
+
+	report := &StateImportReport{}
+	now := time.Now()
+	if err := am.importSilences(report, sils, a.Silences, now); err != nil {
+		return nil, err
+	}
+	if err := am.importNotificationLog(report, entries, a.NotificationLog, now); err != nil {
+		return report, err
+	}
+	if err := am.importAlerts(report, a.Alerts); err != nil {
+		return report, err
+	}
+
+	level.Info(am.logger).Log("msg", "imported state", "silences_added", report.Silences.Added, "notification_log_added", report.NotificationLog.Added, "alerts_added", report.Alerts.Added, "conflicts", len(report.Conflicts))
+	return report, nil
+}
+
+func (am *GrafanaAlertmanager) importSilences(report *StateImportReport, sils []*silencepb.MeshSilence, b []byte, now time.Time) error {
+	for _, s := range sils {
+		if s.ExpiresAt.Before(now) {
+			report.Silences.Expired++
+			continue
+		}
+		existing, _, err := am.silences.Query(silence.QIDs(s.Silence.Id))
+		if err != nil {
+			return fmt.Errorf("failed to query silence %s: %w", s.Silence.Id, err)
+		}
+		if len(existing) == 0 {
+			report.Silences.Added++
+			continue
+		}
+		report.record(StateKindSilence, &report.Silences, s.Silence.Id, existing[0].UpdatedAt, s.Silence.UpdatedAt, protoEqual(existing[0], s.Silence))
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	if err := am.silences.Merge(b); err != nil {
+		return fmt.Errorf("failed to merge silences: %w", err)
+	}
+	return nil
+}
+
+func (am *GrafanaAlertmanager) importNotificationLog(report *StateImportReport, entries []*nflogpb.MeshEntry, b []byte, now time.Time) error {
+	for _, e := range entries {
+		if e.ExpiresAt.Before(now) {
+			report.NotificationLog.Expired++
+			continue
+		}
+		existing, err := am.notificationLog.Query(nflog.QReceiver(e.Entry.Receiver), nflog.QGroupKey(string(e.Entry.GroupKey)))
+		if errors.Is(err, nflog.ErrNotFound) {
+			report.NotificationLog.Added++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to query notification log: %w", err)
+		}
+		id := fmt.Sprintf("%s/%s/%d:%s", e.Entry.Receiver.GroupName, e.Entry.Receiver.Integration, e.Entry.Receiver.Idx, e.Entry.GroupKey)
+		report.record(StateKindNotificationLog, &report.NotificationLog, id, existing[0].Timestamp, e.Entry.Timestamp, protoEqual(existing[0], e.Entry))
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	if err := am.notificationLog.Merge(b); err != nil {
+		return fmt.Errorf("failed to merge notification log: %w", err)
+	}
+	return nil
+}
+
+// importAlerts puts the alerts which do not exist, or are more recent than the existing ones.
+func (am *GrafanaAlertmanager) importAlerts(report *StateImportReport, alerts []*types.Alert) error {
+	put := make([]*types.Alert, 0, len(alerts))
+	for _, a := range alerts {
+		fp := a.Fingerprint()
+		existing, err := am.alerts.Get(fp)
+		if errors.Is(err, store.ErrNotFound) {
+			report.Alerts.Added++
+			put = append(put, a)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get alert %s: %w", fp, err)
+		}
+		equal := existing.UpdatedAt.Equal(a.UpdatedAt) && existing.StartsAt.Equal(a.StartsAt) && existing.EndsAt.Equal(a.EndsAt) &&
+			existing.Labels.Equal(a.Labels) && existing.Annotations.Equal(a.Annotations)
+		report.record(StateKindAlert, &report.Alerts, fp.String(), existing.UpdatedAt, a.UpdatedAt, equal)
+		if !equal && existing.UpdatedAt.Before(a.UpdatedAt) {
+			put = append(put, a)
+		}
+	}
+	if len(put) == 0 {
+		return nil
+	}
+	if err := am.alerts.Put(put...); err != nil {
+		return fmt.Errorf("failed to put alerts: %w", err)
+	}
+	if am.history != nil {
+		am.history.received(put...)
+	}
+	return nil
+}
+
+func decodeSilences(b []byte) ([]*silencepb.MeshSilence, error) {
+	var res []*silencepb.MeshSilence
+	r := bytes.NewReader(b)
+	for {
+		var s silencepb.MeshSilence
+		if _, err := pbutil.ReadDelimited(r, &s); err != nil {
+			if errors.Is(err, io.EOF) {
+				return res, nil
+			}
+			return nil, err
+		}
+		if s.Silence == nil {
+			return nil, silence.ErrInvalidState
+		}
+		res = append(res, &s)
+	}
+}
+
+func decodeNotificationLog(b []byte) ([]*nflogpb.MeshEntry, error) {
+	var res []*nflogpb.MeshEntry
+	r := bytes.NewReader(b)
+	for {
+		var e nflogpb.MeshEntry
+		if _, err := pbutil.ReadDelimited(r, &e); err != nil {
+			if errors.Is(err, io.EOF) {
+				return res, nil
+			}
+			return nil, err
+		}
+		if e.Entry == nil || e.Entry.Receiver == nil {
+			return nil, nflog.ErrInvalidState
+		}
+		res = append(res, &e)
+	}
+}
+
+// protoEqual compares the encodings of the messages, which are deterministic for the messages of the silences and
+// the notification log.
+func protoEqual(a, b interface{ Marshal() ([]byte, error) }) bool {
+	ab, err := a.Marshal()
+	if err != nil {
+		return false
+	}
+	bb, err := b.Marshal()
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
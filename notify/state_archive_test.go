@@ -0,0 +1,148 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStateAlertmanager(t *testing.T) (*GrafanaAlertmanager, *fakeNotifier) {
+	t.Helper()
+	am, err := NewGrafanaAlertmanager("org", 1, &GrafanaAlertmanagerConfig{
+		Silences: newFakeMaintanenceOptions(t),
+		Nflog:    newFakeMaintanenceOptions(t),
+	}, &NilPeer{}, log.NewNopLogger(), NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry()))
+	require.NoError(t, err)
+
+	n := &fakeNotifier{}
+	groupWait := model.Duration(time.Millisecond)
+	require.NoError(t, am.ApplyConfig(newFakeConfig(t, &Route{Receiver: "recv", GroupWait: &groupWait}, map[string][]*Integration{
+		"recv": {NewIntegration(n, n, "webhook", 0)},
+	})))
+	return am, n
+}
+
+func TestExportImportState(t *testing.T) {
+	src, n := newTestStateAlertmanager(t)
+
+	startsAt, endsAt := strfmt.DateTime(time.Now()), strfmt.DateTime(time.Now().Add(time.Hour))
+	comment, createdBy := "maintenance", "admin"
+	matcherName, matcherValue, isRegex := "alertname", "silenced", false
+	silence := &PostableSilence{Silence: amv2.Silence{
+		Comment:   &comment,
+		CreatedBy: &createdBy,
+		StartsAt:  &startsAt,
+		EndsAt:    &endsAt,
+		Matchers:  amv2.Matchers{{Name: &matcherName, Value: &matcherValue, IsRegex: &isRegex}},
+	}}
+	silenceID, err := src.CreateSilence(silence)
+	require.NoError(t, err)
+
+	require.NoError(t, src.PutAlerts(amv2.PostableAlerts{{
+		Alert:    amv2.Alert{Labels: amv2.LabelSet{"alertname": "test"}},
+		StartsAt: strfmt.DateTime(time.Now()),
+	}}))
+	require.Eventually(t, func() bool {
+		return len(n.notifications()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	exported, err := src.ExportState(ExportStateOptions{IncludeAlerts: true})
+	require.NoError(t, err)
+	require.Equal(t, StateArchiveVersion, exported.Version)
+	require.Len(t, exported.Alerts, 1)
+
+	var buf bytes.Buffer
+	_, err = exported.WriteTo(&buf)
+	require.NoError(t, err)
+	archive, err := ReadStateArchive(&buf)
+	require.NoError(t, err)
+
+	dst, _ := newTestStateAlertmanager(t)
+	report, err := dst.ImportState(context.Background(), archive)
+	require.NoError(t, err)
+	require.Equal(t, &StateImportReport{
+		Silences:        StateImportCounts{Added: 1},
+		NotificationLog: StateImportCounts{Added: 1},
+		Alerts:          StateImportCounts{Added: 1},
+	}, report)
+	_, err = dst.GetSilence(silenceID)
+	require.NoError(t, err)
+	alerts, err := dst.GetAlerts(true, true, true, nil, "")
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+
+	// The silence is updated after the export, importing the archive again keeps the most recent one.
+	updated := "extended maintenance"
+	silence.ID = silenceID
+	silence.Comment = &updated
+	_, err = dst.CreateSilence(silence)
+	require.NoError(t, err)
+
+	report, err = dst.ImportState(context.Background(), archive)
+	require.NoError(t, err)
+	require.Equal(t, StateImportCounts{Kept: 1}, report.Silences)
+	require.Equal(t, StateImportCounts{Unchanged: 1}, report.NotificationLog)
+	require.Equal(t, StateImportCounts{Unchanged: 1}, report.Alerts)
+	require.Len(t, report.Conflicts, 1)
+	require.Equal(t, StateKindSilence, report.Conflicts[0].Kind)
+	require.Equal(t, silenceID, report.Conflicts[0].ID)
+	require.False(t, report.Conflicts[0].Imported)
+	s, err := dst.GetSilence(silenceID)
+	require.NoError(t, err)
+	require.Equal(t, updated, *s.Comment)
+
+	// And the source gets the update.
+	exported, err = dst.ExportState(ExportStateOptions{})
+	require.NoError(t, err)
+	require.Empty(t, exported.Alerts)
+	report, err = src.ImportState(context.Background(), exported)
+	require.NoError(t, err)
+	require.Equal(t, StateImportCounts{Updated: 1}, report.Silences)
+	require.True(t, report.Conflicts[0].Imported)
+	s, err = src.GetSilence(silenceID)
+	require.NoError(t, err)
+	require.Equal(t, updated, *s.Comment)
+}
+
+func TestImportStateInvalid(t *testing.T) {
+	am, _ := newTestStateAlertmanager(t)
+
+	cases := []struct {
+		name    string
+		archive *StateArchive
+		expErr  string
+	}{
+		{
+			name:    "unsupported version",
+			archive: &StateArchive{Version: StateArchiveVersion + 1},
+			expErr:  "unsupported state archive version: 2",
+		},
+		{
+			name:    "invalid silences",
+			archive: &StateArchive{Version: StateArchiveVersion, Silences: []byte("invalid")},
+			expErr:  "failed to decode silences",
+		},
+		{
+			name:    "invalid notification log",
+			archive: &StateArchive{Version: StateArchiveVersion, NotificationLog: []byte("invalid")},
+			expErr:  "failed to decode notification log",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := am.ImportState(context.Background(), c.archive)
+			require.ErrorContains(t, err, c.expErr)
+		})
+	}
+
+	_, err := ReadStateArchive(bytes.NewBufferString(`{"version":0}`))
+	require.ErrorIs(t, err, ErrUnsupportedStateArchiveVersion)
+}
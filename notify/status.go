@@ -1,5 +1,31 @@
 package notify
 
+import (
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// ReceiverStatus is the status of a receiver of the current configuration and of its integrations.
+type ReceiverStatus struct {
+	Name   string
+	Active bool
+	// RetryPolicy is the policy applied to the notifications of the receiver, if any.
+	RetryPolicy  *RetryPolicy
+	Integrations []IntegrationStatus
+}
+
+// IntegrationStatus is the status of an integration of a receiver.
+type IntegrationStatus struct {
+	Name                      string
+	Index                     int
+	LastNotifyAttempt         time.Time
+	LastNotifyAttemptDuration model.Duration
+	LastNotifyAttemptError    error
+	// CircuitBreaker is the state of the integration's circuit breaker, if the receiver's retry policy has one.
+	CircuitBreaker *CircuitBreakerStatus
+}
+
 // TODO(gotjosh): I don't think this is right, make sure you evaluate it.
 func (am *GrafanaAlertmanager) GetStatus() []byte {
 	am.reloadConfigMtx.RLock()
@@ -11,3 +37,41 @@ func (am *GrafanaAlertmanager) GetStatus() []byte {
 
 	return nil
 }
+
+// GetReceiversStatus returns the status of the receivers of the current configuration.
+// It is safe to call concurrently.
+func (am *GrafanaAlertmanager) GetReceiversStatus() []ReceiverStatus {
+	am.reloadConfigMtx.RLock()
+	defer am.reloadConfigMtx.RUnlock()
+
+	res := make([]ReceiverStatus, 0, len(am.receivers))
+	for _, r := range am.receivers {
+		rs := ReceiverStatus{
+			Name:         r.Name(),
+			Active:       r.Active(),
+			Integrations: make([]IntegrationStatus, 0, len(r.Integrations())),
+		}
+		if p, ok := am.retryPolicies[r.Name()]; ok {
+			rs.RetryPolicy = &p
+		}
+		for _, i := range r.Integrations() {
+			lastAttempt, lastDuration, lastErr := i.GetReport()
+			is := IntegrationStatus{
+				Name:                      i.Name(),
+				Index:                     i.Index(),
+				LastNotifyAttempt:         lastAttempt,
+				LastNotifyAttemptDuration: lastDuration,
+				LastNotifyAttemptError:    lastErr,
+			}
+			if key, ok := am.circuitBreakerKey(r.Name(), i); ok {
+				if cb, ok := am.circuitBreakers[key]; ok {
+					s := cb.status()
+					is.CircuitBreaker = &s
+				}
+			}
+			rs.Integrations = append(rs.Integrations, is)
+		}
+		res = append(res, rs)
+	}
+	return res
+}
@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/alerting/templates"
+)
+
+// TemplateValidationMode is how ApplyConfig handles templates of receivers that fail to render.
+type TemplateValidationMode string
+
+const (
+	// TemplateValidationDisabled does not validate the templates of receivers.
+	TemplateValidationDisabled TemplateValidationMode = ""
+	// TemplateValidationWarn logs the templates of receivers that fail to render.
+	TemplateValidationWarn TemplateValidationMode = "warn"
+	// TemplateValidationStrict rejects configurations with templates of receivers that fail to render.
+	TemplateValidationStrict TemplateValidationMode = "strict"
+)
+
+func (m TemplateValidationMode) Validate() error {
+	switch m {
+	case TemplateValidationDisabled, TemplateValidationWarn, TemplateValidationStrict:
+		return nil
+	default:
+		return fmt.Errorf("unknown template validation mode %q", m)
+	}
+}
+
+// ReceiverTemplateError is a templated setting of an integration that fails to render.
+type ReceiverTemplateError struct {
+	Receiver    string
+	Integration string
+	UID         string
+	Type        string
+	// Field is the path of the setting, for example "title" or "fields[0].value".
+	Field string
+	Err   error
+}
+
+func (e ReceiverTemplateError) Error() string {
+	return fmt.Sprintf("receiver %q, integration %q (%s), field %q: %s", e.Receiver, e.Integration, e.Type, e.Field, e.Err)
+}
+
+func (e ReceiverTemplateError) Unwrap() error {
+	return e.Err
+}
+
+// TemplateValidationError lists the templated settings of receivers that fail to render.
+type TemplateValidationError struct {
+	Errors []ReceiverTemplateError
+}
+
+func (e *TemplateValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("invalid templates in receivers: %s", strings.Join(msgs, "; "))
+}
+
+// ValidateReceiverTemplates renders every templated string setting of the integrations of the receivers for a sample
+// notification, with the templates of the configuration. It returns a *TemplateValidationError listing the settings
+// that fail to parse or execute.
+func ValidateReceiverTemplates(tmpl *Template, receivers []*APIReceiver) error {
+	now := time.Now()
+	testAlert := newTestAlert(TestReceiversConfigBodyParams{}, now, now)
+	alerts := []*types.Alert{&testAlert}
+
+	var errs []ReceiverTemplateError
+	for _, r := range receivers {
+		ctx := notify.WithReceiverName(context.Background(), r.Name)
+		ctx = notify.WithGroupKey(ctx, testAlert.Labels.String())
+		ctx = notify.WithGroupLabels(ctx, model.LabelSet{model.AlertNameLabel: testAlert.Labels[model.AlertNameLabel]})
+		data := templates.ExtendData(notify.GetTemplateData(ctx, tmpl, alerts, log.NewNopLogger()), &logAdapter{Logger: log.NewNopLogger()})
+
+		for _, integration := range r.Receivers {
+			walkTemplatedSettings("", integration.Settings, func(field, text string) {
+				if _, err := tmpl.ExecuteTextString(text, data); err != nil {
+					errs = append(errs, ReceiverTemplateError{
+						Receiver:    r.Name,
+						Integration: integration.Name,
+						UID:         integration.UID,
+						Type:        integration.Type,
+						Field:       field,
+						Err:         err,
+					})
+				}
+			})
+		}
+	}
+
+	if len(errs) > 0 {
+		return &TemplateValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// walkTemplatedSettings calls fn for every string of the settings that contains a template action, in order of path.
+func walkTemplatedSettings(path string, v interface{}, fn func(field, text string)) {
+	switch v := v.(type) {
+	case string:
+		if strings.Contains(v, "{{") {
+			fn(path, v)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			walkTemplatedSettings(p, v[k], fn)
+		}
+	case []interface{}:
+		for i, item := range v {
+			walkTemplatedSettings(fmt.Sprintf("%s[%d]", path, i), item, fn)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateReceiverTemplates(t *testing.T) {
+	cfg := newFakeConfig(t, &Route{Receiver: "recv"}, nil)
+	receivers := []*APIReceiver{{
+		ConfigReceiver: ConfigReceiver{Name: "recv"},
+		GrafanaReceivers: GrafanaReceivers{Receivers: []*GrafanaReceiver{{
+			UID:  "uid",
+			Name: "slack",
+			Type: "slack",
+			Settings: map[string]interface{}{
+				"title":     "{{ .Foo }}",
+				"text":      `{{ template "__subject" . }} {{ .CommonLabels.alertname }}`,
+				"recipient": "#alerts",
+				"fields":    []interface{}{map[string]interface{}{"value": "{{ .Status "}},
+			},
+		}, {
+			UID:      "uid2",
+			Name:     "webhook",
+			Type:     "webhook",
+			Settings: map[string]interface{}{"message": `{{ template "missing" . }}`},
+		}}},
+	}}
+
+	err := ValidateReceiverTemplates(cfg.Templates(), receivers)
+	var validationErr *TemplateValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.Len(t, validationErr.Errors, 3)
+
+	fields := make([]string, 0, len(validationErr.Errors))
+	for _, e := range validationErr.Errors {
+		require.Equal(t, "recv", e.Receiver)
+		fields = append(fields, e.Integration+"/"+e.Field)
+	}
+	require.Equal(t, []string{"slack/fields[0].value", "slack/title", "webhook/message"}, fields)
+	require.Contains(t, validationErr.Errors[1].Error(), `receiver "recv", integration "slack" (slack), field "title": `)
+	require.Contains(t, validationErr.Errors[1].Err.Error(), "can't evaluate field Foo")
+	require.Contains(t, validationErr.Errors[2].Err.Error(), `template "missing" not defined`)
+
+	require.NoError(t, ValidateReceiverTemplates(cfg.Templates(), receivers[:0]))
+}
+
+func TestApplyConfigTemplateValidation(t *testing.T) {
+	newAM := func(mode TemplateValidationMode) *GrafanaAlertmanager {
+		am, err := NewGrafanaAlertmanager("org", 1, &GrafanaAlertmanagerConfig{
+			Silences:           newFakeMaintanenceOptions(t),
+			Nflog:              newFakeMaintanenceOptions(t),
+			TemplateValidation: mode,
+		}, &NilPeer{}, log.NewNopLogger(), NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry()))
+		require.NoError(t, err)
+		return am
+	}
+
+	n := &fakeNotifier{}
+	cfg := newFakeConfig(t, &Route{Receiver: "recv"}, map[string][]*Integration{"recv": {NewIntegration(n, n, "slack", 0)}})
+	cfg.receivers = []*APIReceiver{{
+		ConfigReceiver: ConfigReceiver{Name: "recv"},
+		GrafanaReceivers: GrafanaReceivers{Receivers: []*GrafanaReceiver{{
+			Name:     "slack",
+			Type:     "slack",
+			Settings: map[string]interface{}{"title": "{{ .Foo }}"},
+		}}},
+	}}
+
+	var validationErr *TemplateValidationError
+	require.ErrorAs(t, newAM(TemplateValidationStrict).ApplyConfig(cfg), &validationErr)
+	require.NoError(t, newAM(TemplateValidationWarn).ApplyConfig(cfg))
+	require.NoError(t, newAM(TemplateValidationDisabled).ApplyConfig(cfg))
+
+	_, err := NewGrafanaAlertmanager("org", 1, &GrafanaAlertmanagerConfig{
+		Silences:           newFakeMaintanenceOptions(t),
+		Nflog:              newFakeMaintanenceOptions(t),
+		TemplateValidation: "lenient",
+	}, &NilPeer{}, log.NewNopLogger(), NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry()))
+	require.EqualError(t, err, `unknown template validation mode "lenient"`)
+}
@@ -0,0 +1,203 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/alertmanager/dispatch"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/alerting/logging"
+	"github.com/grafana/alerting/templates"
+)
+
+// TemplateErrorKind is the kind of error of a template test.
+type TemplateErrorKind string
+
+const (
+	InvalidTemplate TemplateErrorKind = "invalid_template"
+	ExecutionError  TemplateErrorKind = "execution_error"
+)
+
+// TestTemplatesResults are the results of TestTemplate.
+type TestTemplatesResults struct {
+	Results []TestTemplatesResult
+	Errors  []TestTemplatesErrorResult
+}
+
+// TestTemplatesResult is the output of a template.
+type TestTemplatesResult struct {
+	// Name is the name of the defined template, empty if the text defines none.
+	Name string
+	Text string
+}
+
+// TestTemplatesErrorResult is an error that occurred while parsing or executing a template.
+type TestTemplatesErrorResult struct {
+	// Name is the name of the defined template, empty for parse errors and if the text defines none.
+	Name string
+	Kind TemplateErrorKind
+	// Line and Column locate the error in the template text, starting at 1. They are zero when unknown.
+	Line    int
+	Column  int
+	Message string
+}
+
+// templateErrorRe matches the errors of text/template, for example:
+//
+//	template: :3: unexpected "}" in operand
+//	template: slack.title:2:14: executing "slack.title" at <.Foo>: can't evaluate field Foo
+var templateErrorRe = regexp.MustCompile(`^template: ([^:]*):(\d+):(?:(\d+):)? (.*)$`)
+
+func newTestTemplatesErrorResult(name string, kind TemplateErrorKind, err error) TestTemplatesErrorResult {
+	res := TestTemplatesErrorResult{Name: name, Kind: kind, Message: err.Error()}
+	m := templateErrorRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return res
+	}
+	res.Line, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		// text/template counts columns from 0.
+		col, _ := strconv.Atoi(m[3])
+		res.Column = col + 1
+	}
+	res.Message = m[4]
+	return res
+}
+
+// TestTemplate renders the templates defined in templateText, together with the templates of the current
+// configuration, for a notification of the alerts to the receiver. Templates defined in templateText override the
+// templates of the same name. If templateText defines no template, it is rendered as a whole.
+func (am *GrafanaAlertmanager) TestTemplate(ctx context.Context, templateText string, alerts []*types.Alert, receiverName string) (*TestTemplatesResults, error) {
+	tmpl, err := am.getTemplate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+
+	res := &TestTemplatesResults{Results: []TestTemplatesResult{}, Errors: []TestTemplatesErrorResult{}}
+	names, err := definedTemplates(templateText)
+	if err != nil {
+		res.Errors = append(res.Errors, newTestTemplatesErrorResult("", InvalidTemplate, err))
+		return res, nil
+	}
+
+	if len(alerts) == 0 {
+		now := time.Now()
+		testAlert := newTestAlert(TestReceiversConfigBodyParams{}, now, now)
+		alerts = []*types.Alert{&testAlert}
+	}
+	ctx = notify.WithReceiverName(ctx, receiverName)
+	ctx = notify.WithGroupLabels(ctx, am.groupLabels(alerts[0].Labels, receiverName))
+	l := &logAdapter{Logger: am.logger}
+	data := templates.ExtendData(notify.GetTemplateData(ctx, tmpl, alerts, am.logger), l)
+
+	if len(names) == 0 {
+		text, err := tmpl.ExecuteTextString(templateText, data)
+		if err != nil {
+			res.Errors = append(res.Errors, newTestTemplatesErrorResult("", ExecutionError, err))
+		} else {
+			res.Results = append(res.Results, TestTemplatesResult{Text: text})
+		}
+		return res, nil
+	}
+
+	// The text outside of the defined templates is rendered along with each of them, and removed from their output.
+	outside, err := tmpl.ExecuteTextString(templateText, data)
+	if err != nil {
+		res.Errors = append(res.Errors, newTestTemplatesErrorResult("", ExecutionError, err))
+		return res, nil
+	}
+	for _, name := range names {
+		text, err := tmpl.ExecuteTextString(fmt.Sprintf("%s{{ template %q . }}", templateText, name), data)
+		if err != nil {
+			res.Errors = append(res.Errors, newTestTemplatesErrorResult(name, ExecutionError, err))
+			continue
+		}
+		res.Results = append(res.Results, TestTemplatesResult{Name: name, Text: strings.TrimPrefix(text, outside)})
+	}
+	return res, nil
+}
+
+// definedTemplates returns the names of the templates defined in text, in order of definition.
+func definedTemplates(text string) ([]string, error) {
+	t := parse.New("")
+	// The functions are those of the templates of the configuration, which are checked when executing.
+	t.Mode = parse.SkipFuncCheck
+	trees := map[string]*parse.Tree{}
+	if _, err := t.Parse(text, "", "", trees); err != nil {
+		return nil, err
+	}
+
+	defined := make([]*parse.Tree, 0, len(trees))
+	for name, tree := range trees {
+		if name != "" {
+			defined = append(defined, tree)
+		}
+	}
+	sort.Slice(defined, func(i, j int) bool {
+		return defined[i].Root.Pos < defined[j].Root.Pos
+	})
+	names := make([]string, 0, len(defined))
+	for _, tree := range defined {
+		names = append(names, tree.Name)
+	}
+	return names, nil
+}
+
+// groupLabels returns the group labels of a notification of an alert with the given labels to the receiver, according
+// to the routing tree of the current configuration.
+func (am *GrafanaAlertmanager) groupLabels(labels model.LabelSet, receiverName string) model.LabelSet {
+	am.reloadConfigMtx.RLock()
+	defer am.reloadConfigMtx.RUnlock()
+
+	res := model.LabelSet{}
+	if am.route == nil {
+		return res
+	}
+	var route *dispatch.Route
+	for _, r := range am.route.Match(labels) {
+		if r.RouteOpts.Receiver == receiverName {
+			route = r
+			break
+		}
+	}
+	if route == nil {
+		return res
+	}
+	return routeGroupLabels(route, labels)
+}
+
+// logAdapter is a logging.Logger that logs to a go-kit Logger.
+type logAdapter struct {
+	log.Logger
+}
+
+func (l *logAdapter) New(ctx ...interface{}) logging.Logger {
+	return &logAdapter{Logger: log.With(l.Logger, ctx...)}
+}
+
+func (l *logAdapter) Debug(msg string, ctx ...interface{}) {
+	level.Debug(l.Logger).Log(append([]interface{}{"msg", msg}, ctx...)...)
+}
+
+func (l *logAdapter) Info(msg string, ctx ...interface{}) {
+	level.Info(l.Logger).Log(append([]interface{}{"msg", msg}, ctx...)...)
+}
+
+func (l *logAdapter) Warn(msg string, ctx ...interface{}) {
+	level.Warn(l.Logger).Log(append([]interface{}{"msg", msg}, ctx...)...)
+}
+
+func (l *logAdapter) Error(msg string, ctx ...interface{}) {
+	level.Error(l.Logger).Log(append([]interface{}{"msg", msg}, ctx...)...)
+}
@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestTemplate(t *testing.T) {
+	am := setupAMTest(t)
+	route := &Route{
+		Receiver: "default",
+		Routes:   []*Route{{Receiver: "team-a", GroupBy: []model.LabelName{"alertname"}}},
+	}
+	require.NoError(t, am.ApplyConfig(newFakeConfig(t, route, nil)))
+
+	alerts := []*types.Alert{
+		{Alert: model.Alert{Labels: model.LabelSet{"alertname": "HighCPU", "instance": "a"}, StartsAt: time.Now()}},
+		{Alert: model.Alert{Labels: model.LabelSet{"alertname": "HighCPU", "instance": "b"}, StartsAt: time.Now(), EndsAt: time.Now().Add(-time.Minute)}},
+	}
+
+	cases := []struct {
+		name string
+		text string
+		exp  TestTemplatesResults
+	}{
+		{
+			name: "renders each defined template",
+			text: `{{ define "title" }}{{ .Receiver }}: {{ len .Alerts.Firing }} firing{{ end }}
+{{ define "group" }}{{ .GroupLabels.alertname }} {{ template "__subject" . }}{{ end }}`,
+			exp: TestTemplatesResults{
+				Results: []TestTemplatesResult{
+					{Name: "title", Text: "team-a: 1 firing"},
+					{Name: "group", Text: "HighCPU [FIRING:1] HighCPU "},
+				},
+				Errors: []TestTemplatesErrorResult{},
+			},
+		}, {
+			name: "renders text without defined templates",
+			text: `{{ range .Alerts.Resolved }}{{ .Labels.instance }}{{ end }}`,
+			exp: TestTemplatesResults{
+				Results: []TestTemplatesResult{{Text: "b"}},
+				Errors:  []TestTemplatesErrorResult{},
+			},
+		}, {
+			name: "reports parse errors",
+			text: "{{ define \"title\" }}\n{{ .Receiver }\n{{ end }}",
+			exp: TestTemplatesResults{
+				Results: []TestTemplatesResult{},
+				Errors: []TestTemplatesErrorResult{{
+					Kind:    InvalidTemplate,
+					Line:    2,
+					Message: `unexpected "}" in operand`,
+				}},
+			},
+		}, {
+			name: "reports execution errors by template",
+			text: "{{ define \"ok\" }}ok{{ end }}\n{{ define \"broken\" }}\n  {{ .Receiver.Name }}{{ end }}",
+			exp: TestTemplatesResults{
+				Results: []TestTemplatesResult{{Name: "ok", Text: "ok"}},
+				Errors: []TestTemplatesErrorResult{{
+					Name:    "broken",
+					Kind:    ExecutionError,
+					Line:    3,
+					Column:  15,
+					Message: `executing "broken" at <.Receiver.Name>: can't evaluate field Name in type string`,
+				}},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := am.TestTemplate(context.Background(), c.text, alerts, "team-a")
+			require.NoError(t, err)
+			require.Equal(t, c.exp, *res)
+		})
+	}
+}
@@ -1,8 +1,16 @@
 package notify
 
 import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/stretchr/testify/require"
 )
 
 func newFakeMaintanenceOptions(t *testing.T) *fakeMaintenanceOptions {
@@ -12,6 +20,8 @@ func newFakeMaintanenceOptions(t *testing.T) *fakeMaintenanceOptions {
 }
 
 type fakeMaintenanceOptions struct {
+	// retention defaults to 30ms.
+	retention time.Duration
 }
 
 func (f *fakeMaintenanceOptions) Filepath() string {
@@ -19,6 +29,9 @@ func (f *fakeMaintenanceOptions) Filepath() string {
 }
 
 func (f *fakeMaintenanceOptions) Retention() time.Duration {
+	if f.retention > 0 {
+		return f.retention
+	}
 	return 30 * time.Millisecond
 }
 
@@ -29,3 +42,129 @@ func (f *fakeMaintenanceOptions) MaintenanceFrequency() time.Duration {
 func (f *fakeMaintenanceOptions) MaintenanceFunc(_ State) (int64, error) {
 	return 0, nil
 }
+
+// fakeConfig is a Configuration that holds its components as-is.
+type fakeConfig struct {
+	route              *Route
+	integrations       map[string][]*Integration
+	inhibitRules       []InhibitRule
+	muteTimeIntervals  []MuteTimeInterval
+	retryPolicies      map[string]RetryPolicy
+	rateLimits         map[string]RateLimit
+	escalationPolicies []EscalationPolicy
+	digests            map[string]Digest
+	ingestionLimits    IngestionLimits
+	relabelConfigs     []RelabelConfig
+	receivers          []*APIReceiver
+	templates          *Template
+}
+
+func newFakeConfig(t *testing.T, route *Route, integrations map[string][]*Integration) *fakeConfig {
+	t.Helper()
+
+	tmpl, err := template.FromGlobs(nil)
+	require.NoError(t, err)
+	tmpl.ExternalURL, err = url.Parse("http://localhost")
+	require.NoError(t, err)
+
+	return &fakeConfig{
+		route:        route,
+		integrations: integrations,
+		templates:    tmpl,
+	}
+}
+
+func (f *fakeConfig) DispatcherLimits() DispatcherLimits {
+	return &nilLimits{}
+}
+
+func (f *fakeConfig) IngestionLimits() IngestionLimits {
+	return f.ingestionLimits
+}
+
+func (f *fakeConfig) AlertRelabelConfigs() []RelabelConfig {
+	return f.relabelConfigs
+}
+
+func (f *fakeConfig) InhibitRules() []InhibitRule {
+	return f.inhibitRules
+}
+
+func (f *fakeConfig) MuteTimeIntervals() []MuteTimeInterval {
+	return f.muteTimeIntervals
+}
+
+func (f *fakeConfig) ReceiverIntegrations() (map[string][]*Integration, error) {
+	return f.integrations, nil
+}
+
+func (f *fakeConfig) BuildReceiverIntegrationsFunc() func(next *GrafanaReceiver, tmpl *Template) (Notifier, error) {
+	return func(next *GrafanaReceiver, tmpl *Template) (Notifier, error) {
+		return nil, fmt.Errorf("unsupported receiver type %q", next.Type)
+	}
+}
+
+func (f *fakeConfig) RetryPolicies() map[string]RetryPolicy {
+	return f.retryPolicies
+}
+
+func (f *fakeConfig) RateLimits() map[string]RateLimit {
+	return f.rateLimits
+}
+
+func (f *fakeConfig) Digests() map[string]Digest {
+	return f.digests
+}
+
+func (f *fakeConfig) EscalationPolicies() []EscalationPolicy {
+	return f.escalationPolicies
+}
+
+func (f *fakeConfig) Receivers() []*APIReceiver {
+	return f.receivers
+}
+
+func (f *fakeConfig) RoutingTree() *Route {
+	return f.route
+}
+
+func (f *fakeConfig) Templates() *Template {
+	return f.templates
+}
+
+func (f *fakeConfig) Hash() [16]byte {
+	return [16]byte{}
+}
+
+func (f *fakeConfig) Raw() []byte {
+	return []byte("{}")
+}
+
+type nilLimits struct{}
+
+func (n *nilLimits) MaxNumberOfAggregationGroups() int { return 0 }
+
+// fakeNotifier records the alerts of every notification it is asked to send.
+type fakeNotifier struct {
+	mtx    sync.Mutex
+	err    error
+	retry  bool
+	alerts [][]*types.Alert
+}
+
+func (n *fakeNotifier) Notify(_ context.Context, alerts ...*types.Alert) (bool, error) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.alerts = append(n.alerts, alerts)
+	return n.retry, n.err
+}
+
+func (n *fakeNotifier) SendResolved() bool {
+	return true
+}
+
+func (n *fakeNotifier) notifications() [][]*types.Alert {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return append([][]*types.Alert{}, n.alerts...)
+}
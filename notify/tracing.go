@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/grafana/alerting/tracing"
+)
+
+// flushStage starts the trace of a flush of an aggregation group, in which the stages of the pipeline are traced.
+type flushStage struct {
+	next   notify.Stage
+	tracer trace.Tracer
+}
+
+// Exec implements the Stage interface.
+func (s *flushStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	attrs := []attribute.KeyValue{attribute.Int("alerts", len(alerts))}
+	if key, ok := notify.GroupKey(ctx); ok {
+		attrs = append(attrs, attribute.String("group_key", key))
+	}
+	if receiver, ok := notify.ReceiverName(ctx); ok {
+		attrs = append(attrs, attribute.String("receiver", receiver))
+	}
+	ctx, span := s.tracer.Start(ctx, "dispatch.flush", trace.WithAttributes(attrs...))
+	ctx, res, err := s.next.Exec(ctx, l, alerts...)
+	tracing.End(span, err)
+	return ctx, res, err
+}
+
+// tracedStage traces its inner stage in a span that is a child of the span of the context.
+type tracedStage struct {
+	next  notify.Stage
+	name  string
+	attrs []attribute.KeyValue
+}
+
+func newTracedStage(name string, next notify.Stage, attrs ...attribute.KeyValue) notify.Stage {
+	return &tracedStage{next: next, name: name, attrs: attrs}
+}
+
+// Exec implements the Stage interface.
+func (s *tracedStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	attrs := append([]attribute.KeyValue{attribute.Int("alerts", len(alerts))}, s.attrs...)
+	spanCtx, span := tracing.Start(ctx, s.name, attrs...)
+	resCtx, res, err := s.next.Exec(spanCtx, l, alerts...)
+	span.SetAttributes(attribute.Int("alerts.remaining", len(res)))
+	tracing.End(span, err)
+	if resCtx == nil {
+		return nil, res, err
+	}
+	// The stages that follow are siblings of this one, but see the values it added to the context.
+	return trace.ContextWithSpan(resCtx, trace.SpanFromContext(ctx)), res, err
+}
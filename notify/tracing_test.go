@@ -0,0 +1,120 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracedStage(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	ctx, root := tracer.Start(context.Background(), "root")
+
+	type key struct{}
+	s := notify.MultiStage{
+		newTracedStage("first", notify.StageFunc(func(ctx context.Context, _ log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+			return context.WithValue(ctx, key{}, "value"), alerts, nil
+		})),
+		newTracedStage("second", notify.StageFunc(func(ctx context.Context, _ log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+			require.Equal(t, "value", ctx.Value(key{}))
+			return ctx, alerts, nil
+		})),
+	}
+	_, _, err := s.Exec(ctx, log.NewNopLogger(), &types.Alert{})
+	require.NoError(t, err)
+	root.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	// Both stages are children of the root span.
+	for _, span := range spans[:2] {
+		require.Equal(t, root.SpanContext().SpanID(), span.Parent().SpanID())
+	}
+}
+
+func TestPipelineTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	am, err := NewGrafanaAlertmanager("org", 1, &GrafanaAlertmanagerConfig{
+		Silences:       newFakeMaintanenceOptions(t),
+		Nflog:          newFakeMaintanenceOptions(t),
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+	}, &NilPeer{}, log.NewNopLogger(), NewGrafanaAlertmanagerMetrics(prometheus.NewPedanticRegistry()))
+	require.NoError(t, err)
+	t.Cleanup(am.StopAndWait)
+
+	n := &contextNotifier{}
+	groupWait := model.Duration(time.Millisecond)
+	cfg := newFakeConfig(t, &Route{Receiver: "recv", GroupWait: &groupWait}, map[string][]*Integration{
+		"recv": {NewIntegration(n, n, "webhook", 0)},
+	})
+	require.NoError(t, am.ApplyConfig(cfg))
+
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{{
+		Alert:    amv2.Alert{Labels: amv2.LabelSet{"alertname": "test"}},
+		StartsAt: strfmt.DateTime(time.Now()),
+	}}))
+	require.Eventually(t, func() bool {
+		return n.context() != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var flush sdktrace.ReadOnlySpan
+	require.Eventually(t, func() bool {
+		for _, s := range recorder.Ended() {
+			if s.Name() == "dispatch.flush" {
+				flush = s
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+
+	names := map[string]trace.SpanContext{}
+	for _, s := range recorder.Ended() {
+		names[s.Name()] = s.SpanContext()
+		if s.Name() != "alertmanager.PutAlerts" {
+			require.Equal(t, flush.SpanContext().TraceID(), s.SpanContext().TraceID(), s.Name())
+		}
+	}
+	for _, name := range []string{"alertmanager.PutAlerts", "notify.silence", "notify.time_intervals", "notify.inhibition", "notify.integration", "notify.dedup", "notify.retry", "integration.notify"} {
+		require.Contains(t, names, name)
+	}
+	// Integrations are notified within the span of their attempt, which senders can propagate.
+	require.Equal(t, names["integration.notify"], trace.SpanContextFromContext(n.context()))
+}
+
+// contextNotifier records the context of the last notification it is asked to send.
+type contextNotifier struct {
+	mtx sync.Mutex
+	ctx context.Context
+}
+
+func (n *contextNotifier) Notify(ctx context.Context, _ ...*types.Alert) (bool, error) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.ctx = ctx
+	return false, nil
+}
+
+func (n *contextNotifier) SendResolved() bool {
+	return true
+}
+
+func (n *contextNotifier) context() context.Context {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return n.ctx
+}
@@ -0,0 +1,474 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	v2 "github.com/prometheus/alertmanager/api/v2"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// WatchEventType is the type of a WatchEvent.
+type WatchEventType string
+
+const (
+	WatchAlertCreated    WatchEventType = "alert_created"
+	WatchAlertUpdated    WatchEventType = "alert_updated"
+	WatchAlertResolved   WatchEventType = "alert_resolved"
+	WatchAlertSilenced   WatchEventType = "alert_silenced"
+	WatchAlertUnsilenced WatchEventType = "alert_unsilenced"
+	// WatchGroupChanged follows every alert event, once for each group of the alert.
+	WatchGroupChanged WatchEventType = "group_changed"
+)
+
+var (
+	// watchBufferSize is the number of events buffered for a watcher.
+	watchBufferSize = 256
+	// watchSilencesInterval is the interval at which a watcher checks whether the silences changed.
+	watchSilencesInterval = time.Second
+)
+
+// WatchFilter filters the alerts of a watch.
+type WatchFilter struct {
+	// Matchers filter the alerts by labels, as the filter of GetAlerts.
+	Matchers []string
+	// Receivers is a regular expression the receiver of at least one of the routes of the alerts must match.
+	Receivers string
+}
+
+// WatchEvent is a change of an alert or of an alert group.
+type WatchEvent struct {
+	Type      WatchEventType `json:"type"`
+	Timestamp time.Time      `json:"timestamp"`
+	// Alert is the alert of the alert events, or the alert that changed the group of group events.
+	Alert *GettableAlert `json:"alert"`
+	// Group is the changed group of the group events.
+	Group *WatchGroup `json:"group,omitempty"`
+}
+
+// WatchGroup identifies an alert group.
+type WatchGroup struct {
+	GroupKey string        `json:"groupKey"`
+	Receiver string        `json:"receiver"`
+	Labels   amv2.LabelSet `json:"labels"`
+}
+
+// watchedAlert is the last state of an alert, as sent to a watcher.
+type watchedAlert struct {
+	alert *types.Alert
+	// silencedBy are the IDs of the active silences of the alert, sorted.
+	silencedBy []string
+}
+
+// Watch returns a channel of the changes of the alerts that match the filter, and of their groups. The alerts firing
+// when the watch starts are sent first, as created. The channel is closed when ctx is done or when the Alertmanager
+// stops. A watcher that falls behind receives the latest state of the alerts that changed in the meantime.
+func (am *GrafanaAlertmanager) Watch(ctx context.Context, filter WatchFilter) (<-chan WatchEvent, error) {
+	if !am.Ready() {
+		return nil, ErrGetAlertsUnavailable
+	}
+	matchers, err := parseFilter(filter.Matchers)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), ErrGetAlertsBadPayload)
+	}
+	receiverFilter, err := parseReceivers(filter.Receivers)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), ErrGetAlertsBadPayload)
+	}
+
+	events := make(chan WatchEvent, watchBufferSize)
+	silencesInterval := watchSilencesInterval
+	ctx, cancel := context.WithCancel(ctx)
+
+	// The subscription replays the alerts of the store, then follows the alerts put in it. It is always drained,
+	// as the store waits for its subscribers, into a queue that keeps the latest state of the alerts the watcher
+	// did not handle yet.
+	it := am.alerts.Subscribe()
+	q := newWatchQueue()
+	go func() {
+		defer it.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case a, open := <-it.Next():
+				if !open {
+					q.close()
+					return
+				}
+				q.push(a)
+			}
+		}
+	}()
+
+	go func() {
+		defer close(events)
+		defer cancel()
+
+		w := &watcher{
+			ctx:            ctx,
+			am:             am,
+			matchers:       matchers,
+			receiverFilter: receiverFilter,
+			events:         events,
+			alerts:         make(map[model.Fingerprint]*watchedAlert),
+		}
+		version := am.silences.Version()
+		w.nextSilenceChange = w.silencesChangeAfter(time.Now())
+
+		ticker := time.NewTicker(silencesInterval)
+		defer ticker.Stop()
+		var (
+			timer     *time.Timer
+			timerC    <-chan time.Time
+			scheduled time.Time
+		)
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		for {
+			ok := true
+			select {
+			case <-ctx.Done():
+				return
+			case <-am.stopc:
+				return
+			case <-q.ready:
+				alerts, open := q.pop()
+				for _, a := range alerts {
+					if ok = w.update(a, time.Now()); !ok {
+						break
+					}
+				}
+				if !open {
+					return
+				}
+			case <-ticker.C:
+				// Only the version of the silences is checked, the alerts are checked again if it changed.
+				if v := am.silences.Version(); v != version {
+					version = v
+					ok = w.silencesChanged(time.Now())
+				}
+			case now := <-timerC:
+				scheduled, timerC = time.Time{}, nil
+				ok = w.expire(now)
+				if ok && !w.nextSilenceChange.IsZero() && !w.nextSilenceChange.After(now) {
+					ok = w.silencesChanged(now)
+				}
+			}
+			if !ok {
+				return
+			}
+
+			// The watcher wakes up at the earliest end of its alerts or change of state of the silences.
+			if wake := w.wakeAt(); !wake.Equal(scheduled) {
+				if timer != nil {
+					timer.Stop()
+				}
+				scheduled, timer, timerC = wake, nil, nil
+				if !wake.IsZero() {
+					timer = time.NewTimer(time.Until(wake))
+					timerC = timer.C
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// watchQueue is the queue of the alerts put in the store, in order, with only the latest state of each alert.
+type watchQueue struct {
+	// ready is signaled when alerts are pushed or the queue is closed.
+	ready chan struct{}
+
+	mtx    sync.Mutex
+	order  []model.Fingerprint
+	alerts map[model.Fingerprint]*types.Alert
+	closed bool
+}
+
+func newWatchQueue() *watchQueue {
+	return &watchQueue{
+		ready:  make(chan struct{}, 1),
+		alerts: make(map[model.Fingerprint]*types.Alert),
+	}
+}
+
+func (q *watchQueue) push(a *types.Alert) {
+	q.mtx.Lock()
+	fp := a.Fingerprint()
+	if _, ok := q.alerts[fp]; !ok {
+		q.order = append(q.order, fp)
+	}
+	q.alerts[fp] = a
+	q.mtx.Unlock()
+	q.signal()
+}
+
+func (q *watchQueue) close() {
+	q.mtx.Lock()
+	q.closed = true
+	q.mtx.Unlock()
+	q.signal()
+}
+
+func (q *watchQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pop returns the alerts of the queue, and false if the queue is closed.
+func (q *watchQueue) pop() ([]*types.Alert, bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	res := make([]*types.Alert, 0, len(q.order))
+	for _, fp := range q.order {
+		res = append(res, q.alerts[fp])
+	}
+	q.order = q.order[:0]
+	q.alerts = make(map[model.Fingerprint]*types.Alert)
+	return res, !q.closed
+}
+
+type watcher struct {
+	ctx            context.Context
+	am             *GrafanaAlertmanager
+	matchers       []*labels.Matcher
+	receiverFilter *regexp.Regexp
+	events         chan<- WatchEvent
+	alerts         map[model.Fingerprint]*watchedAlert
+	// nextExpiry is the earliest end of the watched alerts, it can be earlier as their ends are extended.
+	nextExpiry time.Time
+	// nextSilenceChange is when the next silence starts or ends, zero if none does.
+	nextSilenceChange time.Time
+}
+
+// update handles an alert put in the store. It returns false if the watch ended.
+func (w *watcher) update(a *types.Alert, now time.Time) bool {
+	fp := a.Fingerprint()
+	prev, known := w.alerts[fp]
+	if !known {
+		if a.ResolvedAt(now) || !alertMatchesFilterLabels(&a.Alert, w.matchers) {
+			return true
+		}
+		wa := &watchedAlert{alert: a, silencedBy: w.silencedBy(a)}
+		w.alerts[fp] = wa
+		w.watchExpiry(a)
+		return w.send(WatchAlertCreated, wa, now)
+	}
+
+	if a.ResolvedAt(now) {
+		delete(w.alerts, fp)
+		prev.alert = a
+		return w.send(WatchAlertResolved, prev, now)
+	}
+	changed := !a.StartsAt.Equal(prev.alert.StartsAt) ||
+		!a.Annotations.Equal(prev.alert.Annotations) ||
+		a.GeneratorURL != prev.alert.GeneratorURL
+	prev.alert = a
+	w.watchExpiry(a)
+	if changed {
+		return w.send(WatchAlertUpdated, prev, now)
+	}
+	return true
+}
+
+func (w *watcher) watchExpiry(a *types.Alert) {
+	if w.nextExpiry.IsZero() || a.EndsAt.Before(w.nextExpiry) {
+		w.nextExpiry = a.EndsAt
+	}
+}
+
+// wakeAt returns when the watched alerts must be checked again, zero if never.
+func (w *watcher) wakeAt() time.Time {
+	if w.nextSilenceChange.IsZero() || (!w.nextExpiry.IsZero() && w.nextExpiry.Before(w.nextSilenceChange)) {
+		return w.nextExpiry
+	}
+	return w.nextSilenceChange
+}
+
+// expire sends the alerts that reached their end, which are not put in the alert store again.
+func (w *watcher) expire(now time.Time) bool {
+	if w.nextExpiry.IsZero() || w.nextExpiry.After(now) {
+		return true
+	}
+	w.nextExpiry = time.Time{}
+	for fp, wa := range w.alerts {
+		if !wa.alert.ResolvedAt(now) {
+			w.watchExpiry(wa.alert)
+			continue
+		}
+		delete(w.alerts, fp)
+		if !w.send(WatchAlertResolved, wa, now) {
+			return false
+		}
+	}
+	return true
+}
+
+// silencesChanged sends the alerts whose silences changed.
+func (w *watcher) silencesChanged(now time.Time) bool {
+	w.nextSilenceChange = w.silencesChangeAfter(now)
+	for _, wa := range w.alerts {
+		silencedBy := w.silencedBy(wa.alert)
+		if (len(silencedBy) > 0) == (len(wa.silencedBy) > 0) {
+			wa.silencedBy = silencedBy
+			continue
+		}
+		wa.silencedBy = silencedBy
+		t := WatchAlertUnsilenced
+		if len(silencedBy) > 0 {
+			t = WatchAlertSilenced
+		}
+		if !w.send(t, wa, now) {
+			return false
+		}
+	}
+	return true
+}
+
+// silencedBy returns the IDs of the active silences of the alert.
+func (w *watcher) silencedBy(a *types.Alert) []string {
+	sils, _, err := w.am.silences.Query(silence.QState(types.SilenceStateActive), silence.QMatches(a.Labels))
+	if err != nil {
+		level.Warn(w.am.logger).Log("msg", "Failed to query the silences of a watched alert", "err", err)
+		return nil
+	}
+	ids := make([]string, 0, len(sils))
+	for _, s := range sils {
+		ids = append(ids, s.Id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// silencesChangeAfter returns when the next silence starts or ends after now, zero if none does.
+func (w *watcher) silencesChangeAfter(now time.Time) time.Time {
+	sils, _, err := w.am.silences.Query()
+	if err != nil {
+		level.Warn(w.am.logger).Log("msg", "Failed to query the silences", "err", err)
+		return time.Time{}
+	}
+	var next time.Time
+	for _, s := range sils {
+		for _, t := range []time.Time{s.StartsAt, s.EndsAt} {
+			if t.After(now) && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+	}
+	return next
+}
+
+// send sends the event of the alert, followed by the events of its groups, if the alert is routed to a receiver
+// that matches the filter. It returns false if the watch ended.
+func (w *watcher) send(t WatchEventType, wa *watchedAlert, now time.Time) bool {
+	w.am.reloadConfigMtx.RLock()
+	route := w.am.route
+	w.am.reloadConfigMtx.RUnlock()
+
+	a := wa.alert
+	routes := route.Match(a.Labels)
+	receivers := make([]string, 0, len(routes))
+	for _, r := range routes {
+		receivers = append(receivers, r.RouteOpts.Receiver)
+	}
+	if w.receiverFilter != nil && !receiversMatchFilter(receivers, w.receiverFilter) {
+		return true
+	}
+
+	// The silences of the status are those the watcher saw, the marker only follows them as the alert is notified.
+	status := w.am.marker.Status(a.Fingerprint())
+	status.SilencedBy = wa.silencedBy
+	switch {
+	case len(status.SilencedBy) > 0 || len(status.InhibitedBy) > 0:
+		status.State = types.AlertStateSuppressed
+	case status.State == types.AlertStateSuppressed:
+		status.State = types.AlertStateActive
+	}
+	alert := v2.AlertToOpenAPIAlert(a, status, receivers)
+	events := make([]WatchEvent, 0, len(routes)+1)
+	events = append(events, WatchEvent{Type: t, Timestamp: now, Alert: alert})
+	for _, r := range routes {
+		groupLabels := routeGroupLabels(r, a.Labels)
+		events = append(events, WatchEvent{
+			Type:      WatchGroupChanged,
+			Timestamp: now,
+			Alert:     alert,
+			Group: &WatchGroup{
+				GroupKey: routeGroupKey(r, groupLabels),
+				Receiver: r.RouteOpts.Receiver,
+				Labels:   v2.ModelLabelSetToAPILabelSet(groupLabels),
+			},
+		})
+	}
+	for _, e := range events {
+		select {
+		case w.events <- e:
+		case <-w.ctx.Done():
+			return false
+		case <-w.am.stopc:
+			return false
+		}
+	}
+	return true
+}
+
+// WatchHandler returns an HTTP handler that streams the events of a watch as Server-Sent Events. The watch is
+// filtered by the filter and receiver query parameters, as GetAlerts.
+func (am *GrafanaAlertmanager) WatchHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		q := r.URL.Query()
+		events, err := am.Watch(r.Context(), WatchFilter{Matchers: q["filter"], Receivers: q.Get("receiver")})
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrGetAlertsBadPayload) {
+				status = http.StatusBadRequest
+			} else if errors.Is(err, ErrGetAlertsUnavailable) {
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for e := range events {
+			b, err := json.Marshal(e)
+			if err != nil {
+				level.Error(am.logger).Log("msg", "Failed to marshal watch event", "err", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	})
+}
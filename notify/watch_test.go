@@ -0,0 +1,270 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	amv2 "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func setupWatchTest(t *testing.T) *GrafanaAlertmanager {
+	t.Helper()
+	interval := watchSilencesInterval
+	watchSilencesInterval = 10 * time.Millisecond
+	t.Cleanup(func() { watchSilencesInterval = interval })
+
+	matcher, err := labels.NewMatcher(labels.MatchEqual, "team", "db")
+	require.NoError(t, err)
+
+	am := setupAMTest(t)
+	n := &fakeNotifier{}
+	cfg := newFakeConfig(t, &Route{
+		Receiver: "recv",
+		GroupBy:  []model.LabelName{"alertname"},
+		Routes:   []*Route{{Receiver: "team", Matchers: config.Matchers{matcher}}},
+	}, map[string][]*Integration{
+		"recv": {NewIntegration(n, n, "webhook", 0)},
+		"team": {NewIntegration(n, n, "webhook", 0)},
+	})
+	require.NoError(t, am.ApplyConfig(cfg))
+	return am
+}
+
+func nextWatchEvent(t *testing.T, events <-chan WatchEvent) WatchEvent {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		require.True(t, ok, "the watch ended")
+		return e
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no watch event")
+	}
+	return WatchEvent{}
+}
+
+func TestWatch(t *testing.T) {
+	am := setupWatchTest(t)
+	now := time.Now()
+	alert := func(ls amv2.LabelSet, annotations amv2.LabelSet) *amv2.PostableAlert {
+		return &amv2.PostableAlert{Alert: amv2.Alert{Labels: ls}, Annotations: annotations, StartsAt: strfmt.DateTime(now)}
+	}
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{alert(amv2.LabelSet{"alertname": "existing"}, nil)}))
+
+	_, err := am.Watch(context.Background(), WatchFilter{Matchers: []string{"alertname=~("}})
+	require.ErrorIs(t, err, ErrGetAlertsBadPayload)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := am.Watch(ctx, WatchFilter{Matchers: []string{`alertname!="ignored"`}})
+	require.NoError(t, err)
+
+	// The firing alerts are sent first.
+	e := nextWatchEvent(t, events)
+	require.Equal(t, WatchAlertCreated, e.Type)
+	require.Equal(t, amv2.LabelSet{"alertname": "existing"}, e.Alert.Labels)
+	e = nextWatchEvent(t, events)
+	require.Equal(t, WatchGroupChanged, e.Type)
+	require.Equal(t, &WatchGroup{GroupKey: `{}:{alertname="existing"}`, Receiver: "recv", Labels: amv2.LabelSet{"alertname": "existing"}}, e.Group)
+	// The key of the group is the one of the alert groups, which AcknowledgeGroup accepts.
+	require.Eventually(t, func() bool {
+		groups, err := am.GetAlertGroupsWithState(true, true, true, nil, "")
+		return err == nil && len(groups) == 1 && groups[0].GroupKey == e.Group.GroupKey
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{
+		alert(amv2.LabelSet{"alertname": "ignored"}, nil),
+		alert(amv2.LabelSet{"alertname": "a", "team": "db"}, nil),
+	}))
+	e = nextWatchEvent(t, events)
+	require.Equal(t, WatchAlertCreated, e.Type)
+	require.Equal(t, amv2.LabelSet{"alertname": "a", "team": "db"}, e.Alert.Labels)
+	require.Equal(t, []string{"team"}, receiverNames(e.Alert))
+	e = nextWatchEvent(t, events)
+	require.Equal(t, WatchGroupChanged, e.Type)
+	require.Equal(t, "team", e.Group.Receiver)
+
+	// Alerts put again without changes do not cause events.
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{alert(amv2.LabelSet{"alertname": "existing"}, nil)}))
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{alert(amv2.LabelSet{"alertname": "existing"}, amv2.LabelSet{"summary": "changed"})}))
+	e = nextWatchEvent(t, events)
+	require.Equal(t, WatchAlertUpdated, e.Type)
+	require.Equal(t, amv2.LabelSet{"summary": "changed"}, e.Alert.Annotations)
+	require.Equal(t, WatchGroupChanged, nextWatchEvent(t, events).Type)
+
+	startsAt, endsAt := strfmt.DateTime(now), strfmt.DateTime(now.Add(time.Hour))
+	comment, createdBy, name, value, isRegex := "", "test", "alertname", "existing", false
+	silenceID, err := am.CreateSilence(&PostableSilence{Silence: amv2.Silence{
+		Comment:   &comment,
+		CreatedBy: &createdBy,
+		StartsAt:  &startsAt,
+		EndsAt:    &endsAt,
+		Matchers:  amv2.Matchers{{Name: &name, Value: &value, IsRegex: &isRegex}},
+	}})
+	require.NoError(t, err)
+	e = nextWatchEvent(t, events)
+	require.Equal(t, WatchAlertSilenced, e.Type)
+	require.Equal(t, []string{silenceID}, e.Alert.Status.SilencedBy)
+	require.Equal(t, WatchGroupChanged, nextWatchEvent(t, events).Type)
+
+	require.NoError(t, am.DeleteSilence(silenceID))
+	e = nextWatchEvent(t, events)
+	require.Equal(t, WatchAlertUnsilenced, e.Type)
+	require.Equal(t, WatchGroupChanged, nextWatchEvent(t, events).Type)
+
+	resolved := alert(amv2.LabelSet{"alertname": "existing"}, amv2.LabelSet{"summary": "changed"})
+	resolved.EndsAt = strfmt.DateTime(now)
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{resolved}))
+	e = nextWatchEvent(t, events)
+	require.Equal(t, WatchAlertResolved, e.Type)
+	require.Equal(t, amv2.LabelSet{"alertname": "existing"}, e.Alert.Labels)
+	require.Equal(t, WatchGroupChanged, nextWatchEvent(t, events).Type)
+
+	cancel()
+	require.Eventually(t, func() bool {
+		_, ok := <-events
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestWatchSlowWatcher(t *testing.T) {
+	am := setupWatchTest(t)
+	size := watchBufferSize
+	watchBufferSize = 1
+	t.Cleanup(func() { watchBufferSize = size })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := am.Watch(ctx, WatchFilter{})
+	require.NoError(t, err)
+
+	// The alerts are put while the watcher does not read its events, more than the subscription buffers.
+	const n = 300
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < n; i++ {
+			if err := am.PutAlerts(amv2.PostableAlerts{{
+				Alert:    amv2.Alert{Labels: amv2.LabelSet{"alertname": fmt.Sprintf("alert-%d", i)}},
+				StartsAt: strfmt.DateTime(time.Now()),
+			}}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "the watcher blocks the alert store")
+	}
+
+	created := map[string]struct{}{}
+	for len(created) < n {
+		if e := nextWatchEvent(t, events); e.Type == WatchAlertCreated {
+			created[e.Alert.Labels["alertname"]] = struct{}{}
+		}
+	}
+}
+
+func TestWatchExpiryAndSilenceStart(t *testing.T) {
+	am := setupWatchTest(t)
+	now := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := am.Watch(ctx, WatchFilter{})
+	require.NoError(t, err)
+
+	// The alert resolves at its end, without being put again.
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{{
+		Alert:    amv2.Alert{Labels: amv2.LabelSet{"alertname": "expiring"}},
+		StartsAt: strfmt.DateTime(now),
+		EndsAt:   strfmt.DateTime(now.Add(200 * time.Millisecond)),
+	}}))
+	require.Equal(t, WatchAlertCreated, nextWatchEvent(t, events).Type)
+	require.Equal(t, WatchGroupChanged, nextWatchEvent(t, events).Type)
+	e := nextWatchEvent(t, events)
+	require.Equal(t, WatchAlertResolved, e.Type)
+	require.Equal(t, amv2.LabelSet{"alertname": "expiring"}, e.Alert.Labels)
+	require.Equal(t, WatchGroupChanged, nextWatchEvent(t, events).Type)
+
+	// The alert is silenced when its silence starts.
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{{
+		Alert:    amv2.Alert{Labels: amv2.LabelSet{"alertname": "silenced"}},
+		StartsAt: strfmt.DateTime(now),
+	}}))
+	require.Equal(t, WatchAlertCreated, nextWatchEvent(t, events).Type)
+	require.Equal(t, WatchGroupChanged, nextWatchEvent(t, events).Type)
+
+	startsAt, endsAt := strfmt.DateTime(time.Now().Add(200*time.Millisecond)), strfmt.DateTime(now.Add(time.Hour))
+	comment, createdBy, name, value, isRegex := "", "test", "alertname", "silenced", false
+	silenceID, err := am.CreateSilence(&PostableSilence{Silence: amv2.Silence{
+		Comment:   &comment,
+		CreatedBy: &createdBy,
+		StartsAt:  &startsAt,
+		EndsAt:    &endsAt,
+		Matchers:  amv2.Matchers{{Name: &name, Value: &value, IsRegex: &isRegex}},
+	}})
+	require.NoError(t, err)
+	e = nextWatchEvent(t, events)
+	require.Equal(t, WatchAlertSilenced, e.Type)
+	require.False(t, time.Now().Before(time.Time(startsAt)))
+	require.Equal(t, []string{silenceID}, e.Alert.Status.SilencedBy)
+}
+
+func TestWatchHandler(t *testing.T) {
+	am := setupWatchTest(t)
+	srv := httptest.NewServer(am.WatchHandler())
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL + "?filter=" + url.QueryEscape("alertname=~("))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?receiver=team", nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, resp.Body.Close()) }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	require.NoError(t, am.PutAlerts(amv2.PostableAlerts{
+		{Alert: amv2.Alert{Labels: amv2.LabelSet{"alertname": "a"}}, StartsAt: strfmt.DateTime(time.Now())},
+		{Alert: amv2.Alert{Labels: amv2.LabelSet{"alertname": "b", "team": "db"}}, StartsAt: strfmt.DateTime(time.Now())},
+	}))
+
+	r := bufio.NewReader(resp.Body)
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "event: alert_created\n", line)
+	line, err = r.ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(line, "data: "), line)
+	var e WatchEvent
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e))
+	require.Equal(t, WatchAlertCreated, e.Type)
+	require.Equal(t, amv2.LabelSet{"alertname": "b", "team": "db"}, e.Alert.Labels)
+}
+
+func receiverNames(a *GettableAlert) []string {
+	res := make([]string, 0, len(a.Receivers))
+	for _, r := range a.Receivers {
+		res = append(res, *r.Name)
+	}
+	return res
+}
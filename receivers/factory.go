@@ -58,7 +58,7 @@ func NewFactoryConfig(config *NotificationChannelConfig, notificationService Not
 	}
 	return FactoryConfig{
 		Config:              config,
-		NotificationService: notificationService,
+		NotificationService: ContextSender(notificationService),
 		GrafanaBuildVersion: buildVersion,
 		DecryptFunc:         decryptFunc,
 		Template:            template,
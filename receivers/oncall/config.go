@@ -0,0 +1,196 @@
+package oncall
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/alerting/receivers"
+)
+
+// TimeLayout is the layout of the handoff and the overrides, in the timezone of the rotation.
+const TimeLayout = "2006-01-02T15:04"
+
+const day = 24 * time.Hour
+
+type Config struct {
+	Participants []Participant
+	ShiftLength  time.Duration
+	// Handoff is the start of the first shift. The following shifts start ShiftLength after one another, at the time
+	// of day of the handoff when ShiftLength is a whole number of days.
+	Handoff   time.Time
+	Location  *time.Location
+	Overrides []Override
+}
+
+// Participant is a participant of the rotation, notified with the notifier of the type and settings of their contact.
+type Participant struct {
+	Name     string
+	Type     string
+	Settings json.RawMessage
+	// SecureSettings are the secure settings of the rotation prefixed by the name of the participant and a dot.
+	SecureSettings map[string][]byte
+}
+
+// Override puts a participant on call from Start to End instead of the participant of the rotation.
+type Override struct {
+	Participant string
+	Start       time.Time
+	End         time.Time
+}
+
+func ValidateConfig(fc receivers.FactoryConfig) (*Config, error) {
+	type participantRaw struct {
+		Name     string          `json:"name,omitempty" yaml:"name,omitempty"`
+		Type     string          `json:"type,omitempty" yaml:"type,omitempty"`
+		Settings json.RawMessage `json:"settings,omitempty" yaml:"settings,omitempty"`
+	}
+	type overrideRaw struct {
+		Participant string `json:"participant,omitempty" yaml:"participant,omitempty"`
+		Start       string `json:"start,omitempty" yaml:"start,omitempty"`
+		End         string `json:"end,omitempty" yaml:"end,omitempty"`
+	}
+	var settings struct {
+		Participants []participantRaw `json:"participants,omitempty" yaml:"participants,omitempty"`
+		ShiftLength  string           `json:"shiftLength,omitempty" yaml:"shiftLength,omitempty"`
+		Handoff      string           `json:"handoff,omitempty" yaml:"handoff,omitempty"`
+		Timezone     string           `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+		Overrides    []overrideRaw    `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+	}
+	if err := json.Unmarshal(fc.Config.Settings, &settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal settings: %w", err)
+	}
+
+	cfg := &Config{Location: time.UTC}
+	if settings.Timezone != "" {
+		loc, err := time.LoadLocation(settings.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", settings.Timezone, err)
+		}
+		cfg.Location = loc
+	}
+
+	if len(settings.Participants) == 0 {
+		return nil, errors.New("at least one participant is required")
+	}
+	names := make(map[string]struct{}, len(settings.Participants))
+	for i, p := range settings.Participants {
+		if p.Name == "" {
+			return nil, fmt.Errorf("participant %d: required field 'name' is not specified", i)
+		}
+		if _, ok := names[p.Name]; ok {
+			return nil, fmt.Errorf("duplicate participant %q", p.Name)
+		}
+		names[p.Name] = struct{}{}
+		if p.Type == "" {
+			return nil, fmt.Errorf("participant %q: required field 'type' is not specified", p.Name)
+		}
+		if strings.EqualFold(p.Type, fc.Config.Type) {
+			return nil, fmt.Errorf("participant %q: the contact cannot be of type %q", p.Name, p.Type)
+		}
+		if len(p.Settings) == 0 {
+			p.Settings = json.RawMessage("{}")
+		}
+		cfg.Participants = append(cfg.Participants, Participant{
+			Name:           p.Name,
+			Type:           p.Type,
+			Settings:       p.Settings,
+			SecureSettings: participantSecureSettings(fc.Config.SecureSettings, p.Name),
+		})
+	}
+
+	if settings.ShiftLength == "" {
+		return nil, errors.New("required field 'shiftLength' is not specified")
+	}
+	shift, err := model.ParseDuration(settings.ShiftLength)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shiftLength: %w", err)
+	}
+	if shift <= 0 {
+		return nil, errors.New("shiftLength must be positive")
+	}
+	cfg.ShiftLength = time.Duration(shift)
+
+	if settings.Handoff == "" {
+		return nil, errors.New("required field 'handoff' is not specified")
+	}
+	if cfg.Handoff, err = time.ParseInLocation(TimeLayout, settings.Handoff, cfg.Location); err != nil {
+		return nil, fmt.Errorf("invalid handoff: %w", err)
+	}
+
+	for i, o := range settings.Overrides {
+		if _, ok := names[o.Participant]; !ok {
+			return nil, fmt.Errorf("override %d: unknown participant %q", i, o.Participant)
+		}
+		start, err := time.ParseInLocation(TimeLayout, o.Start, cfg.Location)
+		if err != nil {
+			return nil, fmt.Errorf("override %d: invalid start: %w", i, err)
+		}
+		end, err := time.ParseInLocation(TimeLayout, o.End, cfg.Location)
+		if err != nil {
+			return nil, fmt.Errorf("override %d: invalid end: %w", i, err)
+		}
+		if !end.After(start) {
+			return nil, fmt.Errorf("override %d: end must be after start", i)
+		}
+		cfg.Overrides = append(cfg.Overrides, Override{Participant: o.Participant, Start: start, End: end})
+	}
+	return cfg, nil
+}
+
+// participantSecureSettings returns the secure settings prefixed by the name of the participant, without the prefix.
+func participantSecureSettings(secure map[string][]byte, name string) map[string][]byte {
+	res := map[string][]byte{}
+	prefix := name + "."
+	for k, v := range secure {
+		if strings.HasPrefix(k, prefix) {
+			res[strings.TrimPrefix(k, prefix)] = v
+		}
+	}
+	return res
+}
+
+// OnCall returns the participant on call at the given time: the participant of the first override that covers it,
+// otherwise the participant of its shift.
+func (c *Config) OnCall(now time.Time) Participant {
+	for _, o := range c.Overrides {
+		if !now.Before(o.Start) && now.Before(o.End) {
+			for _, p := range c.Participants {
+				if p.Name == o.Participant {
+					return p
+				}
+			}
+		}
+	}
+	n := int64(len(c.Participants))
+	return c.Participants[((c.shift(now)%n)+n)%n]
+}
+
+// shift returns the index of the shift at the given time, negative before the handoff.
+func (c *Config) shift(now time.Time) int64 {
+	if c.ShiftLength%day != 0 {
+		return floorDiv(int64(now.Sub(c.Handoff)), int64(c.ShiftLength))
+	}
+
+	// Count calendar days so that the handoff happens at the same local time across daylight saving time changes.
+	now = now.In(c.Location)
+	y, m, d := now.Date()
+	hy, hm, hd := c.Handoff.Date()
+	days := int64(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Sub(time.Date(hy, hm, hd, 0, 0, 0, 0, time.UTC)) / day)
+	if now.Before(time.Date(y, m, d, c.Handoff.Hour(), c.Handoff.Minute(), 0, 0, c.Location)) {
+		days--
+	}
+	return floorDiv(days, int64(c.ShiftLength/day))
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
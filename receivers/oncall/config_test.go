@@ -0,0 +1,182 @@
+package oncall
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/alerting/receivers"
+	testing2 "github.com/grafana/alerting/receivers/testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	cases := []struct {
+		name              string
+		settings          string
+		secretSettings    map[string][]byte
+		expectedConfig    *Config
+		expectedInitError string
+	}{
+		{
+			name:              "Error if empty",
+			settings:          "",
+			expectedInitError: `failed to unmarshal settings`,
+		},
+		{
+			name:              "Error if no participants",
+			settings:          `{"shiftLength": "1w", "handoff": "2023-01-02T09:00"}`,
+			expectedInitError: `at least one participant is required`,
+		},
+		{
+			name:              "Error if participant without type",
+			settings:          `{"participants": [{"name": "alice"}], "shiftLength": "1w", "handoff": "2023-01-02T09:00"}`,
+			expectedInitError: `participant "alice": required field 'type' is not specified`,
+		},
+		{
+			name:              "Error if participant of type oncall",
+			settings:          `{"participants": [{"name": "alice", "type": "oncall"}], "shiftLength": "1w", "handoff": "2023-01-02T09:00"}`,
+			expectedInitError: `participant "alice": the contact cannot be of type "oncall"`,
+		},
+		{
+			name:              "Error if duplicate participants",
+			settings:          `{"participants": [{"name": "alice", "type": "email"}, {"name": "alice", "type": "slack"}], "shiftLength": "1w", "handoff": "2023-01-02T09:00"}`,
+			expectedInitError: `duplicate participant "alice"`,
+		},
+		{
+			name:              "Error if no shift length",
+			settings:          `{"participants": [{"name": "alice", "type": "email"}], "handoff": "2023-01-02T09:00"}`,
+			expectedInitError: `required field 'shiftLength' is not specified`,
+		},
+		{
+			name:              "Error if invalid handoff",
+			settings:          `{"participants": [{"name": "alice", "type": "email"}], "shiftLength": "1w", "handoff": "monday"}`,
+			expectedInitError: `invalid handoff`,
+		},
+		{
+			name:              "Error if invalid timezone",
+			settings:          `{"participants": [{"name": "alice", "type": "email"}], "shiftLength": "1w", "handoff": "2023-01-02T09:00", "timezone": "Mars/Olympus"}`,
+			expectedInitError: `invalid timezone "Mars/Olympus"`,
+		},
+		{
+			name:              "Error if override of unknown participant",
+			settings:          `{"participants": [{"name": "alice", "type": "email"}], "shiftLength": "1w", "handoff": "2023-01-02T09:00", "overrides": [{"participant": "bob", "start": "2023-01-03T09:00", "end": "2023-01-04T09:00"}]}`,
+			expectedInitError: `override 0: unknown participant "bob"`,
+		},
+		{
+			name:              "Error if override ends before it starts",
+			settings:          `{"participants": [{"name": "alice", "type": "email"}], "shiftLength": "1w", "handoff": "2023-01-02T09:00", "overrides": [{"participant": "alice", "start": "2023-01-04T09:00", "end": "2023-01-03T09:00"}]}`,
+			expectedInitError: `override 0: end must be after start`,
+		},
+		{
+			name: "Extracts all fields",
+			settings: `{
+				"participants": [
+					{"name": "alice", "type": "email", "settings": {"addresses": "alice@example.com"}},
+					{"name": "bob", "type": "webhook", "settings": {"url": "http://localhost"}}
+				],
+				"shiftLength": "1w",
+				"handoff": "2023-01-02T09:00",
+				"timezone": "UTC",
+				"overrides": [{"participant": "bob", "start": "2023-01-03T09:00", "end": "2023-01-04T09:00"}]
+			}`,
+			secretSettings: map[string][]byte{
+				"bob.password": []byte("secret"),
+			},
+			expectedConfig: &Config{
+				Participants: []Participant{
+					{Name: "alice", Type: "email", Settings: json.RawMessage(`{"addresses": "alice@example.com"}`), SecureSettings: map[string][]byte{}},
+					{Name: "bob", Type: "webhook", Settings: json.RawMessage(`{"url": "http://localhost"}`), SecureSettings: map[string][]byte{"password": []byte("secret")}},
+				},
+				ShiftLength: 7 * 24 * time.Hour,
+				Handoff:     time.Date(2023, 1, 2, 9, 0, 0, 0, time.UTC),
+				Location:    time.UTC,
+				Overrides: []Override{
+					{Participant: "bob", Start: time.Date(2023, 1, 3, 9, 0, 0, 0, time.UTC), End: time.Date(2023, 1, 4, 9, 0, 0, 0, time.UTC)},
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := &receivers.NotificationChannelConfig{
+				Type:           "oncall",
+				Settings:       json.RawMessage(c.settings),
+				SecureSettings: c.secretSettings,
+			}
+			fc, err := testing2.NewFactoryConfigForValidateConfigTesting(t, m)
+			require.NoError(t, err)
+
+			actual, err := ValidateConfig(fc)
+
+			if c.expectedInitError != "" {
+				require.ErrorContains(t, err, c.expectedInitError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expectedConfig, actual)
+		})
+	}
+}
+
+func TestOnCall(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	participants := []Participant{{Name: "alice"}, {Name: "bob"}, {Name: "carol"}}
+
+	t.Run("weekly rotation at the handoff time across daylight saving time", func(t *testing.T) {
+		// Daylight saving time starts on 2023-03-26 in Berlin.
+		cfg := &Config{
+			Participants: participants,
+			ShiftLength:  7 * 24 * time.Hour,
+			Handoff:      time.Date(2023, 3, 20, 9, 0, 0, 0, berlin),
+			Location:     berlin,
+		}
+		cases := []struct {
+			at       time.Time
+			expected string
+		}{
+			{at: time.Date(2023, 3, 20, 9, 0, 0, 0, berlin), expected: "alice"},
+			{at: time.Date(2023, 3, 27, 8, 59, 0, 0, berlin), expected: "alice"},
+			{at: time.Date(2023, 3, 27, 9, 0, 0, 0, berlin), expected: "bob"},
+			{at: time.Date(2023, 4, 3, 9, 0, 0, 0, berlin), expected: "carol"},
+			{at: time.Date(2023, 4, 10, 9, 0, 0, 0, berlin), expected: "alice"},
+			{at: time.Date(2023, 3, 27, 7, 30, 0, 0, time.UTC), expected: "bob"},
+			// Before the first handoff, the rotation runs backwards.
+			{at: time.Date(2023, 3, 20, 8, 0, 0, 0, berlin), expected: "carol"},
+		}
+		for _, c := range cases {
+			require.Equal(t, c.expected, cfg.OnCall(c.at).Name, c.at.String())
+		}
+	})
+
+	t.Run("rotation of hours", func(t *testing.T) {
+		cfg := &Config{
+			Participants: participants,
+			ShiftLength:  12 * time.Hour,
+			Handoff:      time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC),
+			Location:     time.UTC,
+		}
+		require.Equal(t, "alice", cfg.OnCall(time.Date(2023, 1, 1, 19, 59, 0, 0, time.UTC)).Name)
+		require.Equal(t, "bob", cfg.OnCall(time.Date(2023, 1, 1, 20, 0, 0, 0, time.UTC)).Name)
+		require.Equal(t, "carol", cfg.OnCall(time.Date(2023, 1, 2, 8, 0, 0, 0, time.UTC)).Name)
+		require.Equal(t, "carol", cfg.OnCall(time.Date(2023, 1, 1, 7, 0, 0, 0, time.UTC)).Name)
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		cfg := &Config{
+			Participants: participants,
+			ShiftLength:  7 * 24 * time.Hour,
+			Handoff:      time.Date(2023, 1, 2, 9, 0, 0, 0, time.UTC),
+			Location:     time.UTC,
+			Overrides: []Override{
+				{Participant: "carol", Start: time.Date(2023, 1, 3, 9, 0, 0, 0, time.UTC), End: time.Date(2023, 1, 4, 9, 0, 0, 0, time.UTC)},
+			},
+		}
+		require.Equal(t, "alice", cfg.OnCall(time.Date(2023, 1, 3, 8, 59, 0, 0, time.UTC)).Name)
+		require.Equal(t, "carol", cfg.OnCall(time.Date(2023, 1, 3, 9, 0, 0, 0, time.UTC)).Name)
+		require.Equal(t, "alice", cfg.OnCall(time.Date(2023, 1, 4, 9, 0, 0, 0, time.UTC)).Name)
+	})
+}
@@ -0,0 +1,79 @@
+package oncall
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+
+	"github.com/grafana/alerting/logging"
+	"github.com/grafana/alerting/receivers"
+)
+
+// ContactNotifier notifies the contact of a participant.
+type ContactNotifier interface {
+	Notify(ctx context.Context, alerts ...*types.Alert) (bool, error)
+	SendResolved() bool
+}
+
+// ContactFactory builds the notifier of the contact of a participant from the factory configuration of its type and
+// settings.
+type ContactFactory func(fc receivers.FactoryConfig) (ContactNotifier, error)
+
+// Notifier is responsible for sending alert notifications to the participant of a rotation who is on call.
+type Notifier struct {
+	*receivers.Base
+	log      logging.Logger
+	settings *Config
+	// contacts are the notifiers of the participants, by name.
+	contacts map[string]ContactNotifier
+	now      func() time.Time
+}
+
+// New builds the notifier of the rotation and the notifiers of the contacts of its participants with newContact.
+func New(fc receivers.FactoryConfig, newContact ContactFactory) (*Notifier, error) {
+	settings, err := ValidateConfig(fc)
+	if err != nil {
+		return nil, err
+	}
+
+	contacts := make(map[string]ContactNotifier, len(settings.Participants))
+	for _, p := range settings.Participants {
+		cfg := fc
+		cfg.Config = &receivers.NotificationChannelConfig{
+			OrgID:                 fc.Config.OrgID,
+			UID:                   fc.Config.UID,
+			Name:                  fc.Config.Name,
+			Type:                  p.Type,
+			DisableResolveMessage: fc.Config.DisableResolveMessage,
+			Settings:              p.Settings,
+			SecureSettings:        p.SecureSettings,
+		}
+		n, err := newContact(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("participant %q: %w", p.Name, err)
+		}
+		contacts[p.Name] = n
+	}
+
+	return &Notifier{
+		Base:     receivers.NewBase(fc.Config),
+		log:      fc.Logger,
+		settings: settings,
+		contacts: contacts,
+		now:      time.Now,
+	}, nil
+}
+
+// Notify sends the alert notification to the participant on call. The resolved notifications go to the participant
+// on call when the alerts are resolved, who may not be the one notified when they fired.
+func (n *Notifier) Notify(ctx context.Context, alerts ...*types.Alert) (bool, error) {
+	p := n.settings.OnCall(n.now())
+	n.log.Debug("notifying the participant on call", "participant", p.Name, "type", p.Type)
+	return n.contacts[p.Name].Notify(ctx, alerts...)
+}
+
+func (n *Notifier) SendResolved() bool {
+	return !n.GetDisableResolveMessage()
+}
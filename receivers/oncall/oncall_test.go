@@ -0,0 +1,86 @@
+package oncall
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/alerting/images"
+	"github.com/grafana/alerting/logging"
+	"github.com/grafana/alerting/receivers"
+	"github.com/grafana/alerting/receivers/webhook"
+	"github.com/grafana/alerting/templates"
+)
+
+func TestNotifier(t *testing.T) {
+	tmpl := templates.ForTests(t)
+	externalURL, err := url.Parse("http://localhost")
+	require.NoError(t, err)
+	tmpl.ExternalURL = externalURL
+
+	settings := `{
+		"participants": [
+			{"name": "alice", "type": "webhook", "settings": {"url": "http://localhost/alice"}},
+			{"name": "bob", "type": "webhook", "settings": {"url": "http://localhost/bob", "username": "bob"}}
+		],
+		"shiftLength": "1d",
+		"handoff": "2023-01-02T09:00"
+	}`
+	sender := receivers.MockNotificationService()
+	fc := receivers.FactoryConfig{
+		Config: &receivers.NotificationChannelConfig{
+			Name:           "oncall",
+			Type:           "oncall",
+			Settings:       json.RawMessage(settings),
+			SecureSettings: map[string][]byte{"bob.password": []byte("secret")},
+		},
+		NotificationService: sender,
+		DecryptFunc: func(_ context.Context, sjd map[string][]byte, key string, fallback string) string {
+			if v, ok := sjd[key]; ok {
+				return string(v)
+			}
+			return fallback
+		},
+		ImageStore: &images.UnavailableImageStore{},
+		Template:   tmpl,
+		Logger:     &logging.FakeLogger{},
+	}
+	newContact := func(fc receivers.FactoryConfig) (ContactNotifier, error) {
+		if fc.Config.Type != "webhook" {
+			return nil, errors.New("unsupported")
+		}
+		return webhook.New(fc)
+	}
+
+	n, err := New(fc, newContact)
+	require.NoError(t, err)
+	ctx := notify.WithGroupKey(context.Background(), "alertname")
+	alert := &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "alert1"}}}
+
+	n.now = func() time.Time { return time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC) }
+	ok, err := n.Notify(ctx, alert)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "http://localhost/alice", sender.Webhook.URL)
+
+	n.now = func() time.Time { return time.Date(2023, 1, 3, 10, 0, 0, 0, time.UTC) }
+	ok, err = n.Notify(ctx, alert)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "http://localhost/bob", sender.Webhook.URL)
+	require.Equal(t, "bob", sender.Webhook.User)
+	require.Equal(t, "secret", sender.Webhook.Password)
+
+	// The contacts are validated when the receiver is built.
+	fc.Config.Settings = json.RawMessage(`{"participants": [{"name": "alice", "type": "email"}], "shiftLength": "1d", "handoff": "2023-01-02T09:00"}`)
+	_, err = New(fc, newContact)
+	require.EqualError(t, err, `participant "alice": unsupported`)
+}
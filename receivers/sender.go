@@ -0,0 +1,158 @@
+package receivers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/grafana/alerting/tracing"
+)
+
+type notificationSenderKey struct{}
+
+// WithNotificationSender returns a context in which notifiers send their webhooks and emails with s rather than their
+// own NotificationSender. It applies to notifiers whose NotificationSender is a ContextSender, as the ones created from
+// a FactoryConfig built by NewFactoryConfig or created by the factories of the notify package, and to the notifiers
+// that send HTTP requests themselves.
+func WithNotificationSender(ctx context.Context, s NotificationSender) context.Context {
+	return context.WithValue(ctx, notificationSenderKey{}, s)
+}
+
+// NotificationSenderFromContext returns the NotificationSender set with WithNotificationSender, if any.
+func NotificationSenderFromContext(ctx context.Context) (NotificationSender, bool) {
+	s, ok := ctx.Value(notificationSenderKey{}).(NotificationSender)
+	return s, ok
+}
+
+// ContextSender returns a NotificationSender that sends with the NotificationSender of the context, if any, or with s.
+func ContextSender(s NotificationSender) NotificationSender {
+	if cs, ok := s.(contextSender); ok {
+		return cs
+	}
+	return contextSender{s}
+}
+
+// contextSender sends with the NotificationSender of the context, if any, or with its own.
+type contextSender struct {
+	NotificationSender
+}
+
+func (s contextSender) SendWebhook(ctx context.Context, cmd *SendWebhookSettings) error {
+	if override, ok := NotificationSenderFromContext(ctx); ok {
+		return sendWebhook(ctx, override, cmd)
+	}
+	return sendWebhook(ctx, s.NotificationSender, cmd)
+}
+
+func (s contextSender) SendEmail(ctx context.Context, cmd *SendEmailSettings) error {
+	sender := s.NotificationSender
+	if override, ok := NotificationSenderFromContext(ctx); ok {
+		sender = override
+	}
+	ctx, span := tracing.Start(ctx, "SendEmail", attribute.Int("email.recipients", len(cmd.To)))
+	err := sender.SendEmail(ctx, cmd)
+	tracing.End(span, err)
+	return err
+}
+
+// sendWebhook sends the webhook within a span, whose context the sender can inject in the headers of the request.
+func sendWebhook(ctx context.Context, s NotificationSender, cmd *SendWebhookSettings) error {
+	method := cmd.HTTPMethod
+	if method == "" {
+		method = http.MethodPost
+	}
+	ctx, span := tracing.Start(ctx, "SendWebhook", attribute.String("http.method", method))
+	err := s.SendWebhook(ctx, withStatusValidation(cmd))
+	tracing.End(span, err)
+	return err
+}
+
+// withStatusValidation returns a copy of the webhook whose validation fails with an HTTPStatusError when the response
+// has an unexpected status code, before the validation of the notifier, so that the status code of the failure is
+// known whatever the sender.
+func withStatusValidation(cmd *SendWebhookSettings) *SendWebhookSettings {
+	validate := cmd.Validation
+	c := *cmd
+	c.Validation = func(body []byte, statusCode int) error {
+		if statusCode/100 != 2 {
+			return HTTPStatusError{Code: statusCode}
+		}
+		if validate != nil {
+			return validate(body, statusCode)
+		}
+		return nil
+	}
+	return &c
+}
+
+// SendRequestWithContextSender sends the request as a webhook with the NotificationSender of the context, for the
+// notifiers that send HTTP requests with their own client. It returns false if the context has none.
+func SendRequestWithContextSender(ctx context.Context, req *http.Request) (bool, error) {
+	s, ok := NotificationSenderFromContext(ctx)
+	if !ok {
+		return false, nil
+	}
+
+	cmd := &SendWebhookSettings{
+		URL:         req.URL.String(),
+		HTTPMethod:  req.Method,
+		HTTPHeader:  make(map[string]string, len(req.Header)),
+		ContentType: req.Header.Get("Content-Type"),
+	}
+	if user, password, ok := req.BasicAuth(); ok {
+		cmd.User, cmd.Password = user, password
+	}
+	for k := range req.Header {
+		if k != "Content-Type" && k != "Authorization" {
+			cmd.HTTPHeader[k] = req.Header.Get(k)
+		}
+	}
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			return true, fmt.Errorf("failed to read request body: %w", err)
+		}
+		cmd.Body = string(b)
+	}
+	return true, sendWebhook(ctx, s, cmd)
+}
+
+// CapturingSender is a NotificationSender that records the webhooks and emails it is asked to send instead of
+// sending them.
+type CapturingSender struct {
+	mtx      sync.Mutex
+	webhooks []SendWebhookSettings
+	emails   []SendEmailSettings
+}
+
+func (s *CapturingSender) SendWebhook(_ context.Context, cmd *SendWebhookSettings) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.webhooks = append(s.webhooks, *cmd)
+	return nil
+}
+
+func (s *CapturingSender) SendEmail(_ context.Context, cmd *SendEmailSettings) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.emails = append(s.emails, *cmd)
+	return nil
+}
+
+// Webhooks returns the webhooks captured so far.
+func (s *CapturingSender) Webhooks() []SendWebhookSettings {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]SendWebhookSettings{}, s.webhooks...)
+}
+
+// Emails returns the emails captured so far.
+func (s *CapturingSender) Emails() []SendEmailSettings {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]SendEmailSettings{}, s.emails...)
+}
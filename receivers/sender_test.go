@@ -0,0 +1,114 @@
+package receivers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestContextSender(t *testing.T) {
+	own := &CapturingSender{}
+	s := ContextSender(own)
+
+	require.NoError(t, s.SendWebhook(context.Background(), &SendWebhookSettings{URL: "http://own"}))
+	require.Len(t, own.Webhooks(), 1)
+
+	override := &CapturingSender{}
+	ctx := WithNotificationSender(context.Background(), override)
+	require.NoError(t, s.SendWebhook(ctx, &SendWebhookSettings{URL: "http://override"}))
+	require.NoError(t, s.SendEmail(ctx, &SendEmailSettings{Subject: "test"}))
+	require.Len(t, own.Webhooks(), 1)
+	require.Empty(t, own.Emails())
+	require.Equal(t, []SendWebhookSettings{{URL: "http://override"}}, withoutValidation(override.Webhooks()))
+	require.Equal(t, []SendEmailSettings{{Subject: "test"}}, override.Emails())
+
+	// Wrapping is idempotent.
+	require.Equal(t, s, ContextSender(ContextSender(own)))
+}
+
+func TestSendRequestWithContextSender(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "http://localhost/api", strings.NewReader(`{"text":"test"}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Custom", "value")
+	req.SetBasicAuth("user", "password")
+
+	ok, err := SendRequestWithContextSender(context.Background(), req)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	s := &CapturingSender{}
+	ok, err = SendRequestWithContextSender(WithNotificationSender(context.Background(), s), req)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, []SendWebhookSettings{{
+		URL:         "http://localhost/api",
+		User:        "user",
+		Password:    "password",
+		Body:        `{"text":"test"}`,
+		HTTPMethod:  http.MethodPost,
+		HTTPHeader:  map[string]string{"X-Custom": "value"},
+		ContentType: "application/json",
+	}}, withoutValidation(s.Webhooks()))
+}
+
+// withoutValidation removes the validations of the webhooks, which cannot be compared.
+func withoutValidation(webhooks []SendWebhookSettings) []SendWebhookSettings {
+	for i := range webhooks {
+		webhooks[i].Validation = nil
+	}
+	return webhooks
+}
+
+func TestContextSenderStatusValidation(t *testing.T) {
+	own := &CapturingSender{}
+	require.NoError(t, ContextSender(own).SendWebhook(context.Background(), &SendWebhookSettings{
+		URL: "http://own",
+		Validation: func(body []byte, _ int) error {
+			if string(body) != "ok" {
+				return errors.New("invalid response")
+			}
+			return nil
+		},
+	}))
+	validate := own.Webhooks()[0].Validation
+
+	// The status code is checked before the validation of the notifier.
+	require.Equal(t, HTTPStatusError{Code: 503}, validate([]byte("ok"), 503))
+	require.EqualError(t, validate([]byte("not ok"), 200), "invalid response")
+	require.NoError(t, validate([]byte("ok"), 204))
+}
+
+// spanSender records the span context of the webhooks it is asked to send.
+type spanSender struct {
+	CapturingSender
+	spans []trace.SpanContext
+}
+
+func (s *spanSender) SendWebhook(ctx context.Context, cmd *SendWebhookSettings) error {
+	s.spans = append(s.spans, trace.SpanContextFromContext(ctx))
+	return s.CapturingSender.SendWebhook(ctx, cmd)
+}
+
+func TestContextSenderTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	ctx, root := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "root")
+
+	own := &spanSender{}
+	require.NoError(t, contextSender{own}.SendWebhook(ctx, &SendWebhookSettings{URL: "http://own"}))
+	root.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, "SendWebhook", spans[0].Name())
+	require.Equal(t, root.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	// The sender is given the context of the span, to inject it in the headers of the request.
+	require.Equal(t, []trace.SpanContext{spans[0].SpanContext()}, own.spans)
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/grafana/alerting/logging"
 	"github.com/grafana/alerting/receivers"
 	"github.com/grafana/alerting/templates"
+	"github.com/grafana/alerting/tracing"
 )
 
 const (
@@ -182,7 +183,13 @@ func (sn *Notifier) Notify(ctx context.Context, alerts ...*types.Alert) (bool, e
 // sendSlackRequest sends a request to the Slack API.
 // Stubbable by tests.
 var sendSlackRequest = func(ctx context.Context, req *http.Request, logger logging.Logger) (string, error) {
+	if ok, err := receivers.SendRequestWithContextSender(ctx, req); ok {
+		return "", err
+	}
+
+	req, span := tracing.StartHTTP(req)
 	resp, err := slackClient.Do(req)
+	tracing.EndHTTP(span, resp, err)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %w", err)
 	}
@@ -16,6 +16,7 @@ import (
 	"github.com/prometheus/common/model"
 
 	"github.com/grafana/alerting/logging"
+	"github.com/grafana/alerting/tracing"
 )
 
 type AlertStateType string
@@ -35,6 +36,21 @@ func GetAlertStatusColor(status model.AlertStatus) string {
 	return ColorAlertResolved
 }
 
+// HTTPStatusError is returned when an HTTP request completes with an unexpected status code.
+// Senders should return it, or an error wrapping it, so that callers can tell which status code caused the failure.
+type HTTPStatusError struct {
+	Code int
+}
+
+func (e HTTPStatusError) Error() string {
+	return fmt.Sprintf("failed to send HTTP request - status code %d", e.Code)
+}
+
+// StatusCode returns the status code of the response.
+func (e HTTPStatusError) StatusCode() int {
+	return e.Code
+}
+
 type HTTPCfg struct {
 	Body     []byte
 	User     string
@@ -60,6 +76,9 @@ var SendHTTPRequest = func(ctx context.Context, url *url.URL, cfg HTTPCfg, logge
 
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("User-Agent", "Grafana")
+	if ok, err := SendRequestWithContextSender(ctx, request); ok {
+		return nil, err
+	}
 	netTransport := &http.Transport{
 		TLSClientConfig: &tls.Config{
 			Renegotiation: tls.RenegotiateFreelyAsClient,
@@ -74,7 +93,9 @@ var SendHTTPRequest = func(ctx context.Context, url *url.URL, cfg HTTPCfg, logge
 		Timeout:   time.Second * 30,
 		Transport: netTransport,
 	}
+	request, span := tracing.StartHTTP(request)
 	resp, err := netClient.Do(request)
+	tracing.EndHTTP(span, resp, err)
 	if err != nil {
 		return nil, err
 	}
@@ -92,7 +113,7 @@ var SendHTTPRequest = func(ctx context.Context, url *url.URL, cfg HTTPCfg, logge
 	if resp.StatusCode/100 != 2 {
 		logger.Warn("HTTP request failed", "url", request.URL.String(), "statusCode", resp.Status, "Body",
 			string(respBody))
-		return nil, fmt.Errorf("failed to send HTTP request - status code %d", resp.StatusCode)
+		return nil, HTTPStatusError{Code: resp.StatusCode}
 	}
 
 	logger.Debug("sending HTTP request succeeded", "url", request.URL.String(), "statusCode", resp.Status)
@@ -13,6 +13,9 @@ type SendWebhookSettings struct {
 	Validation  func(body []byte, statusCode int) error
 }
 
+// WebhookSender sends webhooks. When the request completes, the sender must call the Validation of the webhook, if
+// any, with the response and return an error wrapping the one it returns. The notifiers set a Validation that returns
+// an HTTPStatusError when the status code is unexpected.
 type WebhookSender interface {
 	SendWebhook(ctx context.Context, cmd *SendWebhookSettings) error
 }
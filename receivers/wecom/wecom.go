@@ -14,6 +14,7 @@ import (
 	"github.com/grafana/alerting/logging"
 	"github.com/grafana/alerting/receivers"
 	template2 "github.com/grafana/alerting/templates"
+	"github.com/grafana/alerting/tracing"
 )
 
 // Notifier is responsible for sending alert notifications to WeCom.
@@ -138,7 +139,17 @@ func (w *Notifier) getAccessToken(ctx context.Context) (*accessToken, error) {
 	request.Header.Add("Content-Type", "application/json")
 	request.Header.Add("User-Agent", "Grafana")
 
+	// The sender of the context does not return the response, a dry run continues without a token.
+	if ok, err := receivers.SendRequestWithContextSender(ctx, request); ok {
+		if err != nil {
+			return nil, err
+		}
+		return &accessToken{}, nil
+	}
+
+	request, span := tracing.StartHTTP(request)
 	resp, err := http.DefaultClient.Do(request)
+	tracing.EndHTTP(span, resp, err)
 	if err != nil {
 		return nil, err
 	}
@@ -40,6 +40,13 @@ Labels:
 {{ end }}{{ end }}{{ if gt (len .Alerts.Resolved) 0 }}**Resolved**
 {{ template "__text_alert_list" .Alerts.Resolved }}{{ end }}{{ end }}
 
+{{ define "default.digest" }}{{ len .Alerts }} alerts, {{ len .Alerts.Firing }} firing and {{ len .Alerts.Resolved }} resolved.
+{{ if gt (len .Alerts.Firing) 0 }}
+**Firing**
+{{ template "__text_alert_list" .Alerts.Firing }}{{ end }}{{ if gt (len .Alerts.Resolved) 0 }}
+**Resolved**
+{{ template "__text_alert_list" .Alerts.Resolved }}{{ end }}{{ end }}
+
 
 {{ define "__teams_text_alert_list" }}{{ range . }}
 Value: {{ template "__text_values_list" . }}
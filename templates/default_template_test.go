@@ -236,6 +236,55 @@ Source: [http://localhost/alert4](http://localhost/alert4)
 Silence: [http://localhost/grafana/alerting/silence/new?alertmanager=grafana&matcher=alertname%3Dalert1&matcher=lbl1%3Dval4](http://localhost/grafana/alerting/silence/new?alertmanager=grafana&matcher=alertname%3Dalert1&matcher=lbl1%3Dval4)
 
 
+`,
+		},
+		{
+			templateString: `{{ template "default.digest" .}}`,
+			expected: `4 alerts, 2 firing and 2 resolved.
+
+**Firing**
+
+Value: A=1234
+Labels:
+ - alertname = alert1
+ - lbl1 = val1
+Annotations:
+ - ann1 = annv1
+Source: http://localhost/alert1?orgId=1
+Silence: http://localhost/grafana/alerting/silence/new?alertmanager=grafana&matcher=alertname%3Dalert1&matcher=lbl1%3Dval1
+Dashboard: http://localhost/grafana/d/dbuid123?orgId=1
+Panel: http://localhost/grafana/d/dbuid123?orgId=1&viewPanel=puid123
+
+Value: A=1234, B=5678, C=9
+Labels:
+ - alertname = alert1
+ - lbl1 = val2
+Annotations:
+ - ann1 = annv2
+Source: http://localhost/alert2
+Silence: http://localhost/grafana/alerting/silence/new?alertmanager=grafana&matcher=alertname%3Dalert1&matcher=lbl1%3Dval2
+
+**Resolved**
+
+Value: A=1234
+Labels:
+ - alertname = alert1
+ - lbl1 = val3
+Annotations:
+ - ann1 = annv3
+Source: http://localhost/alert3?orgId=1
+Silence: http://localhost/grafana/alerting/silence/new?alertmanager=grafana&matcher=alertname%3Dalert1&matcher=lbl1%3Dval3
+Dashboard: http://localhost/grafana/d/dbuid456?orgId=1
+Panel: http://localhost/grafana/d/dbuid456?orgId=1&viewPanel=puid456
+
+Value: A=1234
+Labels:
+ - alertname = alert1
+ - lbl1 = val4
+Annotations:
+ - ann1 = annv4
+Source: http://localhost/alert4
+Silence: http://localhost/grafana/alerting/silence/new?alertmanager=grafana&matcher=alertname%3Dalert1&matcher=lbl1%3Dval4
 `,
 		},
 	}
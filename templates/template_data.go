@@ -16,6 +16,7 @@ import (
 
 	"github.com/grafana/alerting/logging"
 	"github.com/grafana/alerting/models"
+	"github.com/grafana/alerting/tracing"
 )
 
 type ExtendedAlert struct {
@@ -180,7 +181,9 @@ func TmplText(ctx context.Context, tmpl *template.Template, alerts []*types.Aler
 		if *tmplErr != nil {
 			return
 		}
+		_, span := tracing.Start(ctx, "template.render")
 		s, *tmplErr = tmpl.ExecuteTextString(name, data)
+		tracing.End(span, *tmplErr)
 		return s
 	}, data
 }
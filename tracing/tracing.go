@@ -0,0 +1,57 @@
+// Package tracing creates the OpenTelemetry spans of the notification pipeline.
+//
+// Spans are created with the TracerProvider of the span of the context, so that nothing is traced unless the
+// Alertmanager is configured with a TracerProvider and the context descends from one of its spans.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the tracers of the package.
+const InstrumentationName = "github.com/grafana/alerting"
+
+// Start starts a span that is a child of the span of the context, with the TracerProvider of that span.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(InstrumentationName)
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records the error, if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// StartHTTP starts the span of an outbound HTTP request and injects the trace context in its headers, with the
+// global propagator. Only the host of the URL is recorded, as the path and query of webhooks often hold secrets.
+func StartHTTP(req *http.Request) (*http.Request, trace.Span) {
+	ctx, span := Start(req.Context(), "HTTP "+req.Method,
+		attribute.String("http.method", req.Method),
+		attribute.String("http.host", req.URL.Host),
+	)
+	req = req.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return req, span
+}
+
+// EndHTTP records the status code of the response, or the error, and ends the span.
+func EndHTTP(span trace.Span, resp *http.Response, err error) {
+	if resp != nil {
+		span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+		if err == nil && resp.StatusCode >= 400 {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+	End(span, err)
+}